@@ -0,0 +1,49 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrInvalidKey is returned for keys that are empty or would be stored outside of the store
+	ErrInvalidKey = errors.New("blobstore: invalid key")
+	// ErrNotFound is returned when nothing is stored under the key
+	ErrNotFound = errors.New("blobstore: not found")
+)
+
+// BlobStore keeps uploaded files, like food truck photos and profile pictures
+type BlobStore interface {
+	// Put stores the body under the key, returning the url it can be downloaded from
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error)
+	// Delete removes what is stored under the key, it isn't an error if there is nothing
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is a blob store that clients can upload files to directly, without sending them through the server
+type Presigner interface {
+	BlobStore
+	// PresignPut lets a client put a file of exactly the size and content type under the key until it expires
+	PresignPut(ctx context.Context, key string, contentType string, size int64, expires time.Duration) (PresignedUpload, error)
+	// Stat gets the size and content type of what is stored under the key
+	Stat(ctx context.Context, key string) (Info, error)
+	// Get opens what is stored under the key to be read
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// PresignedUpload is a request a client can send to upload a file straight to the blob store
+type PresignedUpload struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	// Headers have to be sent with the upload exactly as they are
+	Headers map[string]string `json:"headers"`
+	Expires time.Time         `json:"expires"`
+}
+
+// Info describes a stored file
+type Info struct {
+	Size        int64
+	ContentType string
+}
@@ -0,0 +1,209 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps files in a directory and serves them itself, for local development and tests
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+	files   http.Handler
+	// signingKey signs presigned uploads, so they only work until the store is recreated
+	signingKey []byte
+}
+
+// NewLocalStore creates a store that writes to dir, creating it if needed. Files are downloaded from baseURL, which
+// should be where the store is routed, like http://localhost/uploads
+func NewLocalStore(dir string, baseURL string) (*LocalStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	signingKey := make([]byte, 32)
+	_, err = rand.Read(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	s := &LocalStore{
+		Dir:        dir,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		signingKey: signingKey,
+	}
+	s.files = http.StripPrefix(s.Path(), http.FileServer(http.Dir(dir)))
+	return s, nil
+}
+
+// Path is the path of the base url, which the store should be routed at
+func (s *LocalStore) Path() string {
+	baseURL, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return "/"
+	}
+	return strings.TrimSuffix(baseURL.Path, "/") + "/"
+}
+
+// Put writes the body to a file under the directory, returning its url
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, body)
+	closeErr := file.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	return s.BaseURL + "/" + key, nil
+}
+
+// Delete removes the file
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	filename, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// PresignPut signs a url the file can be put at, which checks the size and content type when it is uploaded
+func (s *LocalStore) PresignPut(ctx context.Context, key string, contentType string, size int64, expires time.Duration) (PresignedUpload, error) {
+	_, err := s.filename(key)
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+	expiresAt := time.Now().Add(expires)
+	query := url.Values{}
+	query.Set("size", strconv.FormatInt(size, 10))
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", s.sign(key, contentType, size, expiresAt.Unix()))
+	return PresignedUpload{
+		URL:     s.BaseURL + "/" + key + "?" + query.Encode(),
+		Method:  http.MethodPut,
+		Headers: map[string]string{"Content-Type": contentType},
+		Expires: expiresAt,
+	}, nil
+}
+
+// Stat gets the file's size, its content type is guessed from its extension
+func (s *LocalStore) Stat(ctx context.Context, key string) (Info, error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: info.Size(), ContentType: mime.TypeByExtension(path.Ext(key))}, nil
+}
+
+// Get opens the file
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// ServeHTTP sends stored files and takes presigned uploads, directories are not listed
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodPut {
+		s.servePut(w, r)
+		return
+	}
+	s.files.ServeHTTP(w, r)
+}
+
+// servePut stores an upload if it matches what its url was signed for
+func (s *LocalStore) servePut(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, s.Path())
+	contentType := r.Header.Get("Content-Type")
+	size, sizeErr := strconv.ParseInt(r.URL.Query().Get("size"), 10, 64)
+	expires, expiresErr := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	signature := r.URL.Query().Get("signature")
+	if sizeErr != nil || expiresErr != nil || !hmac.Equal([]byte(signature), []byte(s.sign(key, contentType, size, expires))) {
+		http.Error(w, "signature does not match", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(w, "upload url expired", http.StatusForbidden)
+		return
+	}
+	if r.ContentLength != size {
+		http.Error(w, "content length does not match", http.StatusBadRequest)
+		return
+	}
+
+	// Read one byte more than signed for to tell if the body is too long
+	body := io.LimitReader(r.Body, size+1)
+	_, err := s.Put(r.Context(), key, body, contentType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info, err := s.Stat(r.Context(), key); err != nil || info.Size != size {
+		s.Delete(r.Context(), key)
+		http.Error(w, "body does not match content length", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// sign signs what an upload url allows
+func (s *LocalStore) sign(key string, contentType string, size int64, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d", key, contentType, size, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// filename is where the key is stored, keys can't reach outside of the directory
+func (s *LocalStore) filename(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,136 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Store keeps files in an S3 bucket
+type S3Store struct {
+	Bucket   string
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// NewS3Store creates a store that uploads to the bucket using the aws session
+func NewS3Store(sess *session.Session, bucket string) *S3Store {
+	return &S3Store{
+		Bucket:   bucket,
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+	}
+}
+
+// Put uploads the body to the bucket, returning the object's url
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error) {
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+	result, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.Location, nil
+}
+
+// Delete removes the object from the bucket
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// PresignPut signs a put of the object, S3 rejects the upload if its size or content type don't match
+func (s *S3Store) PresignPut(ctx context.Context, key string, contentType string, size int64, expires time.Duration) (PresignedUpload, error) {
+	if key == "" {
+		return PresignedUpload{}, ErrInvalidKey
+	}
+	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	})
+	req.SetContext(ctx)
+	signedURL, signedHeaders, err := req.PresignRequest(expires)
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+
+	headers := make(map[string]string)
+	for name, values := range signedHeaders {
+		// Clients and browsers set the host themselves
+		name = http.CanonicalHeaderKey(name)
+		if name != "Host" && len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+	return PresignedUpload{
+		URL:     signedURL,
+		Method:  http.MethodPut,
+		Headers: headers,
+		Expires: time.Now().Add(expires),
+	}, nil
+}
+
+// Stat gets the object's size and content type without downloading it
+func (s *S3Store) Stat(ctx context.Context, key string) (Info, error) {
+	if key == "" {
+		return Info{}, ErrInvalidKey
+	}
+	result, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Info{}, notFound(err)
+	}
+	return Info{
+		Size:        aws.Int64Value(result.ContentLength),
+		ContentType: aws.StringValue(result.ContentType),
+	}, nil
+}
+
+// Get downloads the object
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if key == "" {
+		return nil, ErrInvalidKey
+	}
+	result, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return result.Body, nil
+}
+
+// notFound converts S3's errors for missing objects to ErrNotFound
+func notFound(err error) error {
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return ErrNotFound
+		}
+	}
+	return err
+}
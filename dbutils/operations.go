@@ -1,6 +1,9 @@
 package dbutils
 
 import (
+	"munchserver/models"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -12,18 +15,147 @@ func SetFoodTruckOwner(userID string) bson.M {
 	return bson.M{"$set": bson.M{"owner": userID}}
 }
 
-func SetProfilePicture(pictureURL string) bson.M {
-	return bson.M{"$set": bson.M{"picture": pictureURL}}
+func SetProfilePicture(picture models.JSONImageVariants) bson.M {
+	return bson.M{"$set": bson.M{"picture": picture.Full, "pictureVariants": picture}}
+}
+
+func AddRole(role string) bson.M {
+	return bson.M{"$addToSet": bson.M{"roles": role}}
+}
+
+func PullRole(role string) bson.M {
+	return bson.M{"$pull": bson.M{"roles": role}}
 }
 
-func PushOwnedFoodTruck(foodTruckID string) bson.M {
-	return bson.M{"$push": bson.M{"ownedFoodTrucks": foodTruckID}}
+func SetReviewer(reviewerID string, reviewerName string) bson.M {
+	return bson.M{"$set": bson.M{"reviewer": reviewerID, "reviewerName": reviewerName}}
 }
 
 func PushReview(reviewID string) bson.M {
 	return bson.M{"$push": bson.M{"reviews": reviewID}}
 }
 
-func PushPhoto(photoURL string) bson.M {
-	return bson.M{"$push": bson.M{"photos": photoURL}}
+func PushPhoto(photo models.JSONPhoto) bson.M {
+	return bson.M{"$push": bson.M{"photos": photo}}
+}
+
+func SetPhotos(photos []models.JSONPhoto) bson.M {
+	return bson.M{"$set": bson.M{"photos": photos}}
+}
+
+func SetMigratedPhotos(photos []models.JSONPhoto) bson.M {
+	return bson.M{"$set": bson.M{"photos": photos}, "$unset": bson.M{"photoVariants": ""}}
+}
+
+func SetCreated(date time.Time) bson.M {
+	return bson.M{"$set": bson.M{"created": date}}
+}
+
+func AddOwnedFoodTruck(foodTruckID string) bson.M {
+	return bson.M{"$addToSet": bson.M{"ownedFoodTrucks": foodTruckID}}
+}
+
+func PullOwnedFoodTruck(foodTruckID string) bson.M {
+	return bson.M{"$pull": bson.M{"ownedFoodTrucks": foodTruckID}}
+}
+
+func SetClaimReviewed(status string, reviewerID string, reason string, date time.Time) bson.M {
+	return bson.M{"$set": bson.M{"status": status, "reviewer": reviewerID, "reason": reason, "reviewedDate": date}}
+}
+
+func SetClaimStatus(status string) bson.M {
+	return bson.M{"$set": bson.M{"status": status, "reviewer": "", "reason": ""}}
+}
+
+func SetClaimPhoneVerified() bson.M {
+	return bson.M{"$set": bson.M{"phoneVerified": true}}
+}
+
+func IncrementClaimAttempts() bson.M {
+	return bson.M{"$inc": bson.M{"attempts": 1}}
+}
+
+func UseAPIKey(date time.Time) bson.M {
+	return bson.M{"$inc": bson.M{"usageCount": 1}, "$set": bson.M{"lastUsed": date}}
+}
+
+func RevokeAPIKey(date time.Time) bson.M {
+	return bson.M{"$set": bson.M{"revoked": true, "revokedDate": date}}
+}
+
+func UseRefreshToken() bson.M {
+	return bson.M{"$set": bson.M{"used": true}}
+}
+
+func RevokeRefreshToken() bson.M {
+	return bson.M{"$set": bson.M{"revoked": true}}
+}
+
+func UseUserToken() bson.M {
+	return bson.M{"$set": bson.M{"used": true}}
+}
+
+func SetEmailVerified() bson.M {
+	return bson.M{"$set": bson.M{"emailVerified": true}}
+}
+
+func SetEmail(email string) bson.M {
+	return bson.M{"$set": bson.M{"email": email, "emailVerified": false}}
+}
+
+func SetPassword(passwordHash []byte, date time.Time) bson.M {
+	return bson.M{"$set": bson.M{"passwordHash": passwordHash, "tokensRevokedAt": date}}
+}
+
+func RecordLoginFailure(date time.Time, expires time.Time) bson.M {
+	return bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"lastFailure": date, "expires": expires}}
+}
+
+func SetLockedUntil(date time.Time) bson.M {
+	return bson.M{"$set": bson.M{"lockedUntil": date}}
+}
+
+func SetPendingTOTPSecret(secret string) bson.M {
+	return bson.M{"$set": bson.M{"totpPendingSecret": secret}}
+}
+
+func EnableTwoFactor(secret string, step int64, recoveryCodeHashes []string) bson.M {
+	return bson.M{
+		"$set":   bson.M{"twoFactorEnabled": true, "totpSecret": secret, "totpLastUsedStep": step, "recoveryCodes": recoveryCodeHashes},
+		"$unset": bson.M{"totpPendingSecret": ""},
+	}
+}
+
+func DisableTwoFactor() bson.M {
+	return bson.M{
+		"$set":   bson.M{"twoFactorEnabled": false, "totpLastUsedStep": 0},
+		"$unset": bson.M{"totpSecret": "", "totpPendingSecret": "", "recoveryCodes": ""},
+	}
+}
+
+func SetRecoveryCodes(recoveryCodeHashes []string) bson.M {
+	return bson.M{"$set": bson.M{"recoveryCodes": recoveryCodeHashes}}
+}
+
+func UseTOTPStep(step int64) bson.M {
+	return bson.M{"$set": bson.M{"totpLastUsedStep": step}}
+}
+
+func PullRecoveryCode(recoveryCodeHash string) bson.M {
+	return bson.M{"$pull": bson.M{"recoveryCodes": recoveryCodeHash}}
+}
+
+func UseSession(userID string, userAgent string, ip string, date time.Time, expires time.Time) bson.M {
+	return bson.M{
+		"$set":         bson.M{"userAgent": userAgent, "ip": ip, "lastUsed": date, "expires": expires},
+		"$setOnInsert": bson.M{"user": userID, "created": date, "revoked": false},
+	}
+}
+
+func RevokeSession() bson.M {
+	return bson.M{"$set": bson.M{"revoked": true}}
+}
+
+func PushIdentity(identity interface{}) bson.M {
+	return bson.M{"$push": bson.M{"identities": identity}}
 }
@@ -13,9 +13,20 @@ func ProfileProjection() bson.M {
 
 func UserProjection() bson.M {
 	return bson.M{
-		"passwordHash": 0,
-		"dateOfBirth":  0,
-		"phoneNumber":  0,
+		"passwordHash":     0,
+		"dateOfBirth":      0,
+		"phoneNumber":      0,
+		"roles":            0,
+		"emailVerified":    0,
+		"twoFactorEnabled": 0,
+		"identities":       0,
+	}
+}
+
+// ReviewCountFields adds how many reviews a food truck has as reviewCount
+func ReviewCountFields() bson.M {
+	return bson.M{
+		"reviewCount": bson.M{"$size": bson.M{"$ifNull": []interface{}{"$reviews", bson.A{}}}},
 	}
 }
 
@@ -1,6 +1,11 @@
 package dbutils
 
-import "go.mongodb.org/mongo-driver/bson"
+import (
+	"munchserver/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 func AllQuery() bson.M {
 	return bson.M{}
@@ -14,6 +19,149 @@ func WithIDsQuery(ids []string) bson.M {
 	return bson.M{"_id": bson.M{"$in": ids}}
 }
 
+// AfterIDQuery finds what is listed after the id when sorting by id
+func AfterIDQuery(id string) bson.M {
+	return bson.M{"_id": bson.M{"$gt": id}}
+}
+
+// AfterQuery finds what is listed after the field's value and the id when sorting by the field and then the id
+func AfterQuery(field string, value interface{}, id string) bson.M {
+	return bson.M{"$or": []bson.M{
+		{field: bson.M{"$gt": value}},
+		{field: value, "_id": bson.M{"$gt": id}},
+	}}
+}
+
+// BeforeQuery finds what is listed after the field's value and the id when sorting by the field descending and then the
+// id
+func BeforeQuery(field string, value interface{}, id string) bson.M {
+	return bson.M{"$or": []bson.M{
+		{field: bson.M{"$lt": value}},
+		{field: value, "_id": bson.M{"$gt": id}},
+	}}
+}
+
+func AndQuery(queries ...bson.M) bson.M {
+	return bson.M{"$and": queries}
+}
+
 func WithEmailQuery(email string) bson.M {
 	return bson.M{"email": email}
 }
+
+func WithIDAndEmailQuery(id string, email string) bson.M {
+	return bson.M{"_id": id, "email": email}
+}
+
+func WithIDAndOwnerQuery(id string, owner string) bson.M {
+	return bson.M{"_id": id, "owner": owner}
+}
+
+func WithIDAndPhotosQuery(id string, photos []models.JSONPhoto) bson.M {
+	return bson.M{"_id": id, "photos": photos}
+}
+
+// WithURLPhotosQuery finds food trucks with photos still kept as urls, before photos had their own fields
+func WithURLPhotosQuery() bson.M {
+	return bson.M{"photos": bson.M{"$type": "string"}}
+}
+
+func WithoutCreatedQuery() bson.M {
+	return bson.M{"created": bson.M{"$exists": false}}
+}
+
+func WithoutEmailVerifiedQuery() bson.M {
+	return bson.M{"emailVerified": bson.M{"$exists": false}}
+}
+
+func WithOwnerQuery(owner string) bson.M {
+	return bson.M{"owner": owner}
+}
+
+func WithFoodTruckQuery(foodTruckID string) bson.M {
+	return bson.M{"foodTruck": foodTruckID}
+}
+
+func WithReviewerQuery(reviewer string) bson.M {
+	return bson.M{"reviewer": reviewer}
+}
+
+func WithUserAndStatusQuery(userID string, status string) bson.M {
+	return bson.M{"user": userID, "status": status}
+}
+
+func WithIDAndStatusQuery(id string, status string) bson.M {
+	return bson.M{"_id": id, "status": status}
+}
+
+func WithStatusQuery(status string) bson.M {
+	return bson.M{"status": status}
+}
+
+func ClaimOfUserQuery(foodTruckID string, userID string, status string) bson.M {
+	return bson.M{"foodTruck": foodTruckID, "user": userID, "status": status}
+}
+
+func OtherClaimsQuery(foodTruckID string, claimID string, status string) bson.M {
+	return bson.M{"foodTruck": foodTruckID, "_id": bson.M{"$ne": claimID}, "status": status}
+}
+
+func ClaimAttemptQuery(id string, userID string, status string, maxAttempts int) bson.M {
+	return bson.M{"_id": id, "user": userID, "status": status, "attempts": bson.M{"$lt": maxAttempts}}
+}
+
+func WithIDAndNoOwnedFoodTrucksQuery(id string) bson.M {
+	return bson.M{"_id": id, "ownedFoodTrucks": bson.M{"$size": 0}}
+}
+
+func ActiveAPIKeyQuery(hash string) bson.M {
+	return bson.M{"hash": hash, "revoked": false}
+}
+
+func UsableRefreshTokenQuery(id string, now time.Time) bson.M {
+	return bson.M{"_id": id, "used": false, "revoked": false, "expires": bson.M{"$gt": now}}
+}
+
+func WithFamilyQuery(family string) bson.M {
+	return bson.M{"family": family}
+}
+
+func WithUserQuery(userID string) bson.M {
+	return bson.M{"user": userID}
+}
+
+func UsableUserTokenQuery(id string, purpose string, now time.Time) bson.M {
+	return bson.M{"_id": id, "purpose": purpose, "used": false, "expires": bson.M{"$gt": now}}
+}
+
+func UnusedUserTokensQuery(userID string, purpose string) bson.M {
+	return bson.M{"user": userID, "purpose": purpose, "used": false}
+}
+
+func UnusedTOTPStepQuery(id string, step int64) bson.M {
+	return bson.M{"_id": id, "twoFactorEnabled": true, "totpLastUsedStep": bson.M{"$lt": step}}
+}
+
+func WithIDAndRecoveryCodeQuery(id string, recoveryCodeHash string) bson.M {
+	return bson.M{"_id": id, "twoFactorEnabled": true, "recoveryCodes": recoveryCodeHash}
+}
+
+func ActiveSessionsQuery(userID string, now time.Time) bson.M {
+	return bson.M{"user": userID, "revoked": false, "expires": bson.M{"$gt": now}}
+}
+
+func RevokedSessionQuery(id string) bson.M {
+	return bson.M{"_id": id, "revoked": true}
+}
+
+func WithIDAndUserQuery(id string, userID string) bson.M {
+	return bson.M{"_id": id, "user": userID}
+}
+
+func OtherSessionsQuery(userID string, sessionID string) bson.M {
+	return bson.M{"user": userID, "_id": bson.M{"$ne": sessionID}}
+}
+
+func WithIdentityQuery(provider string, subject string) bson.M {
+	return bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+}
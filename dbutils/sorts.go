@@ -0,0 +1,32 @@
+package dbutils
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sorts of listed pages end with the id, so ties are always in the same order and cursors can pick up after them
+
+func ByIDSort() bson.D {
+	return bson.D{{"_id", 1}}
+}
+
+// ByFieldSort sorts by the field in the order, 1 for smallest first and -1 for biggest first
+func ByFieldSort(field string, order int) bson.D {
+	if field == "_id" {
+		return ByIDSort()
+	}
+	return bson.D{{field, order}, {"_id", 1}}
+}
+
+func NewestSort() bson.D {
+	return bson.D{{"date", -1}, {"_id", 1}}
+}
+
+func OptionsWithSortAndLimit(sort bson.D, limit int) *options.FindOptions {
+	return options.Find().SetSort(sort).SetLimit(int64(limit))
+}
+
+func OptionsWithSort(sort bson.D) *options.FindOptions {
+	return options.Find().SetSort(sort)
+}
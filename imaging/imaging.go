@@ -0,0 +1,208 @@
+// Package imaging checks uploaded photos and makes the resized copies of them that are served. Photos are decoded and
+// encoded again, so EXIF metadata like the GPS location where a photo was taken is never kept.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+
+	// Register the WebP decoder, JPEG and PNG are registered by their encoders' packages
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupportedFormat is returned when a photo isn't a JPEG, PNG or WebP image
+	ErrUnsupportedFormat = errors.New("imaging: unsupported format")
+	// ErrInvalidImage is returned when a photo can't be decoded
+	ErrInvalidImage = errors.New("imaging: invalid image")
+	// ErrTooLarge is returned when a photo has more pixels than MaxPixels
+	ErrTooLarge = errors.New("imaging: image too large")
+)
+
+// MaxPixels is the most pixels a photo can have, checked before it is decoded. A photo this size already decodes to
+// 64MB, and is still twice as wide as the largest variant.
+const MaxPixels = 4096 * 4096
+
+// maxDecodes is the most photos decoded at once, so uploads at the same time can't use up the server's memory
+const maxDecodes = 4
+
+// decodes has a slot taken for every photo being decoded
+var decodes = make(chan struct{}, maxDecodes)
+
+// maxHeaderSize is the most bytes read from a photo to find its size and orientation before it is decoded
+const maxHeaderSize = 1024000
+
+// jpegQuality is the quality resized photos are encoded with
+const jpegQuality = 85
+
+// Content types photos can be uploaded as
+const (
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+	ContentTypeWebP = "image/webp"
+)
+
+// Variant is a size photos are resized to fit in
+type Variant struct {
+	Name string
+	// MaxSize is the most pixels wide or tall the resized photo can be, smaller photos aren't made bigger
+	MaxSize int
+}
+
+// Variant names
+const (
+	VariantThumbnail = "thumbnail"
+	VariantCard      = "card"
+	VariantFull      = "full"
+)
+
+// Variants are the sizes every uploaded photo is resized to
+var Variants = []Variant{
+	{Name: VariantThumbnail, MaxSize: 200},
+	{Name: VariantCard, MaxSize: 640},
+	{Name: VariantFull, MaxSize: 1920},
+}
+
+// Resized is a photo resized to a variant and encoded
+type Resized struct {
+	Variant string
+	Width   int
+	Height  int
+	Data    []byte
+}
+
+// Processed is an uploaded photo resized to every variant
+type Processed struct {
+	// ContentType and Extension are how the variants are encoded, PNG for transparent photos and JPEG otherwise
+	ContentType string
+	Extension   string
+	Variants    []Resized
+}
+
+// Sniff returns the content type of a photo from its first bytes
+func Sniff(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		return ContentTypeJPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1A\n")):
+		return ContentTypePNG, nil
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return ContentTypeWebP, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// headerBuffer keeps the bytes read from a photo before it is decoded, so they can be read again to decode it
+type headerBuffer struct {
+	bytes.Buffer
+}
+
+// Write fails once more than maxHeaderSize bytes were read, so the header of a photo can't be made huge
+func (b *headerBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxHeaderSize {
+		return 0, ErrInvalidImage
+	}
+	return b.Buffer.Write(p)
+}
+
+// Process checks that a photo is a valid JPEG, PNG or WebP image and resizes it to every variant. The photo is decoded
+// as it is read, so only its header is kept in memory and not the whole file.
+func Process(r io.Reader) (Processed, error) {
+	// Check the size before decoding, so a small file can't make a huge image
+	var header headerBuffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	contentType, sniffErr := Sniff(header.Bytes())
+	if sniffErr != nil {
+		return Processed{}, sniffErr
+	}
+	if err != nil {
+		return Processed{}, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return Processed{}, ErrInvalidImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return Processed{}, ErrTooLarge
+	}
+
+	// Wait for a slot to decode in, which is held until every variant is made from the decoded photo
+	decodes <- struct{}{}
+	defer func() { <-decodes }()
+	img, _, err := image.Decode(io.MultiReader(bytes.NewReader(header.Bytes()), r))
+	if err != nil {
+		return Processed{}, ErrInvalidImage
+	}
+
+	// Turn JPEGs the way the camera says they were held, since the metadata saying so isn't kept
+	if contentType == ContentTypeJPEG {
+		img = orient(img, jpegOrientation(header.Bytes()))
+	}
+
+	processed := Processed{ContentType: ContentTypeJPEG, Extension: ".jpg"}
+	if !isOpaque(img) {
+		processed.ContentType = ContentTypePNG
+		processed.Extension = ".png"
+	}
+
+	for _, variant := range Variants {
+		resized := resize(img, variant.MaxSize)
+
+		var buffer bytes.Buffer
+		if processed.ContentType == ContentTypePNG {
+			err = png.Encode(&buffer, resized)
+		} else {
+			err = jpeg.Encode(&buffer, resized, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return Processed{}, err
+		}
+
+		processed.Variants = append(processed.Variants, Resized{
+			Variant: variant.Name,
+			Width:   resized.Bounds().Dx(),
+			Height:  resized.Bounds().Dy(),
+			Data:    buffer.Bytes(),
+		})
+	}
+	return processed, nil
+}
+
+// resize scales an image down to fit in a square of maxSize pixels, keeping its aspect ratio
+func resize(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			height = max(1, height*maxSize/width)
+			width = maxSize
+		} else {
+			width = max(1, width*maxSize/height)
+			height = maxSize
+		}
+	}
+
+	resized := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+	return resized
+}
+
+// isOpaque reports whether an image has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes emails to a directory instead of sending them, for local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// NewFileMailer creates a mailer that writes to dir, creating it if needed
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMailer{
+		Dir:  dir,
+		From: from,
+	}, nil
+}
+
+// Send writes the message to a .eml file named after the time it was sent
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	filename := fmt.Sprintf("%v.eml", time.Now().UnixNano())
+	return ioutil.WriteFile(filepath.Join(m.Dir, filename), formatMessage(m.From, message), 0644)
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryMailer keeps sent emails in memory so tests can read them
+type MemoryMailer struct {
+	lock     sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer creates a mailer with no sent emails
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send stores the message
+func (m *MemoryMailer) Send(ctx context.Context, message Message) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages gets every email sent to the address, oldest first
+func (m *MemoryMailer) Messages(to string) []Message {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var messages []Message
+	for _, message := range m.messages {
+		if message.To == to {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// Clear removes all sent emails
+func (m *MemoryMailer) Clear() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = nil
+}
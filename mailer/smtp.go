@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailer creates a mailer that authenticates with the SMTP server if a username is given
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+// Send sends the message, smtp.SendMail can't be cancelled so the context is only checked before sending
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// The envelope sender has to be a bare address, without a display name
+	envelopeFrom := m.From
+	fromAddress, err := mail.ParseAddress(m.From)
+	if err == nil {
+		envelopeFrom = fromAddress.Address
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, envelopeFrom, []string{message.To}, formatMessage(m.From, message))
+}
+
+// formatMessage formats the message as a plain text email
+func formatMessage(from string, message Message) []byte {
+	// Strip newlines from headers so they can't be used to inject other headers
+	headerReplacer := strings.NewReplacer("\r", "", "\n", "")
+
+	var email strings.Builder
+	fmt.Fprintf(&email, "From: %v\r\n", headerReplacer.Replace(from))
+	fmt.Fprintf(&email, "To: %v\r\n", headerReplacer.Replace(message.To))
+	fmt.Fprintf(&email, "Subject: %v\r\n", headerReplacer.Replace(message.Subject))
+	email.WriteString("MIME-Version: 1.0\r\n")
+	email.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	email.WriteString("\r\n")
+	email.WriteString(message.Body)
+	return []byte(email.String())
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// APIKeyKey is the key in request context of the api key's id
+const APIKeyKey key = "apiKey"
+
+// ScopesKey is the key in request context of the api key's scopes
+const ScopesKey key = "scopes"
+
+// APIKeyValidator looks up an api key, returning its id and scopes, or an error if the key isn't valid
+type APIKeyValidator func(ctx context.Context, apiKey string) (string, []string, error)
+
+// AuthenticateAPIKey creates a middleware which adds the id and scopes of the api key in the X-API-Key header to the context of the request
+func AuthenticateAPIKey(validate APIKeyValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			// Get api key from header
+			apiKey := r.Header.Get("X-API-Key")
+			if apiKey != "" {
+				// Reject requests with an invalid or revoked key
+				apiKeyID, scopes, err := validate(ctx, apiKey)
+				if err != nil {
+					WriteError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "API key is not valid")
+					return
+				}
+				ctx = context.WithValue(ctx, APIKeyKey, apiKeyID)
+				ctx = context.WithValue(ctx, ScopesKey, scopes)
+			}
+
+			// Go to next handler with new context
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// HasScope checks if the request was authenticated with an api key that has the scope
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, _ := ctx.Value(ScopesKey).([]string)
+	for _, apiKeyScope := range scopes {
+		if apiKeyScope == scope {
+			return true
+		}
+	}
+	return false
+}
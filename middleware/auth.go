@@ -14,27 +14,85 @@ type key string
 // UserKey is the key in request context of user's uuid
 const UserKey key = "user"
 
-// AuthenticateUser is a middleware which adds the authenticated user's uuid to the context of the request
-func AuthenticateUser(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-
-		// Get auth information from header
-		auth := strings.Split(r.Header.Get("Authorization"), " ")
-		if len(auth) == 2 && auth[0] == "Bearer" {
-			tokenString := auth[1]
-
-			// Get claims from jwt
-			var claims jwt.StandardClaims
-			_, err := jwt.ParseWithClaims(tokenString, &claims, secrets.GetJWTSecret)
-
-			// If the token is still valid, add user to context
-			if err == nil && claims.Valid() == nil {
-				ctx = context.WithValue(r.Context(), UserKey, claims.Subject)
+// RolesKey is the key in request context of user's roles
+const RolesKey key = "roles"
+
+// ClaimsKey is the key in request context of the claims of the user's access token
+const ClaimsKey key = "claims"
+
+// Claims are the claims in the access token given to a user when they log in
+type Claims struct {
+	jwt.StandardClaims
+	Roles []string `json:"roles,omitempty"`
+	// SessionID is the session the token was issued for, so revoking the session also revokes the token
+	SessionID string `json:"sid,omitempty"`
+	// AuthTime is when the user last logged in, refreshed tokens keep the time of the login they came from
+	AuthTime int64 `json:"auth_time,omitempty"`
+}
+
+// TokenValidator checks an access token against server side state, like whether it has been revoked
+type TokenValidator func(ctx context.Context, claims *Claims) error
+
+// AuthenticateUser creates a middleware which adds the authenticated user's uuid and roles to the context of the request
+func AuthenticateUser(validate TokenValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			// Get auth information from header
+			auth := strings.Split(r.Header.Get("Authorization"), " ")
+			if len(auth) == 2 && auth[0] == "Bearer" {
+				tokenString := auth[1]
+
+				// Get claims from jwt
+				var claims Claims
+				_, err := jwt.ParseWithClaims(tokenString, &claims, secrets.GetJWTSecret)
+
+				// If the token is still valid and hasn't been revoked, add user to context
+				if err == nil && claims.Valid() == nil && validate(ctx, &claims) == nil {
+					ctx = context.WithValue(ctx, UserKey, claims.Subject)
+					ctx = context.WithValue(ctx, RolesKey, claims.Roles)
+					ctx = context.WithValue(ctx, ClaimsKey, claims)
+				}
+			}
+
+			// Go to next handler with new context
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// HasRole checks if the authenticated user has any of the roles
+func HasRole(ctx context.Context, roles ...string) bool {
+	userRoles, _ := ctx.Value(RolesKey).([]string)
+	for _, userRole := range userRoles {
+		for _, role := range roles {
+			if userRole == role {
+				return true
 			}
 		}
+	}
+	return false
+}
+
+// RequireRoles is a middleware which only lets through authenticated users with any of the roles
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Check for a user
+			_, userLoggedIn := r.Context().Value(UserKey).(string)
+			if !userLoggedIn {
+				WriteError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "Log in to continue")
+				return
+			}
+
+			// Check the user has one of the roles
+			if !HasRole(r.Context(), roles...) {
+				WriteError(w, r, http.StatusForbidden, ErrCodeForbidden, "You don't have permission to do this")
+				return
+			}
 
-		// Go to next handler with new context
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes of the errors middleware responds with
+const (
+	ErrCodeUnauthorized = "unauthorized"
+	ErrCodeForbidden    = "forbidden"
+)
+
+// ErrorDetail explains what is wrong with one field of a request
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// ErrorBody is the error in an error response
+type ErrorBody struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"requestId"`
+}
+
+// ErrorResponse is the body of every error response, from middleware and handlers alike
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// WriteError responds with the status and an error envelope
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code string, message string, details ...ErrorDetail) {
+	// Requests that didn't go through the request id middleware still get an id to report
+	requestID := GetRequestID(r.Context())
+	if requestID == "" {
+		requestID = NewRequestID()
+		w.Header().Set("X-Request-ID", requestID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: ErrorBody{
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: requestID,
+		},
+	})
+}
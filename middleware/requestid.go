@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDKey is the key in request context of the request's id
+const RequestIDKey key = "requestID"
+
+// requestIDRegexp matches request ids from clients or proxies that are safe to echo back and log
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID is a middleware which gives each request an id, so errors clients see can be found in the logs. The id
+// from the X-Request-ID header is kept if it has one, otherwise a new one is generated, and it is sent back in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDRegexp.MatchString(requestID) {
+			requestID = NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		// Go to next handler with new context
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RequestIDKey, requestID)))
+	})
+}
+
+// NewRequestID generates a random request id
+func NewRequestID() string {
+	requestID, err := uuid.NewRandom()
+	if err != nil {
+		return "unknown"
+	}
+	return requestID.String()
+}
+
+// GetRequestID gets the id of the request, or an empty string if it doesn't have one
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(RequestIDKey).(string)
+	return requestID
+}
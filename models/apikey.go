@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// API key scopes
+const (
+	ScopeTrucksWrite  = "trucks:write"
+	ScopeReviewsWrite = "reviews:write"
+)
+
+// APIKeyScopes are all the scopes an api key can be given
+var APIKeyScopes = []string{ScopeTrucksWrite, ScopeReviewsWrite}
+
+// JSONAPIKey is a key used by services like the scraper to call the api, only a hash of the key is stored
+type JSONAPIKey struct {
+	ID          string    `json:"id" bson:"_id"`
+	Name        string    `json:"name" bson:"name"`
+	Prefix      string    `json:"prefix" bson:"prefix"`
+	Hash        string    `json:"-" bson:"hash"`
+	Scopes      []string  `json:"scopes" bson:"scopes"`
+	CreatedBy   string    `json:"createdBy" bson:"createdBy"`
+	Created     time.Time `json:"created" bson:"created"`
+	Revoked     bool      `json:"revoked" bson:"revoked"`
+	RevokedDate time.Time `json:"revokedDate" bson:"revokedDate"`
+	UsageCount  int64     `json:"usageCount" bson:"usageCount"`
+	LastUsed    time.Time `json:"lastUsed" bson:"lastUsed"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// Claim statuses
+const (
+	ClaimPending  = "pending"
+	ClaimApproved = "approved"
+	ClaimRejected = "rejected"
+)
+
+// MaxClaimAttempts is the number of times a user can try to enter the callback code of a claim
+const MaxClaimAttempts = 5
+
+// JSONClaim is a request from a user to become the owner of a food truck
+type JSONClaim struct {
+	ID              string    `json:"id" bson:"_id"`
+	FoodTruck       string    `json:"foodTruck" bson:"foodTruck"`
+	User            string    `json:"user" bson:"user"`
+	Status          string    `json:"status" bson:"status"`
+	BusinessLicense string    `json:"businessLicense" bson:"businessLicense"`
+	PhoneNumber     string    `json:"phoneNumber" bson:"phoneNumber"`
+	CallbackCode    string    `json:"-" bson:"callbackCode"`
+	PhoneVerified   bool      `json:"phoneVerified" bson:"phoneVerified"`
+	Attempts        int       `json:"-" bson:"attempts"`
+	Date            time.Time `json:"date" bson:"date"`
+	Reviewer        string    `json:"reviewer" bson:"reviewer"`
+	ReviewedDate    time.Time `json:"reviewedDate" bson:"reviewedDate"`
+	Reason          string    `json:"reason" bson:"reason"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // JSONFoodTruck is a JSON encodeable version of FoodTruck
 type JSONFoodTruck struct {
 	ID          string       `json:"id" bson:"_id"`
@@ -11,9 +13,10 @@ type JSONFoodTruck struct {
 	AvgRating   float64      `json:"avgRating" bson:"avgRating"`
 	Hours       [7][2]string `json:"hours" bson:"hours"`
 	Reviews     []string     `json:"reviews" bson:"reviews"`
-	Photos      []string     `json:"photos" bson:"photos"`
+	Photos      []JSONPhoto  `json:"photos" bson:"photos"`
 	Website     string       `json:"website" bson:"website"`
 	PhoneNumber string       `json:"phoneNumber" bson:"phoneNumber"`
 	Description string       `json:"description" bson:"description"`
 	Tags        []string     `json:"tags" bson:"tags"`
+	Created     time.Time    `json:"created" bson:"created"`
 }
@@ -0,0 +1,8 @@
+package models
+
+// JSONImageVariants are the urls of the sizes an uploaded image was resized to
+type JSONImageVariants struct {
+	Thumbnail string `json:"thumbnail" bson:"thumbnail"`
+	Card      string `json:"card" bson:"card"`
+	Full      string `json:"full" bson:"full"`
+}
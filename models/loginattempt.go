@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// JSONLoginAttempt counts failed logins for an email or client ip, its id is prefixed with what it counts
+type JSONLoginAttempt struct {
+	ID          string    `json:"id" bson:"_id"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LastFailure time.Time `json:"lastFailure" bson:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil" bson:"lockedUntil"`
+	Expires     time.Time `json:"expires" bson:"expires"`
+}
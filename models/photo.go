@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// JSONPhoto is a photo of a food truck, food trucks keep their photos in the order they are shown
+type JSONPhoto struct {
+	ID  string `json:"id" bson:"id"`
+	URL string `json:"url" bson:"url"`
+	// Variants are the resized copies of an uploaded photo, empty for photos added by url
+	Variants JSONImageVariants `json:"variants" bson:"variants"`
+	// BlobKeys are where an uploaded photo is kept in the blob store, so it can be deleted with the photo
+	BlobKeys []string  `json:"-" bson:"blobKeys"`
+	Uploader string    `json:"uploader" bson:"uploader"`
+	Caption  string    `json:"caption" bson:"caption"`
+	Created  time.Time `json:"created" bson:"created"`
+	// Cover is set on the one photo shown first for the food truck
+	Cover bool `json:"cover" bson:"cover"`
+	Order int  `json:"order" bson:"order"`
+}
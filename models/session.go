@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// JSONSession is a device the user is logged in on, its id is the family of its refresh tokens
+type JSONSession struct {
+	ID        string    `json:"id" bson:"_id"`
+	User      string    `json:"user" bson:"user"`
+	UserAgent string    `json:"userAgent" bson:"userAgent"`
+	IP        string    `json:"ip" bson:"ip"`
+	Created   time.Time `json:"created" bson:"created"`
+	LastUsed  time.Time `json:"lastUsed" bson:"lastUsed"`
+	Expires   time.Time `json:"expires" bson:"expires"`
+	Revoked   bool      `json:"revoked" bson:"revoked"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// JSONRefreshToken is a single use token for getting a new access token, only a hash of the token is stored
+type JSONRefreshToken struct {
+	ID      string    `json:"id" bson:"_id"`
+	Family  string    `json:"family" bson:"family"`
+	User    string    `json:"user" bson:"user"`
+	Created time.Time `json:"created" bson:"created"`
+	Expires time.Time `json:"expires" bson:"expires"`
+	// AuthTime is when the user logged in to start the family, passed on to every token refreshed from it
+	AuthTime time.Time `json:"authTime" bson:"authTime"`
+	Used     bool      `json:"used" bson:"used"`
+	Revoked  bool      `json:"revoked" bson:"revoked"`
+}
+
+// JSONRevokedToken is the id of an access token that can no longer be used, kept until the token would have expired
+type JSONRevokedToken struct {
+	ID      string    `json:"id" bson:"_id"`
+	Expires time.Time `json:"expires" bson:"expires"`
+}
+
+// User token purposes
+const (
+	// TokenPurposePasswordReset is for tokens emailed to reset a forgotten password
+	TokenPurposePasswordReset = "passwordReset"
+	// TokenPurposeEmailVerification is for tokens emailed to prove the user owns their email
+	TokenPurposeEmailVerification = "emailVerification"
+)
+
+// JSONUserToken is a single use token emailed to a user, only a hash of the token is stored
+type JSONUserToken struct {
+	ID      string `json:"id" bson:"_id"`
+	User    string `json:"user" bson:"user"`
+	Purpose string `json:"purpose" bson:"purpose"`
+	// Email is the address being verified, so the token stops working if the email changes
+	Email   string    `json:"email,omitempty" bson:"email,omitempty"`
+	Created time.Time `json:"created" bson:"created"`
+	Expires time.Time `json:"expires" bson:"expires"`
+	Used    bool      `json:"used" bson:"used"`
+}
@@ -5,17 +5,49 @@ import (
 )
 
 type JSONUser struct {
-	ID              string    `json:"id" bson:"_id"`
-	PasswordHash    []byte    `json:"passwordHash" bson:"passwordHash"`
-	NameFirst       string    `json:"firstName" bson:"firstName"`
-	NameLast        string    `json:"lastName" bson:"lastName"`
-	Email           string    `json:"email" bson:"email"`
-	Picture         string    `json:"picture" bson:"picture"`
-	PhoneNumber     string    `json:"phoneNumber" bson:"phoneNumber"`
-	City            string    `json:"city" bson:"city"`
-	State           string    `json:"state" bson:"state"`
-	DateOfBirth     time.Time `json:"dateOfBirth" bson:"dateOfBirth"`
-	Favorites       []string  `json:"favorites" bson:"favorites"`
-	Reviews         []string  `json:"reviews" bson:"reviews"`
-	OwnedFoodTrucks []string  `json:"ownedFoodTrucks" bson:"ownedFoodTrucks"`
+	ID            string `json:"id" bson:"_id"`
+	PasswordHash  []byte `json:"passwordHash" bson:"passwordHash"`
+	NameFirst     string `json:"firstName" bson:"firstName"`
+	NameLast      string `json:"lastName" bson:"lastName"`
+	Email         string `json:"email" bson:"email"`
+	EmailVerified bool   `json:"emailVerified" bson:"emailVerified"`
+	Picture       string `json:"picture" bson:"picture"`
+	// PictureVariants are the resized copies of an uploaded picture, empty if it came from somewhere else
+	PictureVariants JSONImageVariants `json:"pictureVariants" bson:"pictureVariants"`
+	PhoneNumber     string            `json:"phoneNumber" bson:"phoneNumber"`
+	City            string            `json:"city" bson:"city"`
+	State           string            `json:"state" bson:"state"`
+	DateOfBirth     time.Time         `json:"dateOfBirth" bson:"dateOfBirth"`
+	Favorites       []string          `json:"favorites" bson:"favorites"`
+	Reviews         []string          `json:"reviews" bson:"reviews"`
+	OwnedFoodTrucks []string          `json:"ownedFoodTrucks" bson:"ownedFoodTrucks"`
+	Roles           []string          `json:"roles" bson:"roles"`
+	// Identities are the OpenID Connect accounts linked to the user
+	Identities []JSONIdentity `json:"identities" bson:"identities"`
+	// Two factor authentication, the secrets are never sent to clients
+	TwoFactorEnabled  bool     `json:"twoFactorEnabled" bson:"twoFactorEnabled"`
+	TOTPSecret        string   `json:"-" bson:"totpSecret,omitempty"`
+	TOTPPendingSecret string   `json:"-" bson:"totpPendingSecret,omitempty"`
+	TOTPLastUsedStep  int64    `json:"-" bson:"totpLastUsedStep"`
+	RecoveryCodes     []string `json:"-" bson:"recoveryCodes,omitempty"`
+	// TokensRevokedAt is when the user's password last changed, access tokens issued before it are rejected
+	TokensRevokedAt time.Time `json:"-" bson:"tokensRevokedAt"`
+}
+
+// User roles
+const (
+	// RoleAdmin is given to users that can moderate any food truck and review claims
+	RoleAdmin = "admin"
+	// RoleOwner is given to users that own at least one food truck
+	RoleOwner = "owner"
+	// RoleScraper is given to accounts that import food trucks and reviews from other sites
+	RoleScraper = "scraper"
+)
+
+// JSONIdentity is an account with an OpenID Connect provider that the user can log in with
+type JSONIdentity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"subject" bson:"subject"`
+	Email    string    `json:"email" bson:"email"`
+	Linked   time.Time `json:"linked" bson:"linked"`
 }
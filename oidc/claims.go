@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// leeway allows for clock drift between us and the provider
+const leeway = time.Minute
+
+// Audience is the aud claim, which providers send as either a string or an array
+type Audience []string
+
+// UnmarshalJSON accepts a single audience or an array of them
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	err := json.Unmarshal(data, &multiple)
+	*a = multiple
+	return err
+}
+
+// Contains checks if the audience includes the client
+func (a Audience) Contains(clientID string) bool {
+	for _, audience := range a {
+		if audience == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// Bool is a boolean claim that some providers, like Apple, send as a string
+type Bool bool
+
+// UnmarshalJSON accepts true, false, "true" or "false"
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var value bool
+	if json.Unmarshal(data, &value) == nil {
+		*b = Bool(value)
+		return nil
+	}
+	var stringValue string
+	err := json.Unmarshal(data, &stringValue)
+	if err != nil {
+		return err
+	}
+	*b = Bool(stringValue == "true")
+	return nil
+}
+
+// IDTokenClaims are the claims we use from an ID token
+type IDTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      Audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified Bool     `json:"email_verified,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	GivenName     string   `json:"given_name,omitempty"`
+	FamilyName    string   `json:"family_name,omitempty"`
+	Picture       string   `json:"picture,omitempty"`
+}
+
+// Valid checks the ID token hasn't expired, the issuer and audience are checked by the provider
+func (c IDTokenClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return errors.New("id token is expired")
+	}
+	if c.IssuedAt != 0 && now.Before(time.Unix(c.IssuedAt, 0).Add(-leeway)) {
+		return errors.New("id token used before issued")
+	}
+	return nil
+}
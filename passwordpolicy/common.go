@@ -0,0 +1,31 @@
+package passwordpolicy
+
+// commonPasswords are some of the most used passwords from public breach lists, they are the first ones guessed
+var commonPasswords = []string{
+	"000000", "111111", "112233", "121212", "123123", "123321", "1234", "12345", "123456", "1234567",
+	"12345678", "123456789", "1234567890", "123qwe", "147258369", "159753", "1q2w3e", "1q2w3e4r", "1q2w3e4r5t", "1qaz2wsx",
+	"654321", "666666", "696969", "7777777", "888888", "987654321", "aa123456", "abc123", "abcd1234", "access",
+	"admin", "admin123", "administrator", "amanda", "andrew", "angel", "anthony", "apple", "asdf", "asdf1234",
+	"asdfasdf", "asdfgh", "asdfghjkl", "ashley", "austin", "azerty", "babygirl", "bailey", "banana", "baseball",
+	"basketball", "batman", "biteme", "blink182", "buster", "butterfly", "charlie", "cheese", "chelsea", "chicken",
+	"chocolate", "computer", "cookie", "corvette", "cowboys", "daniel", "dallas", "default", "dragon", "dubsmash",
+	"eagles", "football", "freedom", "friends", "fuckyou", "ginger", "hannah", "harley", "hello", "hello123",
+	"hockey", "hunter", "hunter2", "iloveyou", "internet", "jennifer", "jessica", "jordan", "jordan23", "joshua",
+	"justin", "killer", "letmein", "liverpool", "login", "lovely", "loveme", "maggie", "master", "matrix",
+	"matthew", "merlin", "michael", "michelle", "monkey", "mustang", "nicole", "ninja", "passw0rd", "password",
+	"password1", "password12", "password123", "pepper", "princess", "purple", "qazwsx", "qwe123", "qwer1234", "qwerty",
+	"qwerty123", "qwertyuiop", "ranger", "robert", "rockyou", "secret", "shadow", "soccer", "starwars", "summer",
+	"sunshine", "superman", "taylor", "tequiero", "thomas", "tigger", "trustno1", "welcome", "whatever", "winter",
+	"yankees", "zaq12wsx", "zxcvbn", "zxcvbnm", "munch", "munchapp", "foodtruck", "foodtrucks", "changeme", "qwertyui",
+	"mypassword", "passpass", "letmein1", "welcome1", "iloveyou1", "princess1", "football1", "baseball1", "monkey1", "dragon1",
+	"sunshine1", "master1", "shadow1", "superman1", "michael1", "jordan1", "jennifer1", "hunter1", "soccer1", "charlie1",
+}
+
+// commonPasswordSet has the common passwords for quick lookups
+var commonPasswordSet = func() map[string]struct{} {
+	set := make(map[string]struct{}, len(commonPasswords))
+	for _, password := range commonPasswords {
+		set[password] = struct{}{}
+	}
+	return set
+}()
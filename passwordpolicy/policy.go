@@ -0,0 +1,146 @@
+// Package passwordpolicy checks that passwords are hard enough to guess
+package passwordpolicy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Rules a password can fail
+const (
+	// RuleMinLength is failed by passwords shorter than the minimum length
+	RuleMinLength = "minLength"
+	// RuleEntropy is failed by passwords that are too predictable, like "aaaaaaaa" or "abcd1234"
+	RuleEntropy = "entropy"
+	// RuleCommon is failed by passwords on the common passwords list
+	RuleCommon = "common"
+	// RuleEmail is failed by passwords that are the user's email
+	RuleEmail = "email"
+)
+
+// Policy is what a password must meet to be used
+type Policy struct {
+	// MinLength is the fewest characters a password can have
+	MinLength int
+	// MinEntropy is the fewest bits of estimated entropy a password can have
+	MinEntropy float64
+}
+
+// DefaultPolicy is used when no policy is configured
+var DefaultPolicy = Policy{
+	MinLength:  8,
+	MinEntropy: 36,
+}
+
+// Violation is a rule a password failed
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Check finds all of the rules the password fails for the user with the email, it is empty if the password is allowed
+func (p Policy) Check(password string, email string) []Violation {
+	violations := []Violation{}
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %v characters", p.MinLength),
+		})
+	}
+	if Entropy(password) < p.MinEntropy {
+		violations = append(violations, Violation{
+			Rule:    RuleEntropy,
+			Message: "Password is too predictable, try a longer password or mixing in other kinds of characters",
+		})
+	}
+	if isCommon(password) {
+		violations = append(violations, Violation{
+			Rule:    RuleCommon,
+			Message: "Password is too common",
+		})
+	}
+	if isEmail(password, email) {
+		violations = append(violations, Violation{
+			Rule:    RuleEmail,
+			Message: "Password must not be your email",
+		})
+	}
+	return violations
+}
+
+// Entropy estimates the bits of entropy in a password from the kinds of characters in it. Characters that repeat or
+// continue a sequence from the one before, like the second "a" in "aa" or the "c" in "abc", add no entropy.
+func Entropy(password string) float64 {
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	characters := 0
+	var previous rune
+	var previousStep rune
+	for i, c := range []rune(password) {
+		switch {
+		case c >= 'a' && c <= 'z':
+			hasLower = true
+		case c >= 'A' && c <= 'Z':
+			hasUpper = true
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c < unicode.MaxASCII && unicode.IsPrint(c):
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+
+		step := c - previous
+		predictable := i > 0 && (step == 0 || (step == previousStep && (step == 1 || step == -1)))
+		if !predictable {
+			characters++
+		}
+		previous = c
+		previousStep = step
+	}
+
+	pool := 0
+	if hasLower {
+		pool += 26
+	}
+	if hasUpper {
+		pool += 26
+	}
+	if hasDigit {
+		pool += 10
+	}
+	if hasSymbol {
+		pool += 33
+	}
+	if hasOther {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(characters) * math.Log2(float64(pool))
+}
+
+// isCommon checks if the password is a common password, ignoring case and digits or symbols tacked on the end
+func isCommon(password string) bool {
+	lowered := strings.ToLower(password)
+	trimmed := strings.TrimRightFunc(lowered, func(c rune) bool {
+		return !unicode.IsLetter(c)
+	})
+	_, common := commonPasswordSet[lowered]
+	if !common && trimmed != "" {
+		_, common = commonPasswordSet[trimmed]
+	}
+	return common
+}
+
+// isEmail checks if the password is the email or the part of it before the @
+func isEmail(password string, email string) bool {
+	if email == "" {
+		return false
+	}
+	lowered := strings.ToLower(password)
+	email = strings.ToLower(email)
+	return lowered == email || lowered == strings.SplitN(email, "@", 2)[0]
+}
@@ -0,0 +1,227 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"net/http"
+	"path"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// deletedReviewerName replaces the name on reviews written by deleted users
+const deletedReviewerName = "Former Munch user"
+
+// recentLoginWindow is how long after logging in users without a password or two factor authentication can delete
+// their account
+const recentLoginWindow = 5 * time.Minute
+
+// deleteAccountRequest needs the password of users who have one. Users who only log in with a provider instead send a
+// two factor code if they have turned it on, or have to have just logged in.
+type deleteAccountRequest struct {
+	Password *string `json:"password"`
+	Code     *string `json:"code"`
+}
+
+type accountExport struct {
+	User            models.JSONUser        `json:"user"`
+	Reviews         []models.JSONReview    `json:"reviews"`
+	Favorites       []models.JSONFoodTruck `json:"favorites"`
+	OwnedFoodTrucks []models.JSONFoodTruck `json:"ownedFoodTrucks"`
+	Claims          []models.JSONClaim     `json:"claims"`
+	Exported        time.Time              `json:"exported"`
+}
+
+// GetProfileExportHandler sends a copy of everything stored about the logged in user
+func (s *Server) GetProfileExportHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to export your data")
+		return
+	}
+
+	// Get user from database
+	user, err := s.Users.GetProfile(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+
+	export := accountExport{
+		User:      user,
+		Favorites: []models.JSONFoodTruck{},
+		Exported:  time.Now(),
+	}
+
+	// Get the user's reviews
+	export.Reviews, err = s.Reviews.ListByReviewer(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Reviews could not be exported")
+		return
+	}
+
+	// Get the user's favorite food trucks
+	if len(user.Favorites) > 0 {
+		export.Favorites, err = s.FoodTrucks.GetMany(r.Context(), user.Favorites)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Favorites could not be exported")
+			return
+		}
+	}
+
+	// Get the food trucks the user owns
+	export.OwnedFoodTrucks, err = s.FoodTrucks.ListByOwner(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food trucks could not be exported")
+		return
+	}
+
+	// Get the user's claims
+	export.Claims, err = s.Claims.ListByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claims could not be exported")
+		return
+	}
+
+	// Send response as a file download
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="munch-export.json"`)
+	json.NewEncoder(w).Encode(export)
+}
+
+// DeleteProfileHandler deletes the logged in user, their food trucks become unclaimed and their reviews anonymous
+func (s *Server) DeleteProfileHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to delete your account")
+		return
+	}
+
+	// Decode request
+	deleteDecoder := json.NewDecoder(r.Body)
+	deleteDecoder.DisallowUnknownFields()
+	var deleteAccount deleteAccountRequest
+	err := deleteDecoder.Decode(&deleteAccount)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+
+	// Make sure the user really means it, with their password if they have one
+	if len(user.PasswordHash) > 0 {
+		if deleteAccount.Password == nil {
+			writeMissingField(w, r, "password")
+			return
+		}
+		err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(*deleteAccount.Password))
+		if err != nil {
+			writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Password is incorrect", errorDetail{Field: "password", Code: errCodeInvalidCredentials, Message: "Password is incorrect"})
+			return
+		}
+	} else if user.TwoFactorEnabled {
+		if deleteAccount.Code == nil {
+			writeMissingField(w, r, "code")
+			return
+		}
+		valid, err := s.useTwoFactorCode(r, user, *deleteAccount.Code)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Code could not be checked")
+			return
+		}
+		if !valid {
+			writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Code is incorrect", errorDetail{Field: "code", Code: errCodeInvalidCredentials, Message: "Code is incorrect"})
+			return
+		}
+	} else {
+		// Otherwise the user has to have just logged in with their provider, refreshed tokens keep the login's time
+		claims, _ := r.Context().Value(middleware.ClaimsKey).(middleware.Claims)
+		if claims.AuthTime == 0 || time.Since(time.Unix(claims.AuthTime, 0)) > recentLoginWindow {
+			writeError(w, r, http.StatusForbidden, errCodeForbidden, "Log in again to delete your account")
+			return
+		}
+	}
+
+	// Detach the user's food trucks so they can be claimed again
+	err = s.FoodTrucks.ClearOwner(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food trucks could not be released")
+		return
+	}
+
+	// Keep the user's reviews for the food trucks' ratings, but remove who wrote them
+	err = s.Reviews.SetReviewer(r.Context(), userID, "", deletedReviewerName)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Reviews could not be anonymized")
+		return
+	}
+
+	// Reject the user's pending claims
+	err = s.Claims.RejectByUser(r.Context(), userID, "Account deleted", time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claims could not be rejected")
+		return
+	}
+
+	// Log the user out everywhere
+	err = s.revokeUserRefreshTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Sessions could not be logged out")
+		return
+	}
+	err = s.UserTokens.DeleteByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Tokens could not be deleted")
+		return
+	}
+
+	// Delete the user, which also stops their access tokens from working
+	err = s.Users.Delete(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Account could not be deleted")
+		return
+	}
+
+	// Delete the user's uploaded picture, the user is already gone if this fails. Each size is stored under the last
+	// part of its url.
+	for _, url := range []string{user.PictureVariants.Thumbnail, user.PictureVariants.Card, user.PictureVariants.Full} {
+		if url == "" {
+			continue
+		}
+		err = s.Blobs.Delete(r.Context(), path.Base(url))
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,298 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"munchserver/blobstore"
+	"munchserver/models"
+	"munchserver/tests"
+	"munchserver/totp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestProfileExportGet(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:              "testuser",
+		PasswordHash:    []byte("testpasswordhash"),
+		Favorites:       []string{"favoritefoodtruck"},
+		OwnedFoodTrucks: []string{"ownedfoodtruck"},
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID: "favoritefoodtruck",
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "ownedfoodtruck",
+		Owner: "testuser",
+	})
+	tests.AddReview(models.JSONReview{
+		ID:       "testreview",
+		Reviewer: "testuser",
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:           "testclaim",
+		FoodTruck:    "favoritefoodtruck",
+		User:         "testuser",
+		Status:       models.ClaimPending,
+		CallbackCode: "123456",
+	})
+
+	req, _ := http.NewRequest("GET", "/profile/export", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.GetProfileExportHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("exporting profile expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if bytes.Contains(rr.Body.Bytes(), []byte("testpasswordhash")) {
+		t.Error("exporting profile should not include the password hash")
+	}
+	if bytes.Contains(rr.Body.Bytes(), []byte("callbackCode")) || bytes.Contains(rr.Body.Bytes(), []byte("123456")) {
+		t.Error("exporting profile should not include the claim's callback code")
+	}
+
+	var export accountExport
+	json.NewDecoder(rr.Body).Decode(&export)
+	if export.User.ID != "testuser" ||
+		len(export.Reviews) != 1 ||
+		len(export.Favorites) != 1 ||
+		len(export.OwnedFoodTrucks) != 1 ||
+		len(export.Claims) != 1 {
+		t.Errorf("expected export to have the user's data, but got %v", export)
+	}
+}
+
+func TestProfileDeleteValid(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:              "testuser",
+		PasswordHash:    passwordHash,
+		OwnedFoodTrucks: []string{"testfoodtruck"},
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Owner: "testuser",
+	})
+	tests.AddReview(models.JSONReview{
+		ID:           "testreview",
+		Reviewer:     "testuser",
+		ReviewerName: "Test User",
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:     "testclaim",
+		User:   "testuser",
+		Status: models.ClaimPending,
+	})
+
+	password := "password123"
+	body, _ := json.Marshal(deleteAccountRequest{
+		Password: &password,
+	})
+	req, _ := http.NewRequest("DELETE", "/profile", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.DeleteProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("deleting profile expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetUser("testuser") != nil {
+		t.Error("deleting profile should have removed the user")
+	}
+
+	foodTruck := tests.GetFoodTruck("testfoodtruck")
+	if foodTruck == nil || foodTruck.Owner != "" {
+		t.Error("deleting profile should have detached the user's food trucks")
+	}
+
+	review := tests.GetReview("testreview")
+	if review == nil || review.Reviewer != "" || review.ReviewerName != deletedReviewerName {
+		t.Error("deleting profile should have anonymized the user's reviews")
+	}
+
+	claim := tests.GetClaim("testclaim")
+	if claim == nil || claim.Status != models.ClaimRejected {
+		t.Error("deleting profile should have rejected the user's pending claims")
+	}
+}
+
+func TestProfileDeleteWrongPassword(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		PasswordHash: passwordHash,
+	})
+
+	password := "notmypassword"
+	body, _ := json.Marshal(deleteAccountRequest{
+		Password: &password,
+	})
+	req, _ := http.NewRequest("DELETE", "/profile", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.DeleteProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("deleting profile with wrong password expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetUser("testuser") == nil {
+		t.Error("deleting profile with wrong password should not have removed the user")
+	}
+}
+
+func TestProfileDeleteWithoutPasswordRecentLogin(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:         "testuser",
+		Identities: []models.JSONIdentity{{Provider: "test", Subject: "testsubject"}},
+	})
+
+	body, _ := json.Marshal(deleteAccountRequest{})
+	req, _ := http.NewRequest("DELETE", "/profile", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserAuthTime(time.Now().Add(-time.Minute))(http.HandlerFunc(testServer.DeleteProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("deleting profile without a password after logging in recently expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetUser("testuser") != nil {
+		t.Error("deleting profile without a password after logging in recently should have removed the user")
+	}
+}
+
+func TestProfileDeleteWithoutPasswordStaleLogin(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:         "testuser",
+		Identities: []models.JSONIdentity{{Provider: "test", Subject: "testsubject"}},
+	})
+
+	body, _ := json.Marshal(deleteAccountRequest{})
+	req, _ := http.NewRequest("DELETE", "/profile", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserAuthTime(time.Now().Add(-time.Hour))(http.HandlerFunc(testServer.DeleteProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("deleting profile without a password long after logging in expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetUser("testuser") == nil {
+		t.Error("deleting profile without a password long after logging in should not have removed the user")
+	}
+}
+
+func TestProfileDeleteWithoutPasswordTwoFactorCode(t *testing.T) {
+	tests.ClearDB()
+
+	secret, _ := totp.GenerateSecret()
+	tests.AddUser(models.JSONUser{
+		ID:               "testuser",
+		Identities:       []models.JSONIdentity{{Provider: "test", Subject: "testsubject"}},
+		TwoFactorEnabled: true,
+		TOTPSecret:       secret,
+	})
+
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+	body, _ := json.Marshal(deleteAccountRequest{
+		Code: &code,
+	})
+	req, _ := http.NewRequest("DELETE", "/profile", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserAuthTime(time.Now().Add(-time.Hour))(http.HandlerFunc(testServer.DeleteProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("deleting profile without a password with a two factor code expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetUser("testuser") != nil {
+		t.Error("deleting profile without a password with a two factor code should have removed the user")
+	}
+}
+
+func TestProfileDeleteWithoutPasswordMissingTwoFactorCode(t *testing.T) {
+	tests.ClearDB()
+
+	secret, _ := totp.GenerateSecret()
+	tests.AddUser(models.JSONUser{
+		ID:               "testuser",
+		Identities:       []models.JSONIdentity{{Provider: "test", Subject: "testsubject"}},
+		TwoFactorEnabled: true,
+		TOTPSecret:       secret,
+	})
+
+	// A recent login isn't enough when the user has a code to send
+	body, _ := json.Marshal(deleteAccountRequest{})
+	req, _ := http.NewRequest("DELETE", "/profile", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserAuthTime(time.Now())(http.HandlerFunc(testServer.DeleteProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("deleting profile with two factor authentication without a code expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetUser("testuser") == nil {
+		t.Error("deleting profile with two factor authentication without a code should not have removed the user")
+	}
+}
+
+func TestProfileDeleteRemovesPicture(t *testing.T) {
+	tests.ClearDB()
+
+	keys := []string{"testuser_thumbnail.jpg", "testuser_card.jpg", "testuser_full.jpg"}
+	var urls []string
+	for _, key := range keys {
+		url, _ := testBlobs.Put(context.TODO(), key, bytes.NewReader(testJPEG(10, 10)), "image/jpeg")
+		urls = append(urls, url)
+	}
+	tests.AddUser(models.JSONUser{
+		ID:              "testuser",
+		Picture:         urls[2],
+		PictureVariants: models.JSONImageVariants{Thumbnail: urls[0], Card: urls[1], Full: urls[2]},
+	})
+
+	body, _ := json.Marshal(deleteAccountRequest{})
+	req, _ := http.NewRequest("DELETE", "/profile", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserAuthTime(time.Now())(http.HandlerFunc(testServer.DeleteProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("deleting profile with a picture expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	for _, key := range keys {
+		if _, err := testBlobs.Stat(context.TODO(), key); err != blobstore.ErrNotFound {
+			t.Errorf("deleting profile should have deleted the picture %v, but got %v", key, err)
+		}
+	}
+}
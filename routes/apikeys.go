@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/validation"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// apiKeyPrefix is added to the start of every api key so they are easy to recognize
+const apiKeyPrefix = "munch_"
+
+type addAPIKeyRequest struct {
+	Name   *string  `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type addAPIKeyResponse struct {
+	Key    string            `json:"key"`
+	APIKey models.JSONAPIKey `json:"apiKey"`
+}
+
+// ValidateAPIKey looks up an unrevoked api key and records that it was used
+func (s *Server) ValidateAPIKey(ctx context.Context, key string) (string, []string, error) {
+	apiKey, err := s.APIKeys.Use(ctx, hashToken(key), time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+	return apiKey.ID, apiKey.Scopes, nil
+}
+
+// PostAPIKeysHandler mints a new api key, the key itself is only ever sent in this response
+func (s *Server) PostAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	// Get admin from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to add an API key")
+		return
+	}
+
+	apiKeyDecoder := json.NewDecoder(r.Body)
+	apiKeyDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var newAPIKey addAPIKeyRequest
+	err := apiKeyDecoder.Decode(&newAPIKey)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+
+	// Make sure required fields are set
+	var fieldErrors []validation.FieldError
+	if newAPIKey.Name == nil {
+		fieldErrors = append(fieldErrors, validation.Missing("name"))
+	}
+	if len(newAPIKey.Scopes) == 0 {
+		fieldErrors = append(fieldErrors, validation.Missing("scopes"))
+	}
+	if writeValidationErrors(w, r, fieldErrors) {
+		return
+	}
+
+	// Validate scopes
+	for _, scope := range newAPIKey.Scopes {
+		if !validAPIKeyScope(scope) {
+			writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Scope is not valid",
+				errorDetail{Field: "scopes", Code: errCodeInvalidField, Message: scope + " is not a scope"})
+			return
+		}
+	}
+
+	// Generate the key
+	token, err := generateToken(32)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "API key could not be generated")
+		return
+	}
+	key := apiKeyPrefix + token
+
+	// Generate uuid for api key
+	uuid, _ := uuid.NewRandom()
+
+	addedAPIKey := models.JSONAPIKey{
+		ID:        uuid.String(),
+		Name:      *newAPIKey.Name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		Hash:      hashToken(key),
+		Scopes:    newAPIKey.Scopes,
+		CreatedBy: userID,
+		Created:   time.Now(),
+	}
+
+	// Add api key to database
+	err = s.APIKeys.Add(r.Context(), addedAPIKey)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "API key could not be added")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(addAPIKeyResponse{
+		Key:    key,
+		APIKey: addedAPIKey,
+	})
+}
+
+// GetAPIKeysHandler lists all api keys along with their usage
+func (s *Server) GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	// Get all api keys, newest first
+	apiKeys, err := s.APIKeys.List(r.Context())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "API keys could not be found")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiKeys)
+}
+
+// DeleteAPIKeyHandler revokes an api key
+func (s *Server) DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	// Checks for api key ID
+	params := mux.Vars(r)
+	apiKeyID, apiKeyIDExists := params["apiKeyID"]
+	if !apiKeyIDExists {
+		writeMissingField(w, r, "apiKeyID")
+		return
+	}
+
+	revoked, err := s.APIKeys.Revoke(r.Context(), apiKeyID, time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "API key could not be revoked")
+		return
+	}
+	if !revoked {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "API key not found")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// validAPIKeyScope checks if the scope is one an api key can be given
+func validAPIKeyScope(scope string) bool {
+	for _, apiKeyScope := range models.APIKeyScopes {
+		if scope == apiKeyScope {
+			return true
+		}
+	}
+	return false
+}
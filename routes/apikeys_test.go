@@ -0,0 +1,237 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAPIKeysPostValid(t *testing.T) {
+	tests.ClearDB()
+
+	name := "scraperbot"
+	body, _ := json.Marshal(addAPIKeyRequest{
+		Name:   &name,
+		Scopes: []string{models.ScopeTrucksWrite, models.ScopeReviewsWrite},
+	})
+	req, _ := http.NewRequest("POST", "/apikeys", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PostAPIKeysHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("adding valid api key expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var response addAPIKeyResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if !strings.HasPrefix(response.Key, apiKeyPrefix) {
+		t.Errorf("expected api key to start with %v, but got %v", apiKeyPrefix, response.Key)
+	}
+
+	addedAPIKey := tests.GetAPIKey(response.APIKey.ID)
+	if addedAPIKey == nil || addedAPIKey.Hash != hashToken(response.Key) || addedAPIKey.CreatedBy != "testuser" {
+		t.Error("adding valid api key should have stored the hash of the key")
+	}
+
+	// The new key should authenticate
+	apiKeyID, scopes, err := testServer.ValidateAPIKey(context.TODO(), response.Key)
+	if err != nil || apiKeyID != response.APIKey.ID || len(scopes) != 2 {
+		t.Errorf("expected new api key to be valid, but got error %v", err)
+	}
+
+	usedAPIKey := tests.GetAPIKey(response.APIKey.ID)
+	if usedAPIKey == nil || usedAPIKey.UsageCount != 1 || usedAPIKey.LastUsed.IsZero() {
+		t.Error("using api key should have updated its usage")
+	}
+}
+
+func TestAPIKeysPostInvalidScope(t *testing.T) {
+	tests.ClearDB()
+
+	name := "scraperbot"
+	body, _ := json.Marshal(addAPIKeyRequest{
+		Name:   &name,
+		Scopes: []string{"users:delete"},
+	})
+	req, _ := http.NewRequest("POST", "/apikeys", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PostAPIKeysHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("adding api key with invalid scope expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestAPIKeysPostNotAdmin(t *testing.T) {
+	tests.ClearDB()
+
+	name := "scraperbot"
+	body, _ := json.Marshal(addAPIKeyRequest{
+		Name:   &name,
+		Scopes: []string{models.ScopeTrucksWrite},
+	})
+	req, _ := http.NewRequest("POST", "/apikeys", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PostAPIKeysHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("adding api key as a regular user expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeForbidden || response.Error.RequestID == "" {
+		t.Errorf("expected forbidden error with a request id, but got %v", response.Error)
+	}
+}
+
+func TestAPIKeysPostNotLoggedIn(t *testing.T) {
+	tests.ClearDB()
+
+	req, _ := http.NewRequest("POST", "/apikeys", nil)
+	req.Header.Set("X-Request-ID", "testrequest")
+	rr := httptest.NewRecorder()
+	handler := middleware.RequestID(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PostAPIKeysHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("adding api key without logging in expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeUnauthorized || response.Error.RequestID != "testrequest" {
+		t.Errorf("expected unauthorized error with the request id, but got %v", response.Error)
+	}
+}
+
+func TestAPIKeysGet(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddAPIKey(models.JSONAPIKey{
+		ID:   "testapikey",
+		Hash: hashToken("munch_testkey"),
+	})
+
+	req, _ := http.NewRequest("GET", "/apikeys", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.GetAPIKeysHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("getting api keys expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	body := rr.Body.String()
+	if strings.Contains(body, hashToken("munch_testkey")) {
+		t.Error("getting api keys should not include the key hashes")
+	}
+
+	var apiKeys []models.JSONAPIKey
+	json.NewDecoder(strings.NewReader(body)).Decode(&apiKeys)
+	if len(apiKeys) != 1 || apiKeys[0].ID != "testapikey" {
+		t.Errorf("expected one api key, but got %v", apiKeys)
+	}
+}
+
+func TestAPIKeyDeleteValid(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddAPIKey(models.JSONAPIKey{
+		ID:     "testapikey",
+		Hash:   hashToken("munch_testkey"),
+		Scopes: []string{models.ScopeReviewsWrite},
+	})
+
+	req, _ := http.NewRequest("DELETE", "/apikeys", nil)
+	vars := map[string]string{
+		"apiKeyID": "testapikey",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.DeleteAPIKeyHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("revoking api key expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	apiKey := tests.GetAPIKey("testapikey")
+	if apiKey == nil || !apiKey.Revoked {
+		t.Error("revoking api key should have marked it revoked")
+	}
+
+	_, _, err := testServer.ValidateAPIKey(context.TODO(), "munch_testkey")
+	if err == nil {
+		t.Error("expected revoked api key to be invalid")
+	}
+}
+
+func TestAPIKeyAuthenticateInvalid(t *testing.T) {
+	tests.ClearDB()
+
+	req, _ := http.NewRequest("POST", "/reviews", nil)
+	req.Header.Set("X-API-Key", "munch_notarealkey")
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateAPIKey(testServer.ValidateAPIKey)(http.HandlerFunc(testServer.PostReviewsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("using an invalid api key expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeUnauthorized || response.Error.RequestID == "" {
+		t.Errorf("expected unauthorized error with a request id, but got %v", response.Error)
+	}
+}
+
+func TestAPIKeyAuthenticateValid(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddAPIKey(models.JSONAPIKey{
+		ID:     "testapikey",
+		Hash:   hashToken("munch_testkey"),
+		Scopes: []string{models.ScopeReviewsWrite},
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:      "testfoodtruck",
+		Reviews: []string{},
+	})
+
+	var rating float64 = 5.0
+	foodTruck := "testfoodtruck"
+	body, _ := json.Marshal(newReviewRequest{
+		ReviewerName: "Test User",
+		FoodTruck:    &foodTruck,
+		Rating:       &rating,
+		Origin:       "Yelp",
+	})
+	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
+	req.Header.Set("X-API-Key", "munch_testkey")
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateAPIKey(testServer.ValidateAPIKey)(http.HandlerFunc(testServer.PostReviewsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("adding review with a valid api key expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// FoodTruckOwnerOnly is a middleware which only lets the owner of the food truck in the route, or an admin, through
+func (s *Server) FoodTruckOwnerOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Checks for food truck ID
+		params := mux.Vars(r)
+		foodTruckID, foodTruckIDExists := params["foodTruckID"]
+		if !foodTruckIDExists {
+			writeMissingField(w, r, "foodTruckID")
+			return
+		}
+
+		// Get user from context
+		userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+		// Check for a user
+		if !userLoggedIn {
+			writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to modify this food truck")
+			return
+		}
+
+		// Lookup food truck in db
+		foodTruck, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
+			return
+		}
+
+		// Only the owner or an admin may modify the food truck
+		if foodTruck.Owner != userID && !middleware.HasRole(r.Context(), models.RoleAdmin) {
+			writeError(w, r, http.StatusForbidden, errCodeForbidden, "Only the owner can modify this food truck")
+			return
+		}
+
+		next(w, r)
+	}
+}
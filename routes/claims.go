@@ -0,0 +1,442 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type claimFoodTruckRequest struct {
+	BusinessLicense *string `json:"businessLicenseNumber"`
+}
+
+type verifyClaimRequest struct {
+	Code *string `json:"code"`
+}
+
+type rejectClaimRequest struct {
+	Reason string `json:"reason"`
+}
+
+// adminClaim is a claim as admins see it, with the code they read to the owner when calling them back. Claims are
+// never sent to anyone else with the code.
+type adminClaim struct {
+	models.JSONClaim
+	CallbackCode string `json:"callbackCode"`
+}
+
+// PutClaimFoodTruckHandler creates a pending request for the user to become the owner of a food truck
+func (s *Server) PutClaimFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Checks for food truck ID
+	params := mux.Vars(r)
+	foodTruckID, foodTruckIDExists := params["foodTruckID"]
+	if !foodTruckIDExists {
+		writeMissingField(w, r, "foodTruckID")
+		return
+	}
+
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to claim a food truck")
+		return
+	}
+
+	// Lookup food truck in db
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
+		return
+	}
+
+	claimDecoder := json.NewDecoder(r.Body)
+	claimDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var claimRequest claimFoodTruckRequest
+	err = claimDecoder.Decode(&claimRequest)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeInvalidJSON(w, r, err)
+		return
+	}
+
+	// Make sure required fields are set
+	if claimRequest.BusinessLicense == nil || *claimRequest.BusinessLicense == "" {
+		writeMissingField(w, r, "businessLicenseNumber")
+		return
+	}
+
+	// Users can't claim a food truck they already own
+	if foodTruck.Owner == userID {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "You already own this food truck")
+		return
+	}
+
+	// Only allow one pending claim per user for a food truck
+	hasPendingClaim, err := s.Claims.HasPending(r.Context(), foodTruckID, userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claims could not be checked")
+		return
+	}
+	if hasPendingClaim {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "You already have a pending claim for this food truck")
+		return
+	}
+
+	// Only the phone number listed for the food truck is called back, answering it is what proves the user owns it
+	if foodTruck.PhoneNumber == "" {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Food truck has no phone number to call back")
+		return
+	}
+
+	// Generate the code an admin will read to the owner when calling them back
+	callbackCode, err := generateCallbackCode()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claim could not be added")
+		return
+	}
+
+	// Generate uuid for claim
+	uuid, _ := uuid.NewRandom()
+
+	addedClaim := models.JSONClaim{
+		ID:              uuid.String(),
+		FoodTruck:       foodTruckID,
+		User:            userID,
+		Status:          models.ClaimPending,
+		BusinessLicense: *claimRequest.BusinessLicense,
+		PhoneNumber:     foodTruck.PhoneNumber,
+		CallbackCode:    callbackCode,
+		Date:            time.Now(),
+	}
+
+	// Add claim to database
+	err = s.Claims.Add(r.Context(), addedClaim)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claim could not be added")
+		return
+	}
+
+	// Send response, the code the user needs to get from the callback is never sent
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(addedClaim)
+}
+
+// PutVerifyClaimHandler checks the code the user received from the phone callback for their claim
+func (s *Server) PutVerifyClaimHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Checks for claim ID
+	params := mux.Vars(r)
+	claimID, claimIDExists := params["claimID"]
+	if !claimIDExists {
+		writeMissingField(w, r, "claimID")
+		return
+	}
+
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to verify a claim")
+		return
+	}
+
+	verifyDecoder := json.NewDecoder(r.Body)
+	verifyDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var verifyRequest verifyClaimRequest
+	err := verifyDecoder.Decode(&verifyRequest)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if verifyRequest.Code == nil {
+		writeMissingField(w, r, "code")
+		return
+	}
+
+	// Count the attempt against the user's pending claim, so the code can't be guessed
+	claim, err := s.Claims.UseAttempt(r.Context(), claimID, userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Pending claim not found or out of attempts")
+		return
+	}
+
+	// Check the code matches
+	if subtle.ConstantTimeCompare([]byte(claim.CallbackCode), []byte(*verifyRequest.Code)) != 1 {
+		writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Code is incorrect", errorDetail{Field: "code", Code: errCodeInvalidCredentials, Message: "Code is incorrect"})
+		return
+	}
+
+	err = s.Claims.SetPhoneVerified(r.Context(), claimID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claim could not be verified")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetClaimsHandler lists claims with a status, defaulting to pending claims
+func (s *Server) GetClaimsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Get status from query params
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ClaimPending
+	}
+	if status != models.ClaimPending && status != models.ClaimApproved && status != models.ClaimRejected {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Status is not valid", errorDetail{Field: "status", Code: errCodeInvalidField, Message: "Expected pending, approved or rejected"})
+		return
+	}
+
+	// Get the claims, oldest first
+	claims, err := s.Claims.ListByStatus(r.Context(), status)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claims could not be found")
+		return
+	}
+
+	// Send response, with the codes admins need to call back owners
+	adminClaims := make([]adminClaim, len(claims))
+	for i, claim := range claims {
+		adminClaims[i] = adminClaim{JSONClaim: claim, CallbackCode: claim.CallbackCode}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminClaims)
+}
+
+// PutApproveClaimHandler approves a pending claim and transfers the food truck to the claiming user
+func (s *Server) PutApproveClaimHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Checks for claim ID
+	params := mux.Vars(r)
+	claimID, claimIDExists := params["claimID"]
+	if !claimIDExists {
+		writeMissingField(w, r, "claimID")
+		return
+	}
+
+	// Get admin from context
+	reviewerID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to approve a claim")
+		return
+	}
+
+	// Lookup claim in db
+	claim, err := s.Claims.Get(r.Context(), claimID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Claim not found")
+		return
+	}
+
+	// Only claims from users who proved they can answer the food truck's phone can be approved
+	if !claim.PhoneVerified {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Claim's phone number has not been verified")
+		return
+	}
+
+	// Lookup food truck in db to find the previous owner
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), claim.FoodTruck)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
+		return
+	}
+
+	// Every step of the approval can be undone, so when a step fails the ones before it are undone newest first,
+	// leaving the claim, food truck and users as they were
+	var undo []func() error
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			err := undo[i]()
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+	}
+
+	// Approve the claim, only if it is still pending so it can't be approved twice
+	now := time.Now()
+	approved, err := s.Claims.Review(r.Context(), claimID, models.ClaimApproved, reviewerID, "", now)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claim could not be approved")
+		return
+	}
+	if !approved {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Claim has already been reviewed")
+		return
+	}
+	undo = append(undo, func() error {
+		return s.Claims.SetPending(r.Context(), claimID)
+	})
+
+	// Transfer the food truck, only if its owner hasn't changed since it was looked up
+	transferred, err := s.FoodTrucks.ReplaceOwner(r.Context(), foodTruck.ID, foodTruck.Owner, claim.User)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		rollback()
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck could not be transferred")
+		return
+	}
+	if !transferred {
+		rollback()
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Food truck owner changed while the claim was approved")
+		return
+	}
+	undo = append(undo, func() error {
+		_, err := s.FoodTrucks.ReplaceOwner(r.Context(), foodTruck.ID, claim.User, foodTruck.Owner)
+		return err
+	})
+
+	// Move the food truck from the previous owner to the new owner
+	if foodTruck.Owner != "" {
+		err = s.Users.RemoveOwnedFoodTruck(r.Context(), foodTruck.Owner, foodTruck.ID)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			rollback()
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck could not be transferred")
+			return
+		}
+		undo = append(undo, func() error {
+			return s.Users.AddOwnedFoodTruck(r.Context(), foodTruck.Owner, foodTruck.ID)
+		})
+
+		// The previous owner is no longer an owner if that was their last food truck
+		err = s.Users.RemoveOwnerRole(r.Context(), foodTruck.Owner)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			rollback()
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck could not be transferred")
+			return
+		}
+		undo = append(undo, func() error {
+			return s.Users.AddRole(r.Context(), foodTruck.Owner, models.RoleOwner)
+		})
+	}
+	err = s.Users.AddOwnedFoodTruck(r.Context(), claim.User, foodTruck.ID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		rollback()
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck could not be transferred")
+		return
+	}
+
+	// The owner role is only taken back once the food truck is, in case the new owner was already an owner
+	undo = append(undo, func() error {
+		err := s.Users.RemoveOwnedFoodTruck(r.Context(), claim.User, foodTruck.ID)
+		if err != nil {
+			return err
+		}
+		return s.Users.RemoveOwnerRole(r.Context(), claim.User)
+	})
+	err = s.Users.AddRole(r.Context(), claim.User, models.RoleOwner)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		rollback()
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck could not be transferred")
+		return
+	}
+
+	// Reject any other pending claims for the food truck
+	otherClaims, err := s.Claims.ListOtherPending(r.Context(), foodTruck.ID, claimID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		rollback()
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Other claims could not be rejected")
+		return
+	}
+	for _, otherClaim := range otherClaims {
+		otherClaimID := otherClaim.ID
+		rejected, err := s.Claims.Review(r.Context(), otherClaimID, models.ClaimRejected, reviewerID, "Another claim was approved", now)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			rollback()
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Other claims could not be rejected")
+			return
+		}
+		if rejected {
+			undo = append(undo, func() error {
+				return s.Claims.SetPending(r.Context(), otherClaimID)
+			})
+		}
+	}
+
+	// Send response
+	claim.Status = models.ClaimApproved
+	claim.Reviewer = reviewerID
+	claim.ReviewedDate = now
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(claim)
+}
+
+// PutRejectClaimHandler rejects a pending claim
+func (s *Server) PutRejectClaimHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Checks for claim ID
+	params := mux.Vars(r)
+	claimID, claimIDExists := params["claimID"]
+	if !claimIDExists {
+		writeMissingField(w, r, "claimID")
+		return
+	}
+
+	// Get admin from context
+	reviewerID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to reject a claim")
+		return
+	}
+
+	// Decode the optional reason for the rejection
+	var rejectRequest rejectClaimRequest
+	if r.Body != nil && r.ContentLength != 0 {
+		rejectDecoder := json.NewDecoder(r.Body)
+		rejectDecoder.DisallowUnknownFields()
+		err := rejectDecoder.Decode(&rejectRequest)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeInvalidJSON(w, r, err)
+			return
+		}
+	}
+
+	// Reject the claim, only if it is still pending
+	rejected, err := s.Claims.Review(r.Context(), claimID, models.ClaimRejected, reviewerID, rejectRequest.Reason, time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Claim could not be rejected")
+		return
+	}
+	if !rejected {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Pending claim not found")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,516 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/store"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestClaimsGetNotAdmin(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	req, _ := http.NewRequest("GET", "/claims", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles()(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.GetClaimsHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("getting claims as a regular user expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestClaimsGetPending(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddClaim(models.JSONClaim{
+		ID:     "pendingclaim",
+		Status: models.ClaimPending,
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:     "rejectedclaim",
+		Status: models.ClaimRejected,
+	})
+
+	req, _ := http.NewRequest("GET", "/claims", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.GetClaimsHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("getting claims as an admin expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var claims []models.JSONClaim
+	json.NewDecoder(rr.Body).Decode(&claims)
+	if len(claims) != 1 || claims[0].ID != "pendingclaim" {
+		t.Errorf("expected only the pending claim, but got %v", claims)
+	}
+}
+
+func TestClaimVerifyPutValid(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddClaim(models.JSONClaim{
+		ID:           "testclaim",
+		User:         "testuser",
+		Status:       models.ClaimPending,
+		CallbackCode: "123456",
+	})
+
+	code := "123456"
+	body, _ := json.Marshal(verifyClaimRequest{
+		Code: &code,
+	})
+	req, _ := http.NewRequest("PUT", "/claims/verify", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutVerifyClaimHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("verifying claim with correct code expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	claim := tests.GetClaim("testclaim")
+	if claim == nil || !claim.PhoneVerified {
+		t.Error("verifying claim with correct code should have marked the phone as verified")
+	}
+}
+
+func TestClaimVerifyPutIncorrectCode(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddClaim(models.JSONClaim{
+		ID:           "testclaim",
+		User:         "testuser",
+		Status:       models.ClaimPending,
+		CallbackCode: "123456",
+	})
+
+	code := "654321"
+	body, _ := json.Marshal(verifyClaimRequest{
+		Code: &code,
+	})
+	req, _ := http.NewRequest("PUT", "/claims/verify", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutVerifyClaimHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("verifying claim with incorrect code expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	claim := tests.GetClaim("testclaim")
+	if claim == nil || claim.PhoneVerified || claim.Attempts != 1 {
+		t.Error("verifying claim with incorrect code should have only counted the attempt")
+	}
+}
+
+func TestClaimVerifyPutTooManyAttempts(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddClaim(models.JSONClaim{
+		ID:           "testclaim",
+		User:         "testuser",
+		Status:       models.ClaimPending,
+		CallbackCode: "123456",
+		Attempts:     models.MaxClaimAttempts,
+	})
+
+	code := "123456"
+	body, _ := json.Marshal(verifyClaimRequest{
+		Code: &code,
+	})
+	req, _ := http.NewRequest("PUT", "/claims/verify", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutVerifyClaimHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusNotFound
+	if rr.Code != expected {
+		t.Errorf("verifying claim after too many attempts expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestClaimApprovePutValid(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:              "olduser",
+		Email:           "olduser@example.com",
+		OwnedFoodTrucks: []string{"testfoodtruck"},
+		Roles:           []string{models.RoleOwner},
+	})
+	tests.AddUser(models.JSONUser{
+		ID:              "newuser",
+		Email:           "newuser@example.com",
+		OwnedFoodTrucks: []string{},
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Owner: "olduser",
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:            "testclaim",
+		FoodTruck:     "testfoodtruck",
+		User:          "newuser",
+		Status:        models.ClaimPending,
+		PhoneVerified: true,
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:        "otherclaim",
+		FoodTruck: "testfoodtruck",
+		User:      "otheruser",
+		Status:    models.ClaimPending,
+	})
+
+	req, _ := http.NewRequest("PUT", "/claims/approve", nil)
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PutApproveClaimHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("approving a pending claim expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	foodTruck := tests.GetFoodTruck("testfoodtruck")
+	if foodTruck == nil || foodTruck.Owner != "newuser" {
+		t.Error("approving a pending claim should have updated owner of food truck")
+	}
+
+	oldUser := tests.GetUser("olduser")
+	if oldUser == nil || len(oldUser.OwnedFoodTrucks) != 0 {
+		t.Error("approving a pending claim should have removed food truck from previous owner")
+	}
+	if oldUser != nil && len(oldUser.Roles) != 0 {
+		t.Errorf("approving a pending claim should have removed owner role from previous owner, but got %v", oldUser.Roles)
+	}
+
+	newUser := tests.GetUser("newuser")
+	if newUser == nil || len(newUser.OwnedFoodTrucks) != 1 || newUser.OwnedFoodTrucks[0] != "testfoodtruck" {
+		t.Error("approving a pending claim should have added food truck to new owner")
+	}
+	if newUser != nil && (len(newUser.Roles) != 1 || newUser.Roles[0] != models.RoleOwner) {
+		t.Errorf("approving a pending claim should have given new owner the owner role, but got %v", newUser.Roles)
+	}
+
+	claim := tests.GetClaim("testclaim")
+	if claim == nil || claim.Status != models.ClaimApproved || claim.Reviewer != "testuser" {
+		t.Error("approving a pending claim should have marked the claim approved")
+	}
+
+	otherClaim := tests.GetClaim("otherclaim")
+	if otherClaim == nil || otherClaim.Status != models.ClaimRejected {
+		t.Error("approving a pending claim should have rejected other claims for the food truck")
+	}
+}
+
+func TestClaimApprovePutAlreadyReviewed(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID: "testfoodtruck",
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:            "testclaim",
+		FoodTruck:     "testfoodtruck",
+		User:          "newuser",
+		Status:        models.ClaimRejected,
+		PhoneVerified: true,
+	})
+
+	req, _ := http.NewRequest("PUT", "/claims/approve", nil)
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PutApproveClaimHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusConflict
+	if rr.Code != expected {
+		t.Errorf("approving a rejected claim expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	foodTruck := tests.GetFoodTruck("testfoodtruck")
+	if foodTruck == nil || foodTruck.Owner != "" {
+		t.Error("approving a rejected claim should not have updated owner of food truck")
+	}
+}
+
+func TestClaimApprovePutPhoneNotVerified(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:              "newuser",
+		Email:           "newuser@example.com",
+		OwnedFoodTrucks: []string{},
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID: "testfoodtruck",
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:        "testclaim",
+		FoodTruck: "testfoodtruck",
+		User:      "newuser",
+		Status:    models.ClaimPending,
+	})
+
+	req, _ := http.NewRequest("PUT", "/claims/approve", nil)
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PutApproveClaimHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusConflict
+	if rr.Code != expected {
+		t.Errorf("approving a claim with an unverified phone expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	foodTruck := tests.GetFoodTruck("testfoodtruck")
+	if foodTruck == nil || foodTruck.Owner != "" {
+		t.Error("approving a claim with an unverified phone should not have updated owner of food truck")
+	}
+	claim := tests.GetClaim("testclaim")
+	if claim == nil || claim.Status != models.ClaimPending {
+		t.Error("approving a claim with an unverified phone should have left the claim pending")
+	}
+}
+
+// failingListClaimStore is a claim store that can't list other pending claims, the last step of approving a claim
+type failingListClaimStore struct {
+	store.ClaimStore
+}
+
+func (s failingListClaimStore) ListOtherPending(ctx context.Context, foodTruckID string, id string) ([]models.JSONClaim, error) {
+	return nil, errors.New("claims are unavailable")
+}
+
+func TestClaimApprovePutRollsBack(t *testing.T) {
+	server := newIsolatedTestServer()
+	server.Claims = failingListClaimStore{server.Claims}
+
+	server.Users.Add(context.TODO(), models.JSONUser{
+		ID:              "olduser",
+		Email:           "olduser@example.com",
+		OwnedFoodTrucks: []string{"testfoodtruck"},
+		Roles:           []string{models.RoleOwner},
+	})
+	server.Users.Add(context.TODO(), models.JSONUser{
+		ID:              "newuser",
+		Email:           "newuser@example.com",
+		OwnedFoodTrucks: []string{},
+	})
+	server.FoodTrucks.Add(context.TODO(), models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Owner: "olduser",
+	})
+	server.Claims.Add(context.TODO(), models.JSONClaim{
+		ID:            "testclaim",
+		FoodTruck:     "testfoodtruck",
+		User:          "newuser",
+		Status:        models.ClaimPending,
+		PhoneVerified: true,
+	})
+
+	req, _ := http.NewRequest("PUT", "/claims/approve", nil)
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(server.PutApproveClaimHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusInternalServerError
+	if rr.Code != expected {
+		t.Errorf("approving a claim when a step fails expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// Every step before the failed one should have been undone
+	foodTruck, err := server.FoodTrucks.Get(context.TODO(), "testfoodtruck")
+	if err != nil || foodTruck.Owner != "olduser" {
+		t.Errorf("approving a claim when a step fails should have kept the food truck's owner, but got %v", foodTruck.Owner)
+	}
+	oldUser, err := server.Users.Get(context.TODO(), "olduser")
+	if err != nil || len(oldUser.OwnedFoodTrucks) != 1 || len(oldUser.Roles) != 1 {
+		t.Errorf("approving a claim when a step fails should have kept the previous owner's food truck and role, but got %v", oldUser)
+	}
+	newUser, err := server.Users.Get(context.TODO(), "newuser")
+	if err != nil || len(newUser.OwnedFoodTrucks) != 0 || len(newUser.Roles) != 0 {
+		t.Errorf("approving a claim when a step fails should not have given the new owner the food truck, but got %v", newUser)
+	}
+	claim, err := server.Claims.Get(context.TODO(), "testclaim")
+	if err != nil || claim.Status != models.ClaimPending {
+		t.Errorf("approving a claim when a step fails should have left the claim pending, but got %v", claim.Status)
+	}
+}
+
+func TestClaimApprovePutNotAdmin(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID: "testfoodtruck",
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:        "testclaim",
+		FoodTruck: "testfoodtruck",
+		User:      "testuser",
+		Status:    models.ClaimPending,
+	})
+
+	req, _ := http.NewRequest("PUT", "/claims/approve", nil)
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles()(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PutApproveClaimHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("approving a claim as a regular user expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestClaimRejectPutValid(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddClaim(models.JSONClaim{
+		ID:        "testclaim",
+		FoodTruck: "testfoodtruck",
+		User:      "newuser",
+		Status:    models.ClaimPending,
+	})
+
+	body, _ := json.Marshal(rejectClaimRequest{
+		Reason: "License does not match",
+	})
+	req, _ := http.NewRequest("PUT", "/claims/reject", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"claimID": "testclaim",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PutRejectClaimHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("rejecting a pending claim expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	claim := tests.GetClaim("testclaim")
+	if claim == nil || claim.Status != models.ClaimRejected || claim.Reason != "License does not match" {
+		t.Error("rejecting a pending claim should have marked the claim rejected with the reason")
+	}
+}
+
+func TestClaimFlowEndToEnd(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:              "testuser",
+		Email:           "tester@example.com",
+		EmailVerified:   true,
+		OwnedFoodTrucks: []string{},
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:          "testfoodtruck",
+		PhoneNumber: "8006729102",
+	})
+
+	// Claim the food truck
+	license := "TX-123456"
+	body, _ := json.Marshal(claimFoodTruckRequest{
+		BusinessLicense: &license,
+	})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", bytes.NewBuffer(body))
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck"})
+	rr := httptest.NewRecorder()
+	tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("claiming food truck expected status code of %v, but got %v", http.StatusOK, rr.Code)
+	}
+	var claim models.JSONClaim
+	json.NewDecoder(rr.Body).Decode(&claim)
+
+	// An admin reads the code to call back the food truck's phone
+	req, _ = http.NewRequest("GET", "/claims", nil)
+	rr = httptest.NewRecorder()
+	tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.GetClaimsHandler))).ServeHTTP(rr, req)
+	var claims []adminClaim
+	json.NewDecoder(rr.Body).Decode(&claims)
+	if len(claims) != 1 || claims[0].ID != claim.ID || len(claims[0].CallbackCode) != 6 {
+		t.Fatalf("expected admins to see the claim's callback code, but got %v", claims)
+	}
+
+	// The owner sends back the code they were told
+	code := claims[0].CallbackCode
+	body, _ = json.Marshal(verifyClaimRequest{
+		Code: &code,
+	})
+	req, _ = http.NewRequest("PUT", "/claims/verify", bytes.NewBuffer(body))
+	req = mux.SetURLVars(req, map[string]string{"claimID": claim.ID})
+	rr = httptest.NewRecorder()
+	tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutVerifyClaimHandler)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("verifying claim expected status code of %v, but got %v", http.StatusOK, rr.Code)
+	}
+
+	// Then an admin approves it
+	req, _ = http.NewRequest("PUT", "/claims/approve", nil)
+	req = mux.SetURLVars(req, map[string]string{"claimID": claim.ID})
+	rr = httptest.NewRecorder()
+	tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PutApproveClaimHandler))).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("approving verified claim expected status code of %v, but got %v", http.StatusOK, rr.Code)
+	}
+
+	foodTruck := tests.GetFoodTruck("testfoodtruck")
+	if foodTruck == nil || foodTruck.Owner != "testuser" {
+		t.Error("claiming, verifying and approving should have made the user the owner of the food truck")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 )
 
@@ -25,7 +26,7 @@ type IssueResponse struct {
 	IssueNumber int `json:"number"`
 }
 
-func GetContributorsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetContributorsHandler(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Println()
 	fmt.Println("---------------------------------")
@@ -259,8 +260,8 @@ func GetContributorsHandler(w http.ResponseWriter, r *http.Request) {
 
 	js, errJS := json.Marshal(returnResponses)
 	if errJS != nil {
-		w.WriteHeader(500)
-		fmt.Fprintf(w, "Error in decoding mongo document: %v", err)
+		log.Printf("ERROR: %v", errJS)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Contributors could not be listed")
 		return
 	}
 	w.WriteHeader(200)
@@ -12,7 +12,7 @@ func TestContributorsGet(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/contributors", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetContributorsHandler)
+	handler := http.HandlerFunc(testServer.GetContributorsHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"munchserver/middleware"
+	"munchserver/validation"
+	"net/http"
+	"strings"
+)
+
+// Error codes clients can check for, the message explains the error to a person
+const (
+	errCodeInvalidJSON        = "invalid_json"
+	errCodeMissingField       = "missing_field"
+	errCodeInvalidField       = "invalid_field"
+	errCodeInvalidCredentials = "invalid_credentials"
+	errCodeUnauthorized       = middleware.ErrCodeUnauthorized
+	errCodeForbidden          = middleware.ErrCodeForbidden
+	errCodeNotFound           = "not_found"
+	errCodeConflict           = "conflict"
+	errCodeDuplicateEmail     = "duplicate_email"
+	errCodeWeakPassword       = "weak_password"
+	errCodeAccountLocked      = "account_locked"
+	errCodeTooManyAttempts    = "too_many_attempts"
+	errCodeTooLarge           = "too_large"
+	errCodeUploadFailed       = "upload_failed"
+	errCodeNotImplemented     = "not_implemented"
+	errCodeInternal           = "internal_error"
+)
+
+// The error envelope is shared with the middleware, so every error response looks the same
+type (
+	errorDetail   = middleware.ErrorDetail
+	errorResponse = middleware.ErrorResponse
+)
+
+// writeError responds with the status and an error envelope
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string, details ...errorDetail) {
+	middleware.WriteError(w, r, status, code, message, details...)
+}
+
+// writeInvalidJSON responds that the request body couldn't be decoded, pointing at the field when the decoder knows it
+func writeInvalidJSON(w http.ResponseWriter, r *http.Request, err error) {
+	var details []errorDetail
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		details = append(details, errorDetail{
+			Field:   typeError.Field,
+			Code:    errCodeInvalidField,
+			Message: "Expected a " + typeError.Type.String() + " but got a " + typeError.Value,
+		})
+	} else if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		details = append(details, errorDetail{
+			Field:   strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`),
+			Code:    errCodeInvalidField,
+			Message: "Field is not allowed",
+		})
+	}
+	writeError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body could not be decoded", details...)
+}
+
+// writeMissingField responds that a required field, like a route param, is missing
+func writeMissingField(w http.ResponseWriter, r *http.Request, field string) {
+	writeValidationErrors(w, r, []validation.FieldError{validation.Missing(field)})
+}
+
+// writeValidationErrors responds with every field that failed validation if any did, returning true when it did
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, fieldErrors []validation.FieldError) bool {
+	if len(fieldErrors) == 0 {
+		return false
+	}
+
+	// Requests that only left out fields are missing fields, anything else is invalid
+	code := errCodeMissingField
+	message := "Request is missing required fields"
+	details := make([]errorDetail, len(fieldErrors))
+	for i, fieldError := range fieldErrors {
+		details[i] = errorDetail{
+			Field:   fieldError.Field,
+			Code:    fieldError.Code,
+			Message: fieldError.Message,
+		}
+		if fieldError.Code != validation.CodeRequired {
+			code = errCodeInvalidField
+			message = "Request has missing or invalid fields"
+		}
+	}
+	writeError(w, r, http.StatusBadRequest, code, message, details...)
+	return true
+}
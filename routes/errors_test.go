@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"encoding/json"
+	"munchserver/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorResponseRequestID(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users/", nil)
+	req.Header.Set("X-Request-ID", "testrequest")
+	rr := httptest.NewRecorder()
+	handler := middleware.RequestID(http.HandlerFunc(testServer.GetUserHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("getting user with no id expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.RequestID != "testrequest" || rr.Header().Get("X-Request-ID") != "testrequest" {
+		t.Errorf("expected the request id from the header, but got %v", response.Error.RequestID)
+	}
+	if response.Error.Code != errCodeMissingField || len(response.Error.Details) != 1 || response.Error.Details[0].Field != "userID" {
+		t.Errorf("expected missing userID error, but got %v", response.Error)
+	}
+}
+
+func TestErrorResponseUnsafeRequestID(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users/", nil)
+	req.Header.Set("X-Request-ID", "bad id\nwith a newline")
+	rr := httptest.NewRecorder()
+	handler := middleware.RequestID(http.HandlerFunc(testServer.GetUserHandler))
+	handler.ServeHTTP(rr, req)
+
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.RequestID == "" || response.Error.RequestID == "bad id\nwith a newline" {
+		t.Errorf("expected a new request id, but got %q", response.Error.RequestID)
+	}
+	if rr.Header().Get("X-Request-ID") != response.Error.RequestID {
+		t.Errorf("expected the response header to have request id %v, but got %v", response.Error.RequestID, rr.Header().Get("X-Request-ID"))
+	}
+}
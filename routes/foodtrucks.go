@@ -1,79 +1,60 @@
 package routes
 
 import (
-	"bytes"
 	"encoding/json"
 	"log"
-	"munchserver/dbutils"
 	"munchserver/middleware"
 	"munchserver/models"
+	"munchserver/store"
+	"munchserver/validation"
 	"net/http"
-	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type addFoodTruckRequest struct {
-	Name        *string       `json:"name"`
-	Address     *string       `json:"address"`
-	Location    *[2]float64   `json:"location"`
-	Hours       *[7][2]string `json:"hours"`
-	Photos      []string      `json:"photos"`
-	Website     string        `json:"website"`
-	PhoneNumber string        `json:"phoneNumber"`
-	Description string        `json:"description"`
-	Tags        []string      `json:"tags"`
+	Name        *string       `json:"name" validate:"required,max=100"`
+	Address     *string       `json:"address" validate:"required,max=200"`
+	Location    *[2]float64   `json:"location" validate:"required,lonlat"`
+	Hours       *[7][2]string `json:"hours" validate:"required,hours"`
+	Photos      []string      `json:"photos" validate:"max=20,dive,url,max=500"`
+	Website     string        `json:"website" validate:"url,max=200"`
+	PhoneNumber string        `json:"phoneNumber" validate:"phone"`
+	Description string        `json:"description" validate:"max=2000"`
+	Tags        []string      `json:"tags" validate:"max=20,dive,max=30"`
 }
 
 type updateFoodTruckRequest struct {
-	Name        *string       `json:"name"`
-	Address     *string       `json:"address"`
-	Location    *[2]float64   `json:"location"`
+	Name        *string       `json:"name" validate:"max=100"`
+	Address     *string       `json:"address" validate:"max=200"`
+	Location    *[2]float64   `json:"location" validate:"lonlat"`
 	Status      *bool         `json:"status"`
-	Hours       *[7][2]string `json:"hours"`
-	Photos      []string      `json:"photos"`
-	Website     *string       `json:"website"`
-	PhoneNumber *string       `json:"phoneNumber"`
-	Description *string       `json:"description"`
-	Tags        []string      `json:"tags"`
+	Hours       *[7][2]string `json:"hours" validate:"hours"`
+	Website     *string       `json:"website" validate:"url,max=200"`
+	PhoneNumber *string       `json:"phoneNumber" validate:"phone"`
+	Description *string       `json:"description" validate:"max=2000"`
+	Tags        []string      `json:"tags" validate:"max=20,dive,max=30"`
 }
 
-type foodTruckWithDistance struct {
-	ID          string       `json:"id" bson:"_id"`
-	Name        string       `json:"name" bson:"name"`
-	Address     string       `json:"address" bson:"address"`
-	Location    [2]float64   `json:"location" bson:"location"`
-	Owner       string       `json:"owner" bson:"owner"`
-	Status      bool         `json:"status" bson:"status"`
-	AvgRating   float64      `json:"avgRating" bson:"avgRating"`
-	Hours       [7][2]string `json:"hours" bson:"hours"`
-	Reviews     []string     `json:"reviews" bson:"reviews"`
-	Photos      []string     `json:"photos" bson:"photos"`
-	Website     string       `json:"website" bson:"website"`
-	PhoneNumber string       `json:"phoneNumber" bson:"phoneNumber"`
-	Description string       `json:"description" bson:"description"`
-	Tags        []string     `json:"tags" bson:"tags"`
-	Distance    float64      `json:"distance" bson:"distance"`
-}
-
-func PostFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PostFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user from context
 	user, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
 
-	// Check for a user, or if the user agent is from the scraper
-	if !userLoggedIn && r.Header.Get("User-Agent") != "MunchCritic/1.0" {
-		w.WriteHeader(http.StatusUnauthorized)
+	// Check for a user, or an api key that can add food trucks
+	if !userLoggedIn && !middleware.HasScope(r.Context(), models.ScopeTrucksWrite) {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to add a food truck")
 		return
 	}
 
+	// Food trucks imported by a scraper account are left unclaimed
+	if middleware.HasRole(r.Context(), models.RoleScraper) {
+		user = ""
+	}
+
 	foodTruckDecoder := json.NewDecoder(r.Body)
 	foodTruckDecoder.DisallowUnknownFields()
 
@@ -82,42 +63,39 @@ func PostFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
 	err := foodTruckDecoder.Decode(&newFoodTruck)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidJSON(w, r, err)
 		return
 	}
 
-	// Make sure required fields are set
-	if newFoodTruck.Name == nil ||
-		newFoodTruck.Address == nil ||
-		newFoodTruck.Location == nil ||
-		newFoodTruck.Hours == nil {
-		w.WriteHeader(http.StatusBadRequest)
+	// Make sure required fields are set and every field is valid
+	if writeValidationErrors(w, r, validation.Struct(&newFoodTruck)) {
 		return
 	}
 
-	// Validate hours
-	for i := 0; i < 7; i++ {
-		validOpenTime, _ := regexp.MatchString(`^\d{2}:\d{2}$`, newFoodTruck.Hours[i][0])
-		validCloseTime, _ := regexp.MatchString(`^\d{2}:\d{2}$`, newFoodTruck.Hours[i][1])
-		if !validOpenTime || !validCloseTime {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-
-	// Generate uuid for food truck
-	uuid, _ := uuid.NewRandom()
-
 	// Set tags to an empty array if they don't exist
 	tags := newFoodTruck.Tags
 	if tags == nil {
 		tags = []string{}
 	}
-	photos := newFoodTruck.Photos
-	if photos == nil {
-		photos = []string{}
+
+	// Photos added by url are shown in the order they were given, the first being the cover photo
+	created := time.Now()
+	photos := make([]models.JSONPhoto, len(newFoodTruck.Photos))
+	for i, photoURL := range newFoodTruck.Photos {
+		photoID, _ := uuid.NewRandom()
+		photos[i] = models.JSONPhoto{
+			ID:       photoID.String(),
+			URL:      photoURL,
+			Uploader: user,
+			Created:  created,
+			Cover:    i == 0,
+			Order:    i,
+		}
 	}
 
+	// Generate uuid for food truck
+	uuid, _ := uuid.NewRandom()
+
 	addedFoodTruck := models.JSONFoodTruck{
 		ID:          uuid.String(),
 		Name:        *newFoodTruck.Name,
@@ -131,22 +109,29 @@ func PostFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
 		PhoneNumber: newFoodTruck.PhoneNumber,
 		Description: newFoodTruck.Description,
 		Tags:        tags,
+		Created:     created,
 	}
 
 	// Add food truck to database
-	_, err = Db.Collection("foodTrucks").InsertOne(r.Context(), addedFoodTruck)
+	err = s.FoodTrucks.Add(r.Context(), addedFoodTruck)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck could not be added")
 		return
 	}
 
 	// Update user that owns food truck
 	if user != "" {
-		_, err = Db.Collection("users").UpdateOne(r.Context(), dbutils.WithIDQuery(user), dbutils.PushOwnedFoodTruck(uuid.String()))
+		err = s.Users.AddOwnedFoodTruck(r.Context(), user, uuid.String())
 		if err != nil {
 			log.Printf("ERROR: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck owner could not be updated")
+			return
+		}
+		err = s.Users.AddRole(r.Context(), user, models.RoleOwner)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food truck owner could not be updated")
 			return
 		}
 	}
@@ -156,21 +141,20 @@ func PostFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(addedFoodTruck)
 }
 
-func GetFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
 	// Get food truck id from route params
 	params := mux.Vars(r)
 	foodTruckID, foodTruckIDExists := params["foodTruckID"]
 	if !foodTruckIDExists {
-		w.WriteHeader(http.StatusBadRequest)
+		writeMissingField(w, r, "foodTruckID")
 		return
 	}
 
 	// Get food truck from database
-	var foodTruck models.JSONFoodTruck
-	err := Db.Collection("foodTrucks").FindOne(r.Context(), dbutils.WithIDQuery(foodTruckID)).Decode(&foodTruck)
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
 		return
 	}
 
@@ -179,249 +163,222 @@ func GetFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(foodTruck)
 }
 
-func GetFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
-
-	// Get all foodtrucks from the database into a cursor
-	foodTrucksCollection := Db.Collection("foodTrucks")
-
-	// Parse location from query params
-	var location []float64
-	if r.URL.Query().Get("lon") != "" || r.URL.Query().Get("lat") != "" {
-		// Get location from query params
-		longitude, err := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		latitude, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		location = []float64{longitude, latitude}
+func (s *Server) GetFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse filters and sort order from query params
+	query, valid := parseFoodTruckQuery(w, r)
+	if !valid {
+		return
 	}
 
-	// Create correct filter
-	var filter bson.M
-
-	query := r.URL.Query().Get("query")
+	page, valid := parsePage(w, r)
+	if !valid {
+		return
+	}
 
-	// Create correct filter if have tags or name
-	if query != "" {
+	// Get a page of food trucks from database, closest first if there is a location and no other order
+	foodTrucks, nextCursor, err := s.FoodTrucks.List(r.Context(), query, page)
+	if err == store.ErrInvalidCursor {
+		writeInvalidCursor(w, r)
+		return
+	}
+	if err != nil && query.Near != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Food trucks near the location could not be found")
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Food trucks could not be found")
+		return
+	}
 
-		// Create name regex
-		queryParams := strings.Split(query, " ")
+	// Send response
+	writePage(w, foodTrucks, nextCursor)
+}
 
-		// Set regex as case insensitive
-		nameRegex := "(?i)"
-		for i, query := range queryParams {
-			nameRegex += "(" + query + ")"
-			if i < len(queryParams)-1 {
-				nameRegex += "|"
-			}
+// foodTruckSorts are the orders food trucks can be listed in
+var foodTruckSorts = map[string]bool{
+	store.SortDistance:    true,
+	store.SortRating:      true,
+	store.SortReviewCount: true,
+	store.SortName:        true,
+	store.SortNewest:      true,
+}
 
-		}
+// parseFoodTruckQuery gets what food trucks are listed by from the query params. It writes an error and returns false
+// if any of them aren't valid.
+func parseFoodTruckQuery(w http.ResponseWriter, r *http.Request) (store.FoodTruckQuery, bool) {
+	params := r.URL.Query()
+	query := store.FoodTruckQuery{Text: params.Get("query")}
 
-		// Filter for tags and name
-		tagsParam := []interface{}{
-			bson.M{"tags": bson.M{"$regex": nameRegex}},
-			bson.M{"name": bson.M{"$regex": nameRegex}},
-		}
-		filter = bson.M{"$or": tagsParam}
-
-	} else {
-		filter = dbutils.AllQuery()
-	}
-
-	var cur *mongo.Cursor
-	var err error
-	if location != nil {
-		geoStage := bson.D{
-			{"$geoNear", bson.M{
-				"near": bson.M{
-					"type":        "Point",
-					"coordinates": location,
-				},
-				"distanceField": "distance",
-				"spherical":     true,
-				"query":         filter,
-			}},
-		}
-		cur, err = foodTrucksCollection.Aggregate(r.Context(), mongo.Pipeline{geoStage})
+	// Parse location from query params
+	if params.Get("lon") != "" || params.Get("lat") != "" {
+		// Get location from query params
+		longitude, err := strconv.ParseFloat(params.Get("lon"), 64)
 		if err != nil {
 			log.Printf("ERROR: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Location is not valid", errorDetail{Field: "lon", Code: errCodeInvalidField, Message: "Expected a number"})
+			return store.FoodTruckQuery{}, false
 		}
-	} else {
-		cur, err = foodTrucksCollection.Find(r.Context(), filter)
+		latitude, err := strconv.ParseFloat(params.Get("lat"), 64)
 		if err != nil {
 			log.Printf("ERROR: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Location is not valid", errorDetail{Field: "lat", Code: errCodeInvalidField, Message: "Expected a number"})
+			return store.FoodTruckQuery{}, false
+		}
+		if longitude < -180 || longitude > 180 || latitude < -90 || latitude > 90 {
+			writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Location is not valid",
+				errorDetail{Field: "lon", Code: validation.CodeOutOfRange, Message: "Longitude must be between -180 and 180"},
+				errorDetail{Field: "lat", Code: validation.CodeOutOfRange, Message: "Latitude must be between -90 and 90"})
+			return store.FoodTruckQuery{}, false
 		}
+		query.Near = &[2]float64{longitude, latitude}
 	}
 
-	// Get users from cursor, convert to empty slice if no users in DB
-	var foodTrucks []foodTruckWithDistance
-	err = cur.All(r.Context(), &foodTrucks)
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	// Only food trucks within the distance of the location
+	var valid bool
+	query.MaxDistance, valid = parseFloatParam(w, r, "maxDistance")
+	if !valid {
+		return store.FoodTruckQuery{}, false
 	}
-	if foodTrucks == nil {
-		foodTrucks = make([]foodTruckWithDistance, 0)
+	if query.MaxDistance != nil && query.Near == nil {
+		writeValidationErrors(w, r, []validation.FieldError{validation.Missing("lat"), validation.Missing("lon")})
+		return store.FoodTruckQuery{}, false
 	}
-
-	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(foodTrucks)
-}
-
-func PutFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
-
-	// Checks for food truck ID
-	params := mux.Vars(r)
-	foodTruckID, foodTruckIDExists := params["foodTruckID"]
-	if !foodTruckIDExists {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	if query.MaxDistance != nil && *query.MaxDistance <= 0 {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Distance is not valid", errorDetail{Field: "maxDistance", Code: validation.CodeOutOfRange, Message: "Distance must be more than 0 meters"})
+		return store.FoodTruckQuery{}, false
 	}
 
-	// Get user from context
-	_, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
-
-	// Check for a user
-	if !userLoggedIn {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
+	// Only food trucks rated at least as high
+	query.MinRating, valid = parseFloatParam(w, r, "minRating")
+	if !valid {
+		return store.FoodTruckQuery{}, false
 	}
-
-	foodTruckDecoder := json.NewDecoder(r.Body)
-	foodTruckDecoder.DisallowUnknownFields()
-
-	// Decode request
-	var currentFoodTruck updateFoodTruckRequest
-	err := foodTruckDecoder.Decode(&currentFoodTruck)
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	if query.MinRating != nil && (*query.MinRating < 0 || *query.MinRating > 5) {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Rating is not valid", errorDetail{Field: "minRating", Code: validation.CodeOutOfRange, Message: "Rating must be between 0 and 5"})
+		return store.FoodTruckQuery{}, false
 	}
 
-	// Determine which fields should be updated
-	var updateData bson.D
-
-	if currentFoodTruck.Name != nil {
-		updateData = append(updateData, bson.E{"name", *currentFoodTruck.Name})
-	}
-	if currentFoodTruck.Address != nil {
-		updateData = append(updateData, bson.E{"address", *currentFoodTruck.Address})
-	}
-	if currentFoodTruck.Location != nil {
-		updateData = append(updateData, bson.E{"location", *currentFoodTruck.Location})
-	}
-	if currentFoodTruck.Status != nil {
-		updateData = append(updateData, bson.E{"status", *currentFoodTruck.Status})
-	}
-	// Validate hours if updating
-	if currentFoodTruck.Hours != nil {
-		for i := 0; i < 7; i++ {
-			validOpenTime, err := regexp.MatchString(`^\d{2}:\d{2}$`, currentFoodTruck.Hours[i][0])
-			if err != nil {
-				log.Printf("ERROR: %v", err)
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-			validCloseTime, err := regexp.MatchString(`^\d{2}:\d{2}$`, currentFoodTruck.Hours[i][1])
-			if err != nil {
-				log.Printf("ERROR: %v", err)
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-			if !validOpenTime || !validCloseTime {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
+	// Only food trucks with all of the comma separated tags, or any of them
+	for _, tag := range strings.Split(params.Get("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			query.Tags = append(query.Tags, tag)
 		}
-		updateData = append(updateData, bson.E{"hours", *currentFoodTruck.Hours})
 	}
-	if currentFoodTruck.Photos != nil {
-		updateData = append(updateData, bson.E{"photos", currentFoodTruck.Photos})
+	switch params.Get("tagMatch") {
+	case "", "all":
+	case "any":
+		query.AnyTag = true
+	default:
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Tag match is not valid", errorDetail{Field: "tagMatch", Code: errCodeInvalidField, Message: "Expected all or any"})
+		return store.FoodTruckQuery{}, false
 	}
-	if currentFoodTruck.Website != nil {
-		updateData = append(updateData, bson.E{"website", *currentFoodTruck.Website})
+
+	// Only food trucks that are serving or not, and that are claimed by an owner or not
+	query.Status, valid = parseBoolParam(w, r, "status")
+	if !valid {
+		return store.FoodTruckQuery{}, false
 	}
-	if currentFoodTruck.PhoneNumber != nil {
-		updateData = append(updateData, bson.E{"phoneNumber", *currentFoodTruck.PhoneNumber})
+	query.Claimed, valid = parseBoolParam(w, r, "claimed")
+	if !valid {
+		return store.FoodTruckQuery{}, false
 	}
-	if currentFoodTruck.Description != nil {
-		updateData = append(updateData, bson.E{"description", *currentFoodTruck.Description})
+
+	// Sort order, food trucks can only be sorted by distance from a location
+	query.Sort = params.Get("sort")
+	if query.Sort != "" && !foodTruckSorts[query.Sort] {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Sort is not valid", errorDetail{Field: "sort", Code: errCodeInvalidField, Message: "Expected distance, rating, reviewCount, name or newest"})
+		return store.FoodTruckQuery{}, false
 	}
-	if currentFoodTruck.Tags != nil {
-		updateData = append(updateData, bson.E{"tags", currentFoodTruck.Tags})
+	if query.Sort == store.SortDistance && query.Near == nil {
+		writeValidationErrors(w, r, []validation.FieldError{validation.Missing("lat"), validation.Missing("lon")})
+		return store.FoodTruckQuery{}, false
 	}
+	return query, true
+}
 
-	// Update food truck document
-	update := bson.D{
-		{"$set", updateData},
+// parseFloatParam gets a number query param, nil if it isn't set. It writes an error and returns false if it isn't a
+// number.
+func parseFloatParam(w http.ResponseWriter, r *http.Request, name string) (*float64, bool) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return nil, true
 	}
-
-	_, err = Db.Collection("foodTrucks").UpdateOne(r.Context(), dbutils.WithIDQuery(foodTruckID), update)
+	value, err := strconv.ParseFloat(param, 64)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Query is not valid", errorDetail{Field: name, Code: errCodeInvalidField, Message: "Expected a number"})
+		return nil, false
 	}
+	return &value, true
+}
 
-	// Send response
-	w.WriteHeader(http.StatusOK)
+// parseBoolParam gets a true or false query param, nil if it isn't set. It writes an error and returns false if it
+// isn't true or false.
+func parseBoolParam(w http.ResponseWriter, r *http.Request, name string) (*bool, bool) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return nil, true
+	}
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Query is not valid", errorDetail{Field: name, Code: errCodeInvalidField, Message: "Expected true or false"})
+		return nil, false
+	}
+	return &value, true
 }
 
-func PutClaimFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PutFoodTrucksHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Checks for food truck ID
 	params := mux.Vars(r)
 	foodTruckID, foodTruckIDExists := params["foodTruckID"]
 	if !foodTruckIDExists {
-		w.WriteHeader(http.StatusBadRequest)
+		writeMissingField(w, r, "foodTruckID")
 		return
 	}
 
 	// Get user from context
-	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+	_, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
 
 	// Check for a user
 	if !userLoggedIn {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to update a food truck")
 		return
 	}
 
-	// Lookup food truck in db
-	var foodTruck models.JSONFoodTruck
-	err := Db.Collection("foodTrucks").FindOne(r.Context(), dbutils.WithIDQuery(foodTruckID)).Decode(&foodTruck)
+	foodTruckDecoder := json.NewDecoder(r.Body)
+	foodTruckDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var currentFoodTruck updateFoodTruckRequest
+	err := foodTruckDecoder.Decode(&currentFoodTruck)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusNotFound)
+		writeInvalidJSON(w, r, err)
 		return
 	}
 
-	// Set food truck owner
-	_, err = Db.Collection("foodTrucks").UpdateOne(r.Context(), dbutils.WithIDQuery(foodTruckID), dbutils.SetFoodTruckOwner(userID))
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	// Validate the fields being updated
+	if writeValidationErrors(w, r, validation.Struct(&currentFoodTruck)) {
 		return
 	}
 
-	// Add food truck to user
-	_, err = Db.Collection("users").UpdateOne(r.Context(), dbutils.WithIDQuery(userID), dbutils.PushOwnedFoodTruck(foodTruckID))
+	// Update food truck document
+	err = s.FoodTrucks.Update(r.Context(), foodTruckID, store.FoodTruckUpdate{
+		Name:        currentFoodTruck.Name,
+		Address:     currentFoodTruck.Address,
+		Location:    currentFoodTruck.Location,
+		Status:      currentFoodTruck.Status,
+		Hours:       currentFoodTruck.Hours,
+		Website:     currentFoodTruck.Website,
+		PhoneNumber: currentFoodTruck.PhoneNumber,
+		Description: currentFoodTruck.Description,
+		Tags:        currentFoodTruck.Tags,
+	})
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Food truck could not be updated")
 		return
 	}
 
@@ -429,74 +386,38 @@ func PutClaimFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func PutFoodTruckUploadHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PutFoodTruckUploadHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Checks for food truck ID
 	params := mux.Vars(r)
 	foodTruckID, foodTruckIDExists := params["foodTruckID"]
 	if !foodTruckIDExists {
-		w.WriteHeader(http.StatusBadRequest)
+		writeMissingField(w, r, "foodTruckID")
 		return
 	}
 
 	// Get user from context
-	_, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+	user, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
 
 	// Check for a user, or if the user agent is from the scraper
 	if !userLoggedIn {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to upload a photo")
 		return
 	}
 
-	err := r.ParseMultipartForm(1024000 * 4)
+	// Get the food truck's photos to put the new photo after them
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
 		return
 	}
 
-	file, fileHeader, err := r.FormFile("image")
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	if filepath.Ext(fileHeader.Filename) != ".jpg" {
-		w.WriteHeader(http.StatusBadRequest)
+	// Resize and upload image
+	image, uploaded := s.uploadImage(w, r)
+	if !uploaded {
 		return
 	}
 
-	defer file.Close()
-	size := fileHeader.Size
-	buffer := make([]byte, size)
-	file.Read(buffer)
-
-	// Generate a random uuidv4
-	uuid, err := uuid.NewRandom()
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Create file name for image
-	filename := uuid.String() + filepath.Ext(fileHeader.Filename)
-
-	// Upload image to s3
-	result, err := Uploader.UploadWithContext(r.Context(), &s3manager.UploadInput{
-		Bucket: aws.String("munch-assets"),
-		Key:    aws.String(filename),
-		Body:   bytes.NewReader(buffer),
-	})
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusConflict)
-		return
-	}
-
-	_, err = Db.Collection("foodTrucks").UpdateOne(r.Context(), dbutils.WithIDQuery(foodTruckID), dbutils.PushPhoto(result.Location))
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	s.addUploadedPhoto(w, r, foodTruck, user, image)
 }
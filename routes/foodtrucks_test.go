@@ -3,12 +3,16 @@ package routes
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"munchserver/models"
+	"munchserver/store"
 	"munchserver/tests"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -18,7 +22,7 @@ func TestFoodTrucksGetEmpty(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -26,8 +30,8 @@ func TestFoodTrucksGetEmpty(t *testing.T) {
 		t.Errorf("getting all food trucks expected status code of %v, but got %v", expected, rr.Code)
 	}
 	body, _ := ioutil.ReadAll(rr.Body)
-	if string(body) != "[]\n" {
-		t.Errorf("expected empty array, but got %v", string(body))
+	if string(body) != "{\"items\":[]}\n" {
+		t.Errorf("expected page without items, but got %v", string(body))
 	}
 }
 
@@ -41,7 +45,7 @@ func TestFoodTrucksGetSingle(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -49,8 +53,9 @@ func TestFoodTrucksGetSingle(t *testing.T) {
 		t.Errorf("getting all food trucks expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var foodTrucks []models.JSONFoodTruck
-	json.NewDecoder(rr.Body).Decode(&foodTrucks)
+	var page foodTruckPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	foodTrucks := page.Items
 	if len(foodTrucks) != 1 {
 		t.Errorf("expected array with one element, but got %v", foodTrucks)
 	}
@@ -64,7 +69,7 @@ func TestFoodTrucksGetInvalidLat(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks?lat=joe's house&lon=-97.735592", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -78,7 +83,7 @@ func TestFoodTrucksGetInvalidLon(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks?lat=30.288441&lon=joe's house", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -92,7 +97,7 @@ func TestFoodTrucksGetInvalidLatLon(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks?lat=-97.735592&lon=30.288441", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -111,7 +116,7 @@ func TestFoodTrucksGetDistance(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks?lat=30.288441&lon=-97.735592", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -119,8 +124,9 @@ func TestFoodTrucksGetDistance(t *testing.T) {
 		t.Errorf("getting all food trucks expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var foodTrucks []foodTruckWithDistance
-	json.NewDecoder(rr.Body).Decode(&foodTrucks)
+	var page foodTruckPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	foodTrucks := page.Items
 	if len(foodTrucks) != 1 {
 		t.Errorf("expected array with one element, but got %v", foodTrucks)
 	}
@@ -155,7 +161,7 @@ func TestFoodTrucksGetSortOrder(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks?lat=30.288441&lon=-97.735592", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -163,8 +169,9 @@ func TestFoodTrucksGetSortOrder(t *testing.T) {
 		t.Errorf("getting all food trucks expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var foodTrucks []models.JSONFoodTruck
-	json.NewDecoder(rr.Body).Decode(&foodTrucks)
+	var page foodTruckPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	foodTrucks := page.Items
 	if len(foodTrucks) != 3 {
 		t.Errorf("expected array with three element, but got %v", foodTrucks)
 	}
@@ -179,12 +186,251 @@ func TestFoodTrucksGetSortOrder(t *testing.T) {
 	}
 }
 
+func TestFoodTrucksGetPages(t *testing.T) {
+	tests.ClearDB()
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test3"})
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test1"})
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test2"})
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
+
+	var first foodTruckPage
+	getTestPage(t, handler, "/foodtrucks?limit=2", &first)
+	if len(first.Items) != 2 || first.Items[0].ID != "test1" || first.Items[1].ID != "test2" {
+		t.Errorf("expected first page to have test1 and test2, but got %v", first.Items)
+	}
+	if first.NextCursor == "" {
+		t.Fatalf("expected first page to have a next cursor")
+	}
+
+	var second foodTruckPage
+	getTestPage(t, handler, "/foodtrucks?limit=2&cursor="+first.NextCursor, &second)
+	if len(second.Items) != 1 || second.Items[0].ID != "test3" {
+		t.Errorf("expected second page to have test3, but got %v", second.Items)
+	}
+	if second.NextCursor != "" {
+		t.Errorf("expected last page not to have a next cursor, but got %v", second.NextCursor)
+	}
+}
+
+func TestFoodTrucksGetPagesNear(t *testing.T) {
+	tests.ClearDB()
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test1", Location: [2]float64{-97.742496, 30.286302}})
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test2", Location: [2]float64{-97.744605, 30.290466}})
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test3", Location: [2]float64{-97.739928, 30.290241}})
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
+
+	var first foodTruckPage
+	getTestPage(t, handler, "/foodtrucks?lat=30.288441&lon=-97.735592&limit=2", &first)
+	if len(first.Items) != 2 || first.Items[0].ID != "test3" || first.Items[1].ID != "test1" {
+		t.Errorf("expected first page to have the two closest food trucks, but got %v", first.Items)
+	}
+
+	var second foodTruckPage
+	getTestPage(t, handler, "/foodtrucks?lat=30.288441&lon=-97.735592&limit=2&cursor="+first.NextCursor, &second)
+	if len(second.Items) != 1 || second.Items[0].ID != "test2" {
+		t.Errorf("expected second page to have the farthest food truck, but got %v", second.Items)
+	}
+	if second.NextCursor != "" {
+		t.Errorf("expected last page not to have a next cursor, but got %v", second.NextCursor)
+	}
+}
+
+func TestFoodTrucksGetLimitTooLarge(t *testing.T) {
+	tests.ClearDB()
+	for i := 0; i <= store.MaxPageLimit; i++ {
+		tests.AddFoodTruck(models.JSONFoodTruck{ID: fmt.Sprintf("test%03d", i)})
+	}
+
+	var page foodTruckPage
+	getTestPage(t, http.HandlerFunc(testServer.GetFoodTrucksHandler), "/foodtrucks?limit=1000", &page)
+	if len(page.Items) != store.MaxPageLimit || page.NextCursor == "" {
+		t.Errorf("expected page of %v food trucks with a next cursor, but got %v food trucks", store.MaxPageLimit, len(page.Items))
+	}
+}
+
+func TestFoodTrucksGetInvalidLimit(t *testing.T) {
+	tests.ClearDB()
+
+	for _, limit := range []string{"0", "-1", "all"} {
+		req, _ := http.NewRequest("GET", "/foodtrucks?limit="+limit, nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
+		handler.ServeHTTP(rr, req)
+
+		expected := http.StatusBadRequest
+		if rr.Code != expected {
+			t.Errorf("getting food trucks with limit %v expected status code of %v, but got %v", limit, expected, rr.Code)
+		}
+	}
+}
+
+func TestFoodTrucksGetInvalidCursor(t *testing.T) {
+	tests.ClearDB()
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test1"})
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test2"})
+
+	// A cursor only continues the list it came from
+	var page foodTruckPage
+	getTestPage(t, http.HandlerFunc(testServer.GetFoodTrucksHandler), "/foodtrucks?limit=1", &page)
+
+	for _, url := range []string{
+		"/foodtrucks?cursor=notacursor",
+		"/foodtrucks?lat=30.288441&lon=-97.735592&cursor=" + page.NextCursor,
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
+		handler.ServeHTTP(rr, req)
+
+		expected := http.StatusBadRequest
+		if rr.Code != expected {
+			t.Errorf("getting food trucks %v expected status code of %v, but got %v", url, expected, rr.Code)
+		}
+	}
+}
+
+// addFilterTestFoodTrucks adds food trucks that are each kept or left out by different filters, kins being the closest
+// and 26th the farthest from the location the tests search near
+func addFilterTestFoodTrucks() {
+	date := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:        "kins",
+		Name:      "Kins",
+		Location:  [2]float64{-97.739928, 30.290241},
+		Owner:     "testuser",
+		Status:    true,
+		AvgRating: 4.5,
+		Reviews:   []string{"review1"},
+		Tags:      []string{"tacos", "vegan"},
+		Created:   date,
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:        "coop",
+		Name:      "Coop",
+		Location:  [2]float64{-97.742496, 30.286302},
+		Status:    false,
+		AvgRating: 3,
+		Reviews:   []string{"review2", "review3", "review4"},
+		Tags:      []string{"tacos"},
+		Created:   date.Add(2 * time.Hour),
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:        "26th",
+		Name:      "26th",
+		Location:  [2]float64{-97.744605, 30.290466},
+		Status:    true,
+		AvgRating: 2,
+		Reviews:   []string{"review5", "review6"},
+		Tags:      []string{"bbq"},
+		Created:   date.Add(time.Hour),
+	})
+}
+
+// foodTruckIDs lists the ids of the food trucks in a page
+func foodTruckIDs(foodTrucks []store.FoodTruckWithDistance) []string {
+	ids := make([]string, len(foodTrucks))
+	for i, foodTruck := range foodTrucks {
+		ids[i] = foodTruck.ID
+	}
+	return ids
+}
+
+func TestFoodTrucksGetFilters(t *testing.T) {
+	tests.ClearDB()
+	addFilterTestFoodTrucks()
+
+	for url, expected := range map[string][]string{
+		"/foodtrucks?minRating=3":                                                {"coop", "kins"},
+		"/foodtrucks?tags=tacos,vegan":                                           {"kins"},
+		"/foodtrucks?tags=vegan,bbq&tagMatch=any":                                {"26th", "kins"},
+		"/foodtrucks?status=true":                                                {"26th", "kins"},
+		"/foodtrucks?claimed=true":                                               {"kins"},
+		"/foodtrucks?claimed=false":                                              {"26th", "coop"},
+		"/foodtrucks?tags=tacos&status=false":                                    {"coop"},
+		"/foodtrucks?lat=30.288441&lon=-97.735592&maxDistance=800":               {"kins", "coop"},
+		"/foodtrucks?lat=30.288441&lon=-97.735592&maxDistance=800&claimed=false": {"coop"},
+	} {
+		var page foodTruckPage
+		getTestPage(t, http.HandlerFunc(testServer.GetFoodTrucksHandler), url, &page)
+		if ids := foodTruckIDs(page.Items); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("getting food trucks %v expected %v, but got %v", url, expected, ids)
+		}
+	}
+}
+
+func TestFoodTrucksGetSorts(t *testing.T) {
+	tests.ClearDB()
+	addFilterTestFoodTrucks()
+
+	for url, expected := range map[string][]string{
+		"/foodtrucks?sort=rating":                                         {"kins", "coop", "26th"},
+		"/foodtrucks?sort=reviewCount":                                    {"coop", "26th", "kins"},
+		"/foodtrucks?sort=name":                                           {"26th", "coop", "kins"},
+		"/foodtrucks?sort=newest":                                         {"coop", "26th", "kins"},
+		"/foodtrucks?lat=30.288441&lon=-97.735592&sort=distance":          {"kins", "coop", "26th"},
+		"/foodtrucks?lat=30.288441&lon=-97.735592&sort=rating&tags=tacos": {"kins", "coop"},
+	} {
+		var page foodTruckPage
+		getTestPage(t, http.HandlerFunc(testServer.GetFoodTrucksHandler), url, &page)
+		if ids := foodTruckIDs(page.Items); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("getting food trucks %v expected %v, but got %v", url, expected, ids)
+		}
+	}
+}
+
+func TestFoodTrucksGetSortPages(t *testing.T) {
+	tests.ClearDB()
+	addFilterTestFoodTrucks()
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "tied", AvgRating: 3})
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
+
+	// Food trucks with the same rating are listed by id
+	var ids []string
+	url := "/foodtrucks?sort=rating&limit=1"
+	for i := 0; i < 4; i++ {
+		var page foodTruckPage
+		getTestPage(t, handler, url, &page)
+		ids = append(ids, foodTruckIDs(page.Items)...)
+		url = "/foodtrucks?sort=rating&limit=1&cursor=" + page.NextCursor
+	}
+	expected := []string{"kins", "coop", "tied", "26th"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("getting food trucks by rating a page at a time expected %v, but got %v", expected, ids)
+	}
+}
+
+func TestFoodTrucksGetInvalidFilters(t *testing.T) {
+	tests.ClearDB()
+
+	for _, url := range []string{
+		"/foodtrucks?sort=closest",
+		"/foodtrucks?sort=distance",
+		"/foodtrucks?maxDistance=800",
+		"/foodtrucks?lat=30.288441&lon=-97.735592&maxDistance=-1",
+		"/foodtrucks?minRating=6",
+		"/foodtrucks?minRating=good",
+		"/foodtrucks?status=open",
+		"/foodtrucks?claimed=maybe",
+		"/foodtrucks?tags=tacos&tagMatch=some",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
+		handler.ServeHTTP(rr, req)
+
+		expected := http.StatusBadRequest
+		if rr.Code != expected {
+			t.Errorf("getting food trucks %v expected status code of %v, but got %v", url, expected, rr.Code)
+		}
+	}
+}
+
 func TestFoodTruckGetNoID(t *testing.T) {
 	tests.ClearDB()
 
 	req, _ := http.NewRequest("GET", "/foodtruck", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -202,7 +448,7 @@ func TestFoodTruckGetInvalid(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusNotFound
@@ -225,7 +471,7 @@ func TestFoodTruckGetValid(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -252,7 +498,7 @@ func TestFoodTrucksGetSearchValid(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks?query=testTruck", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -260,8 +506,9 @@ func TestFoodTrucksGetSearchValid(t *testing.T) {
 		t.Errorf("getting valid food truck with name expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var foodTruck []models.JSONFoodTruck
-	json.NewDecoder(rr.Body).Decode(&foodTruck)
+	var page foodTruckPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	foodTruck := page.Items
 
 	if foodTruck[0].Name != "testTruck" {
 		t.Errorf("expected food truck with name testTruck, but got %v", foodTruck[0].Name)
@@ -284,7 +531,7 @@ func TestFoodTrucksGetSearchMultipleValid(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/foodtrucks?query=ice+cream", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.GetFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -292,8 +539,9 @@ func TestFoodTrucksGetSearchMultipleValid(t *testing.T) {
 		t.Errorf("getting valid food truck with name expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var foodTrucks []models.JSONFoodTruck
-	json.NewDecoder(rr.Body).Decode(&foodTrucks)
+	var page foodTruckPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	foodTrucks := page.Items
 
 	if len(foodTrucks) != 1 {
 		t.Errorf("expected one result from search of ice cream, but got %v", len(foodTrucks))
@@ -349,7 +597,7 @@ func TestFoodTrucksPostValid(t *testing.T) {
 	body, _ := json.Marshal(newFoodTruckTest)
 	req, _ := http.NewRequest("POST", "/foodtrucks", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostFoodTrucksHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostFoodTrucksHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -406,7 +654,7 @@ func TestFoodTrucksPostInvalidHours(t *testing.T) {
 	body, _ := json.Marshal(newFoodTruckTest)
 	req, _ := http.NewRequest("POST", "/foodtrucks", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostFoodTrucksHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostFoodTrucksHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -416,6 +664,62 @@ func TestFoodTrucksPostInvalidHours(t *testing.T) {
 
 }
 
+func TestFoodTrucksPostInvalidFields(t *testing.T) {
+	tests.ClearDB()
+
+	name := "Luke's Coffee House"
+	address := "2502 Nueces St\nAustin, TX 78705"
+	location := [2]float64{-197.74731, 30.28793}
+	hours := [7][2]string{
+		[2]string{"10:00", "11:00"},
+		[2]string{"10:00", "11:00"},
+		[2]string{"10:00", "11:00"},
+		[2]string{"10:00", "11:00"},
+		[2]string{"10:00", "11:00"},
+		[2]string{"10:00", "11:00"},
+		[2]string{"18:00", "09:00"},
+	}
+	newFoodTruckTest := addFoodTruckRequest{
+		Name:        &name,
+		Address:     &address,
+		Location:    &location,
+		Hours:       &hours,
+		Photos:      []string{"not a url"},
+		Website:     "www.google.com",
+		PhoneNumber: "12",
+	}
+	body, _ := json.Marshal(newFoodTruckTest)
+
+	req, _ := http.NewRequest("POST", "/foodtrucks", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostFoodTrucksHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("adding food truck with invalid fields expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// Every invalid field should be listed at once
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeInvalidField {
+		t.Errorf("expected error code %v, but got %v", errCodeInvalidField, response.Error.Code)
+	}
+	invalidFields := make(map[string]bool)
+	for _, detail := range response.Error.Details {
+		invalidFields[detail.Field] = true
+	}
+	for _, field := range []string{"location[0]", "hours[6]", "photos[0]", "phoneNumber"} {
+		if !invalidFields[field] {
+			t.Errorf("expected %v to be listed as invalid, but got %v", field, response.Error.Details)
+		}
+	}
+	if len(invalidFields) != 4 {
+		t.Errorf("expected only 4 invalid fields, but got %v", response.Error.Details)
+	}
+}
+
 func TestFoodTrucksPostUnauthorized(t *testing.T) {
 	tests.ClearDB()
 
@@ -424,7 +728,7 @@ func TestFoodTrucksPostUnauthorized(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/foodtrucks", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostFoodTrucksHandler)
+	handler := http.HandlerFunc(testServer.PostFoodTrucksHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusUnauthorized
@@ -441,13 +745,19 @@ func TestFoodTrucksPostInvalidBody(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/foodtrucks", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostFoodTrucksHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostFoodTrucksHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
 	if rr.Code != expected {
 		t.Errorf("adding invalid food truck expected status code of %v, but got %v", expected, rr.Code)
 	}
+
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeInvalidJSON || len(response.Error.Details) != 1 || response.Error.Details[0].Field != "invalidField" {
+		t.Errorf("expected invalid json error for invalidField, but got %v", response.Error)
+	}
 }
 
 func TestFoodTrucksPostInvalid(t *testing.T) {
@@ -458,13 +768,32 @@ func TestFoodTrucksPostInvalid(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/foodtrucks", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostFoodTrucksHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostFoodTrucksHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
 	if rr.Code != expected {
 		t.Errorf("adding invalid food truck expected status code of %v, but got %v", expected, rr.Code)
 	}
+
+	// Every missing field should be listed
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeMissingField {
+		t.Errorf("expected error code %v, but got %v", errCodeMissingField, response.Error.Code)
+	}
+	missingFields := make(map[string]bool)
+	for _, detail := range response.Error.Details {
+		missingFields[detail.Field] = true
+	}
+	for _, field := range []string{"name", "address", "location", "hours"} {
+		if !missingFields[field] {
+			t.Errorf("expected %v to be listed as missing, but got %v", field, response.Error.Details)
+		}
+	}
+	if response.Error.RequestID == "" {
+		t.Error("expected error to have a request id")
+	}
 }
 
 func TestFoodTrucksPostValidMinimum(t *testing.T) {
@@ -486,7 +815,7 @@ func TestFoodTrucksPostValidMinimum(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/foodtrucks", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostFoodTrucksHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostFoodTrucksHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -511,7 +840,7 @@ func TestClaimFoodTruckPutUnauthorized(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PutClaimFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.PutClaimFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusUnauthorized
@@ -525,7 +854,7 @@ func TestClaimFoodTruckPutNoFoodTruck(t *testing.T) {
 
 	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", nil)
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutClaimFoodTruckHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -543,7 +872,7 @@ func TestClaimFoodTruckPutInvalidFoodTruck(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutClaimFoodTruckHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusNotFound
@@ -560,16 +889,21 @@ func TestClaimFoodTruckPutValid(t *testing.T) {
 		OwnedFoodTrucks: []string{},
 	})
 	tests.AddFoodTruck(models.JSONFoodTruck{
-		ID: "testfoodtruck",
+		ID:          "testfoodtruck",
+		PhoneNumber: "8006729102",
 	})
 
-	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", nil)
+	license := "TX-123456"
+	body, _ := json.Marshal(claimFoodTruckRequest{
+		BusinessLicense: &license,
+	})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", bytes.NewBuffer(body))
 	vars := map[string]string{
 		"foodTruckID": "testfoodtruck",
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutClaimFoodTruckHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -577,14 +911,130 @@ func TestClaimFoodTruckPutValid(t *testing.T) {
 		t.Errorf("claiming a valid food truck expected status code of %v, but got %v", expected, rr.Code)
 	}
 
+	if bytes.Contains(rr.Body.Bytes(), []byte("callbackCode")) {
+		t.Error("claiming a valid food truck should not respond with the callback code")
+	}
+	var claim models.JSONClaim
+	json.NewDecoder(rr.Body).Decode(&claim)
+
+	addedClaim := tests.GetClaim(claim.ID)
+	if addedClaim == nil || addedClaim.Status != models.ClaimPending || addedClaim.User != "testuser" {
+		t.Error("claiming a valid food truck should have added a pending claim")
+	}
+	if addedClaim != nil && (addedClaim.PhoneNumber != "8006729102" || len(addedClaim.CallbackCode) != 6) {
+		t.Error("claiming a valid food truck should have set up a callback to the food truck's phone number")
+	}
+
 	foodTruck := tests.GetFoodTruck("testfoodtruck")
-	if foodTruck == nil || foodTruck.Owner != "testuser" {
-		t.Error("claiming a valid food truck should have updated owner of food truck")
+	if foodTruck == nil || foodTruck.Owner != "" {
+		t.Error("claiming a valid food truck should not update owner of food truck until approved")
+	}
+}
+
+func TestClaimFoodTruckPutNoLicense(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID: "testfoodtruck",
+	})
+
+	body, _ := json.Marshal(claimFoodTruckRequest{})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("claiming a food truck without a business license expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestClaimFoodTruckPutNoPhoneNumber(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID: "testfoodtruck",
+	})
+
+	license := "TX-123456"
+	body, _ := json.Marshal(claimFoodTruckRequest{
+		BusinessLicense: &license,
+	})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
 	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler))
+	handler.ServeHTTP(rr, req)
 
-	user := tests.GetUser("testuser")
-	if user == nil || len(user.OwnedFoodTrucks) != 1 || user.OwnedFoodTrucks[0] != "testfoodtruck" {
-		t.Error("claiming a valid food truck should have added food truck to user")
+	expected := http.StatusConflict
+	if rr.Code != expected {
+		t.Errorf("claiming a food truck without a phone number expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestClaimFoodTruckPutOtherPhoneNumber(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:          "testfoodtruck",
+		PhoneNumber: "8006729102",
+	})
+
+	// Claimants can't pick the number that is called back
+	body, _ := json.Marshal(map[string]string{"businessLicenseNumber": "TX-123456", "phoneNumber": "5125550100"})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("claiming a food truck with another phone number expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestClaimFoodTruckPutDuplicate(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:          "testfoodtruck",
+		PhoneNumber: "8006729102",
+	})
+	tests.AddClaim(models.JSONClaim{
+		ID:        "testclaim",
+		FoodTruck: "testfoodtruck",
+		User:      "testuser",
+		Status:    models.ClaimPending,
+	})
+
+	license := "TX-123456"
+	body, _ := json.Marshal(claimFoodTruckRequest{
+		BusinessLicense: &license,
+	})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/claim", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutClaimFoodTruckHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusConflict
+	if rr.Code != expected {
+		t.Errorf("claiming a food truck with a pending claim expected status code of %v, but got %v", expected, rr.Code)
 	}
 }
 
@@ -603,11 +1053,6 @@ func TestPutFoodTrucksHandler(t *testing.T) {
 		[2]string{"10:00", "11:00"},
 		[2]string{"10:00", "11:00"},
 	}
-	photos := []string{
-		"https://s3-media3.fl.yelpcdn.com/bphoto/d-1vKOqcEcRutpQ--jPa9A/o.jpg",
-		"https://s3-media4.fl.yelpcdn.com/bphoto/vXk0bXpV007fSWQiOTlHgg/o.jpg",
-		"https://s3-media2.fl.yelpcdn.com/bphoto/tUJ5gLnfRFhp_v-LUGj8Ww/o.jpg",
-	}
 	website := "www.google.com"
 	phone := "8006729102"
 	description := "testDescription"
@@ -619,7 +1064,6 @@ func TestPutFoodTrucksHandler(t *testing.T) {
 		Address:     &address,
 		Location:    &location,
 		Hours:       &hours,
-		Photos:      photos,
 		Website:     &website,
 		PhoneNumber: &phone,
 		Description: &description,
@@ -634,6 +1078,7 @@ func TestPutFoodTrucksHandler(t *testing.T) {
 	tests.AddFoodTruck(models.JSONFoodTruck{
 		ID:        "testfoodtruck",
 		Name:      "Luke's Covfefe",
+		Owner:     "testuser",
 		Reviews:   []string{"fakereview"},
 		AvgRating: 4.0,
 	})
@@ -645,7 +1090,7 @@ func TestPutFoodTrucksHandler(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutFoodTrucksHandler))
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutFoodTrucksHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -681,9 +1126,6 @@ func TestPutFoodTrucksHandler(t *testing.T) {
 	if len(updatedFoodTruck.Tags) == 0 {
 		t.Error("Lengths of tags did not match.")
 	}
-	if len(updatedFoodTruck.Photos) == 0 {
-		t.Error("Lengths of photos did not match.")
-	}
 
 }
 
@@ -731,6 +1173,7 @@ func TestPutFoodTrucksHandlerInvalidHours(t *testing.T) {
 	tests.AddFoodTruck(models.JSONFoodTruck{
 		ID:        "testfoodtruck",
 		Name:      "Luke's Covfefe",
+		Owner:     "testuser",
 		Reviews:   []string{"fakereview"},
 		AvgRating: 4.0,
 	})
@@ -742,7 +1185,7 @@ func TestPutFoodTrucksHandlerInvalidHours(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutFoodTrucksHandler))
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutFoodTrucksHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -751,3 +1194,205 @@ func TestPutFoodTrucksHandlerInvalidHours(t *testing.T) {
 	}
 
 }
+
+func TestPutFoodTrucksHandlerNotOwner(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Name:  "Luke's Covfefe",
+		Owner: "otheruser",
+	})
+
+	name := "Not Luke's Coffee House"
+	body, _ := json.Marshal(updateFoodTruckRequest{
+		Name: &name,
+	})
+	req, _ := http.NewRequest("PUT", "/foodtrucks", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutFoodTrucksHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("updating food truck owned by another user expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeForbidden {
+		t.Errorf("expected error code %v, but got %v", errCodeForbidden, response.Error.Code)
+	}
+
+	foodTruck := tests.GetFoodTruck("testfoodtruck")
+	if foodTruck == nil || foodTruck.Name != "Luke's Covfefe" {
+		t.Error("updating food truck owned by another user should not have changed the food truck")
+	}
+}
+
+func TestPutFoodTrucksHandlerUnclaimed(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:   "testfoodtruck",
+		Name: "Luke's Covfefe",
+	})
+
+	name := "Not Luke's Coffee House"
+	body, _ := json.Marshal(updateFoodTruckRequest{
+		Name: &name,
+	})
+	req, _ := http.NewRequest("PUT", "/foodtrucks", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutFoodTrucksHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("updating unclaimed food truck expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestPutFoodTrucksHandlerAdmin(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Name:  "Luke's Covfefe",
+		Owner: "otheruser",
+	})
+
+	name := "Luke's Coffee House"
+	body, _ := json.Marshal(updateFoodTruckRequest{
+		Name: &name,
+	})
+	req, _ := http.NewRequest("PUT", "/foodtrucks", bytes.NewBuffer(body))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(testServer.FoodTruckOwnerOnly(testServer.PutFoodTrucksHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("updating food truck as admin expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	foodTruck := tests.GetFoodTruck("testfoodtruck")
+	if foodTruck == nil || foodTruck.Name != name {
+		t.Error("updating food truck as admin should have changed the food truck")
+	}
+}
+
+func TestPutFoodTrucksHandlerUnauthorized(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Owner: "testuser",
+	})
+
+	req, _ := http.NewRequest("PUT", "/foodtrucks", nil)
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := testServer.FoodTruckOwnerOnly(testServer.PutFoodTrucksHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("updating food truck while unauthorized expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestPutFoodTrucksHandlerInvalidFoodTruck(t *testing.T) {
+	tests.ClearDB()
+
+	req, _ := http.NewRequest("PUT", "/foodtrucks", nil)
+	vars := map[string]string{
+		"foodTruckID": "invalid-id",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutFoodTrucksHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusNotFound
+	if rr.Code != expected {
+		t.Errorf("updating invalid food truck expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestFoodTruckUploadPut(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:     "testfoodtruck",
+		Owner:  "testuser",
+		Photos: []models.JSONPhoto{{ID: "existingphoto", Cover: true}},
+	})
+
+	req := newImageUploadRequest("/foodtrucks/upload/testfoodtruck", testJPEG(100, 100))
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutFoodTruckUploadHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("uploading photo expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// The photo goes after the existing photo, which stays the cover photo
+	photos := tests.GetFoodTruck("testfoodtruck").Photos
+	if len(photos) != 2 {
+		t.Fatalf("expected uploaded photo to be added, but got %v", photos)
+	}
+	photo := photos[1]
+	if photo.Uploader != "testuser" || photo.Cover || photo.Order != 1 || photo.URL != photo.Variants.Full || len(photo.BlobKeys) != 3 {
+		t.Errorf("expected uploaded photo after the existing photo, but got %v", photo)
+	}
+}
+
+func TestFoodTruckUploadPutNotOwner(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Owner: "otheruser",
+	})
+
+	req, _ := http.NewRequest("PUT", "/foodtrucks/upload", nil)
+	vars := map[string]string{
+		"foodTruckID": "testfoodtruck",
+	}
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutFoodTruckUploadHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("uploading photo to food truck owned by another user expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
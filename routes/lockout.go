@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"math"
+	"munchserver/secrets"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Failed logins allowed before the email or client ip is locked out, an ip gets more since it may be shared
+const (
+	accountFreeLoginAttempts = 5
+	ipFreeLoginAttempts      = 20
+)
+
+// Lockouts start at loginLockoutBase and double with every failure, up to loginLockoutMax
+const (
+	loginLockoutBase = time.Second * 30
+	loginLockoutMax  = time.Hour
+	// loginAttemptWindow is how long failures are remembered after the last one
+	loginAttemptWindow = time.Hour * 24
+)
+
+// loginLockout is why a login isn't allowed right now
+type loginLockout struct {
+	Status     int
+	RetryAfter time.Duration
+}
+
+// PutUnlockUserHandler clears the failed logins of a user so they can log in again
+func (s *Server) PutUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user id from route params
+	params := mux.Vars(r)
+	userID, userIDExists := params["userID"]
+	if !userIDExists {
+		writeMissingField(w, r, "userID")
+		return
+	}
+
+	// Get user from database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+
+	err = s.clearLoginFailures(r.Context(), user.Email)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "User could not be unlocked")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkLoginLockout finds if the email or client ip is locked out, returning nil if the login can go ahead
+func (s *Server) checkLoginLockout(ctx context.Context, email string, ip string) (*loginLockout, error) {
+	loginAttempts, err := s.LoginAttempts.GetMany(ctx, []string{emailAttemptID(email), ipAttemptID(ip)})
+	if err != nil {
+		return nil, err
+	}
+
+	// The account being locked takes priority since it is more useful to the user
+	now := time.Now()
+	var lockout *loginLockout
+	for _, loginAttempt := range loginAttempts {
+		if !loginAttempt.LockedUntil.After(now) {
+			continue
+		}
+		if loginAttempt.ID == emailAttemptID(email) {
+			return &loginLockout{
+				Status:     http.StatusLocked,
+				RetryAfter: loginAttempt.LockedUntil.Sub(now),
+			}, nil
+		}
+		lockout = &loginLockout{
+			Status:     http.StatusTooManyRequests,
+			RetryAfter: loginAttempt.LockedUntil.Sub(now),
+		}
+	}
+	return lockout, nil
+}
+
+// recordLoginFailure counts a failed login for the email and client ip, locking them out once they run out of attempts
+func (s *Server) recordLoginFailure(ctx context.Context, email string, ip string) error {
+	err := s.recordLoginAttemptFailure(ctx, emailAttemptID(email), accountFreeLoginAttempts)
+	if err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return s.recordLoginAttemptFailure(ctx, ipAttemptID(ip), ipFreeLoginAttempts)
+}
+
+// recordLoginAttemptFailure counts a failed login, the count is updated atomically so every server agrees on it
+func (s *Server) recordLoginAttemptFailure(ctx context.Context, id string, freeAttempts int) error {
+	now := time.Now()
+	loginAttempt, err := s.LoginAttempts.RecordFailure(ctx, id, now, now.Add(loginAttemptWindow))
+	if err != nil {
+		return err
+	}
+	if loginAttempt.Failures <= freeAttempts {
+		return nil
+	}
+
+	// Back off exponentially for every failure after the free attempts
+	lockoutDuration := loginLockoutBase
+	for failure := freeAttempts + 1; failure < loginAttempt.Failures && lockoutDuration < loginLockoutMax; failure++ {
+		lockoutDuration *= 2
+	}
+	if lockoutDuration > loginLockoutMax {
+		lockoutDuration = loginLockoutMax
+	}
+	return s.LoginAttempts.SetLockedUntil(ctx, id, now.Add(lockoutDuration))
+}
+
+// clearLoginFailures forgets the failed logins for the email after a successful login.
+// The client ip's failures are kept so an attacker can't reset them by logging into their own account.
+func (s *Server) clearLoginFailures(ctx context.Context, email string) error {
+	return s.LoginAttempts.Delete(ctx, emailAttemptID(email))
+}
+
+// writeLoginLockout sends the lockout response with how long to wait
+func writeLoginLockout(w http.ResponseWriter, r *http.Request, lockout *loginLockout) {
+	retryAfter := int(math.Ceil(lockout.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	if lockout.Status == http.StatusLocked {
+		writeError(w, r, lockout.Status, errCodeAccountLocked, "Account is locked after too many failed logins, try again later")
+	} else {
+		writeError(w, r, lockout.Status, errCodeTooManyAttempts, "Too many failed logins, try again later")
+	}
+}
+
+// clientIP gets the ip of the client, using X-Forwarded-For only if the server is behind a trusted proxy
+func clientIP(r *http.Request) string {
+	if secrets.GetTrustProxy() {
+		// The proxy appends the address it saw, so the last entry is the only one that can't be spoofed
+		forwardedFor := r.Header.Get("X-Forwarded-For")
+		if forwardedFor != "" {
+			addresses := strings.Split(forwardedFor, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func emailAttemptID(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func ipAttemptID(ip string) string {
+	return "ip:" + ip
+}
+
+// failLogin records a failed login and responds that the credentials were wrong
+func (s *Server) failLogin(w http.ResponseWriter, r *http.Request, email string, ip string) {
+	err := s.recordLoginFailure(r.Context(), email, ip)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	writeError(w, r, http.StatusUnauthorized, errCodeInvalidCredentials, "Email or password is incorrect")
+}
@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func postLogin(email string, password string, remoteAddr string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(loginRequest{
+		Email:    &email,
+		Password: &password,
+	})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostLoginHandler)
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestLoginPostLocksAccount(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		Email:        "test@munch.app",
+		PasswordHash: passwordHash,
+	})
+
+	// Use up the free attempts, and one more to get locked out
+	for attempt := 0; attempt <= accountFreeLoginAttempts; attempt++ {
+		rr := postLogin("test@munch.app", "notmypassword", "10.0.0.1:1234")
+		expected := http.StatusUnauthorized
+		if rr.Code != expected {
+			t.Fatalf("login with wrong password expected status code of %v, but got %v", expected, rr.Code)
+		}
+	}
+
+	// Even the right password shouldn't work while locked out
+	rr := postLogin("test@munch.app", "password123", "10.0.0.2:1234")
+	expected := http.StatusLocked
+	if rr.Code != expected {
+		t.Errorf("login to locked account expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("login to locked account should say when to retry")
+	}
+}
+
+func TestLoginPostLockedIP(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddLoginAttempt(models.JSONLoginAttempt{
+		ID:          ipAttemptID("10.0.0.1"),
+		Failures:    ipFreeLoginAttempts + 1,
+		LockedUntil: time.Now().Add(time.Minute),
+		Expires:     time.Now().Add(loginAttemptWindow),
+	})
+
+	rr := postLogin("test@munch.app", "password123", "10.0.0.1:1234")
+	expected := http.StatusTooManyRequests
+	if rr.Code != expected {
+		t.Errorf("login from locked ip expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestLoginPostClearsFailures(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		Email:        "test@munch.app",
+		PasswordHash: passwordHash,
+	})
+	tests.AddLoginAttempt(models.JSONLoginAttempt{
+		ID:       emailAttemptID("test@munch.app"),
+		Failures: accountFreeLoginAttempts - 1,
+		Expires:  time.Now().Add(loginAttemptWindow),
+	})
+
+	rr := postLogin("test@munch.app", "password123", "10.0.0.1:1234")
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("login with correct password expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetLoginAttempt(emailAttemptID("test@munch.app")) != nil {
+		t.Error("successful login should have cleared the failed logins")
+	}
+}
+
+func TestUnlockUserPut(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "lockeduser",
+		Email: "test@munch.app",
+	})
+	tests.AddLoginAttempt(models.JSONLoginAttempt{
+		ID:          emailAttemptID("test@munch.app"),
+		Failures:    accountFreeLoginAttempts + 1,
+		LockedUntil: time.Now().Add(time.Minute),
+		Expires:     time.Now().Add(loginAttemptWindow),
+	})
+
+	req, _ := http.NewRequest("PUT", "/users/lockeduser/unlock", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"userID": "lockeduser",
+	})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleAdmin)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(testServer.PutUnlockUserHandler)))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("unlocking user expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	if tests.GetLoginAttempt(emailAttemptID("test@munch.app")) != nil {
+		t.Error("unlocking user should have cleared their failed logins")
+	}
+}
@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"munchserver/models"
+	"munchserver/oidc"
+	"munchserver/store"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var (
+	// errUnverifiedAccount is returned when an ID token's email belongs to an account whose email was never verified
+	errUnverifiedAccount = errors.New("account with this email has not verified it")
+	// errMissingEmail is returned when the provider didn't share the user's email, which every user needs
+	errMissingEmail = errors.New("id token has no email")
+)
+
+// oidcLoginRequest has either an authorization code from the provider, or an ID token from a native sign in sdk
+type oidcLoginRequest struct {
+	Code         *string `json:"code"`
+	RedirectURI  string  `json:"redirectUri"`
+	CodeVerifier string  `json:"codeVerifier"`
+	IDToken      *string `json:"idToken"`
+	Nonce        string  `json:"nonce"`
+}
+
+// PostOIDCLoginHandler logs a user in with an OpenID Connect provider, creating or linking an account as needed
+func (s *Server) PostOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	// Checks for provider
+	params := mux.Vars(r)
+	providerName, providerNameExists := params["provider"]
+	if !providerNameExists {
+		writeMissingField(w, r, "provider")
+		return
+	}
+	provider, providerExists := s.OIDCProviders[providerName]
+	if !providerExists {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Provider not found")
+		return
+	}
+
+	// Decode request
+	loginDecoder := json.NewDecoder(r.Body)
+	loginDecoder.DisallowUnknownFields()
+	var login oidcLoginRequest
+	err := loginDecoder.Decode(&login)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+
+	// Exactly one of the code or id token has to be sent
+	if (login.Code == nil) == (login.IDToken == nil) {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Send either a code or an id token",
+			errorDetail{Field: "code", Code: errCodeInvalidField, Message: "Send either a code or an id token"},
+			errorDetail{Field: "idToken", Code: errCodeInvalidField, Message: "Send either a code or an id token"})
+		return
+	}
+
+	// Get the verified claims from the provider
+	var claims *oidc.IDTokenClaims
+	if login.Code != nil {
+		claims, err = provider.Exchange(r.Context(), *login.Code, login.RedirectURI, login.CodeVerifier, login.Nonce)
+	} else {
+		claims, err = provider.Verify(r.Context(), *login.IDToken, login.Nonce)
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Identity could not be verified")
+		return
+	}
+
+	// Find or create the user for the identity
+	user, err := s.findOrCreateOIDCUser(r.Context(), provider.Name, claims)
+	if err == errMissingEmail {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Provider did not share your email")
+		return
+	}
+	if err == errUnverifiedAccount || err == store.ErrDuplicateEmail {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusConflict, errCodeDuplicateEmail, "An account already uses this email, log in to it with your password")
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Account could not be found or created")
+		return
+	}
+
+	// Users with two factor authentication still need to enter a code
+	if user.TwoFactorEnabled {
+		writeTwoFactorChallenge(w, r, user)
+		return
+	}
+
+	s.completeLogin(w, r, user)
+}
+
+// findOrCreateOIDCUser finds the user linked to the identity. If there isn't one, the identity is linked to the user with
+// the same email when both the provider and the user have verified it, otherwise a new user is created.
+func (s *Server) findOrCreateOIDCUser(ctx context.Context, providerName string, claims *oidc.IDTokenClaims) (models.JSONUser, error) {
+	// Find user already linked to the identity
+	user, err := s.Users.GetByIdentity(ctx, providerName, claims.Subject)
+	if err != store.ErrNotFound {
+		return user, err
+	}
+
+	identity := models.JSONIdentity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Linked:   time.Now(),
+	}
+
+	// Link to the user with the same email, only if nobody could have registered it without owning it
+	if claims.Email != "" && bool(claims.EmailVerified) {
+		user, err = s.Users.GetByEmail(ctx, claims.Email)
+		if err == nil {
+			if !user.EmailVerified {
+				return user, errUnverifiedAccount
+			}
+			err = s.Users.AddIdentity(ctx, user.ID, identity)
+			user.Identities = append(user.Identities, identity)
+			return user, err
+		}
+		if err != store.ErrNotFound {
+			return user, err
+		}
+	}
+
+	// Create a new user without a password, they can set one with a password reset
+	if claims.Email == "" {
+		return user, errMissingEmail
+	}
+	userID, err := uuid.NewRandom()
+	if err != nil {
+		return user, err
+	}
+	nameFirst := claims.GivenName
+	if nameFirst == "" {
+		nameFirst = claims.Name
+	}
+	user = models.JSONUser{
+		ID:              userID.String(),
+		NameFirst:       nameFirst,
+		NameLast:        claims.FamilyName,
+		Email:           claims.Email,
+		EmailVerified:   bool(claims.EmailVerified),
+		Picture:         claims.Picture,
+		Favorites:       []string{},
+		Reviews:         []string{},
+		OwnedFoodTrucks: []string{},
+		Roles:           []string{},
+		Identities:      []models.JSONIdentity{identity},
+	}
+	err = s.Users.Add(ctx, user)
+	return user, err
+}
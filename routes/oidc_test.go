@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"munchserver/models"
+	"munchserver/oidc"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+)
+
+// postOIDCLogin logs in through the mock provider with the request
+func postOIDCLogin(t *testing.T, providerName string, login map[string]string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(login)
+	req, err := http.NewRequest("POST", "/login/oidc/"+providerName, bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{
+		"provider": providerName,
+	})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testServer.PostOIDCLoginHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+// useMockOIDCProvider points the test provider at a mock provider, which should be closed after the test
+func useMockOIDCProvider() *tests.MockOIDCProvider {
+	mockProvider := tests.NewMockOIDCProvider()
+	testServer.OIDCProviders = map[string]*oidc.Provider{
+		"test": oidc.NewProvider("test", mockProvider.Issuer(), tests.MockOIDCClientID, "secret", "http://localhost:3000/callback"),
+	}
+	return mockProvider
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	tests.ClearDB()
+	mockProvider := useMockOIDCProvider()
+	defer mockProvider.Close()
+
+	code := mockProvider.AuthorizationCode("newusercode", jwt.MapClaims{
+		"sub":            "subject1",
+		"email":          "new@munch.com",
+		"email_verified": true,
+		"given_name":     "New",
+		"family_name":    "User",
+		"nonce":          "nonce1",
+	})
+	rr := postOIDCLogin(t, "test", map[string]string{
+		"code":  code,
+		"nonce": "nonce1",
+	})
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Fatalf("oidc login expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var response loginResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Token == "" || response.RefreshToken == "" {
+		t.Errorf("expected tokens, but got %v", response)
+	}
+	user := tests.GetUser(response.User.ID)
+	if user == nil {
+		t.Fatal("expected user to be created")
+	}
+	if user.Email != "new@munch.com" || !user.EmailVerified || user.NameFirst != "New" {
+		t.Errorf("expected user from id token claims, but got %v", user)
+	}
+	if len(user.Identities) != 1 || user.Identities[0].Provider != "test" || user.Identities[0].Subject != "subject1" {
+		t.Errorf("expected identity to be linked, but got %v", user.Identities)
+	}
+
+	// Logging in again should find the same user
+	rr = postOIDCLogin(t, "test", map[string]string{
+		"idToken": mockProvider.IDToken(jwt.MapClaims{"sub": "subject1", "email": "new@munch.com"}),
+	})
+	if rr.Code != expected {
+		t.Fatalf("second oidc login expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var secondResponse loginResponse
+	json.NewDecoder(rr.Body).Decode(&secondResponse)
+	if secondResponse.User.ID != response.User.ID {
+		t.Errorf("expected the linked user %v, but got %v", response.User.ID, secondResponse.User.ID)
+	}
+}
+
+func TestOIDCLoginLinksVerifiedAccount(t *testing.T) {
+	tests.ClearDB()
+	mockProvider := useMockOIDCProvider()
+	defer mockProvider.Close()
+
+	tests.AddUser(models.JSONUser{
+		ID:            "testuser",
+		Email:         "test@munch.com",
+		EmailVerified: true,
+	})
+
+	rr := postOIDCLogin(t, "test", map[string]string{
+		"idToken": mockProvider.IDToken(jwt.MapClaims{
+			"sub":            "subject2",
+			"email":          "test@munch.com",
+			"email_verified": "true",
+		}),
+	})
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Fatalf("oidc login expected status code of %v, but got %v", expected, rr.Code)
+	}
+	user := tests.GetUser("testuser")
+	if len(user.Identities) != 1 || user.Identities[0].Subject != "subject2" {
+		t.Errorf("expected identity to be linked to the existing user, but got %v", user.Identities)
+	}
+}
+
+func TestOIDCLoginUnverifiedAccount(t *testing.T) {
+	tests.ClearDB()
+	mockProvider := useMockOIDCProvider()
+	defer mockProvider.Close()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Email: "test@munch.com",
+	})
+
+	rr := postOIDCLogin(t, "test", map[string]string{
+		"idToken": mockProvider.IDToken(jwt.MapClaims{
+			"sub":            "subject3",
+			"email":          "test@munch.com",
+			"email_verified": true,
+		}),
+	})
+
+	expected := http.StatusConflict
+	if rr.Code != expected {
+		t.Errorf("oidc login to an unverified account expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if user := tests.GetUser("testuser"); len(user.Identities) != 0 {
+		t.Errorf("expected identity not to be linked, but got %v", user.Identities)
+	}
+}
+
+func TestOIDCLoginInvalidToken(t *testing.T) {
+	tests.ClearDB()
+	mockProvider := useMockOIDCProvider()
+	defer mockProvider.Close()
+
+	invalidLogins := map[string]map[string]string{
+		"wrong audience": {
+			"idToken": mockProvider.IDToken(jwt.MapClaims{"sub": "subject4", "email": "a@munch.com", "aud": "someoneelse"}),
+		},
+		"wrong nonce": {
+			"idToken": mockProvider.IDToken(jwt.MapClaims{"sub": "subject4", "email": "a@munch.com", "nonce": "nonce1"}),
+			"nonce":   "nonce2",
+		},
+		"unknown code": {
+			"code": "unknowncode",
+		},
+	}
+	for name, login := range invalidLogins {
+		rr := postOIDCLogin(t, "test", login)
+
+		expected := http.StatusUnauthorized
+		if rr.Code != expected {
+			t.Errorf("oidc login with %v expected status code of %v, but got %v", name, expected, rr.Code)
+		}
+	}
+}
+
+func TestOIDCLoginUnknownProvider(t *testing.T) {
+	tests.ClearDB()
+	mockProvider := useMockOIDCProvider()
+	defer mockProvider.Close()
+
+	rr := postOIDCLogin(t, "unknown", map[string]string{
+		"idToken": mockProvider.IDToken(jwt.MapClaims{"sub": "subject5"}),
+	})
+
+	expected := http.StatusNotFound
+	if rr.Code != expected {
+		t.Errorf("oidc login with unknown provider expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
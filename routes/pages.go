@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"encoding/json"
+	"munchserver/store"
+	"munchserver/validation"
+	"net/http"
+	"strconv"
+)
+
+// pageResponse is a page of a list, the next page is listed by sending nextCursor back as the cursor query param. There
+// isn't a nextCursor on the last page.
+type pageResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// parsePage gets the page to list from the limit and cursor query params, limits over the most a page can have are
+// lowered to it. It writes an error and returns false if the limit isn't valid.
+func parsePage(w http.ResponseWriter, r *http.Request) (store.Page, bool) {
+	page := store.Page{Limit: store.DefaultPageLimit, Cursor: r.URL.Query().Get("cursor")}
+	if r.URL.Query().Get("limit") != "" {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Limit is not valid", errorDetail{Field: "limit", Code: errCodeInvalidField, Message: "Expected a whole number"})
+			return store.Page{}, false
+		}
+		if limit < 1 {
+			writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Limit is not valid", errorDetail{Field: "limit", Code: validation.CodeOutOfRange, Message: "Limit must be at least 1"})
+			return store.Page{}, false
+		}
+		page.Limit = limit
+	}
+	if page.Limit > store.MaxPageLimit {
+		page.Limit = store.MaxPageLimit
+	}
+	return page, true
+}
+
+// writeInvalidCursor writes the error for a cursor that wasn't sent by the same list
+func writeInvalidCursor(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Cursor is not valid", errorDetail{Field: "cursor", Code: errCodeInvalidField, Message: "Expected the nextCursor of the page before"})
+}
+
+// writePage sends a page of a list as the response
+func writePage(w http.ResponseWriter, items interface{}, nextCursor string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pageResponse{Items: items, NextCursor: nextCursor})
+}
@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"munchserver/mailer"
+	"munchserver/models"
+	"munchserver/secrets"
+	"munchserver/validation"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTokenLifetime is how long a password reset email can be used for
+const passwordResetTokenLifetime = time.Hour
+
+type forgotPasswordRequest struct {
+	Email *string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    *string `json:"token"`
+	Password *string `json:"password"`
+}
+
+// PostForgotPasswordHandler emails a password reset link to the user
+func (s *Server) PostForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode request
+	forgotDecoder := json.NewDecoder(r.Body)
+	forgotDecoder.DisallowUnknownFields()
+	var forgot forgotPasswordRequest
+	err := forgotDecoder.Decode(&forgot)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if forgot.Email == nil {
+		writeMissingField(w, r, "email")
+		return
+	}
+
+	// Find user in database, always responding the same way so emails can't be enumerated
+	user, err := s.Users.GetByEmail(r.Context(), *forgot.Email)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Create a reset token
+	token, err := s.createUserToken(r.Context(), user.ID, models.TokenPurposePasswordReset, passwordResetTokenLifetime)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Reset token could not be created")
+		return
+	}
+
+	// Email the reset link
+	resetURL := secrets.GetAppURL() + "/reset-password?token=" + url.QueryEscape(token)
+	err = s.Mailer.Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Munch password",
+		Body: fmt.Sprintf("Hi %v,\r\n\r\nSomeone asked to reset the password for your Munch account. "+
+			"Use this link within the next hour to choose a new password:\r\n\r\n%v\r\n\r\n"+
+			"If this wasn't you, you can ignore this email.\r\n", user.NameFirst, resetURL),
+	})
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// PostResetPasswordHandler sets a new password using a token from a password reset email
+func (s *Server) PostResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode request
+	resetDecoder := json.NewDecoder(r.Body)
+	resetDecoder.DisallowUnknownFields()
+	var reset resetPasswordRequest
+	err := resetDecoder.Decode(&reset)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	var fieldErrors []validation.FieldError
+	if reset.Token == nil {
+		fieldErrors = append(fieldErrors, validation.Missing("token"))
+	}
+	if reset.Password == nil {
+		fieldErrors = append(fieldErrors, validation.Missing("password"))
+	}
+	if writeValidationErrors(w, r, fieldErrors) {
+		return
+	}
+
+	// Find the user the reset token is for
+	resetToken, err := s.UserTokens.GetUsable(r.Context(), hashToken(*reset.Token), models.TokenPurposePasswordReset, time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Token is not valid", errorDetail{Field: "token", Code: errCodeInvalidField, Message: "Token is invalid, expired or already used"})
+		return
+	}
+	user, err := s.Users.Get(r.Context(), resetToken.User)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Token is not valid", errorDetail{Field: "token", Code: errCodeInvalidField, Message: "Token is invalid, expired or already used"})
+		return
+	}
+
+	// Check the new password before the token is used, so the user can try another
+	if !s.checkPasswordPolicy(w, r, "password", *reset.Password, user.Email) {
+		return
+	}
+
+	// Use up the reset token
+	resetToken, err = s.useUserToken(r.Context(), *reset.Token, models.TokenPurposePasswordReset)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Token is not valid", errorDetail{Field: "token", Code: errCodeInvalidField, Message: "Token is invalid, expired or already used"})
+		return
+	}
+	userID := resetToken.User
+
+	// Salt and hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*reset.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Password could not be hashed")
+		return
+	}
+
+	// Update the password, which also invalidates existing access tokens
+	err = s.Users.SetPassword(r.Context(), userID, hashedPassword, time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Password could not be reset")
+		return
+	}
+
+	// Whoever knew the old password shouldn't stay logged in
+	err = s.revokeUserRefreshTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Sessions could not be logged out")
+		return
+	}
+
+	// Any other reset emails can't be used anymore
+	err = s.UserTokens.UseAll(r.Context(), userID, models.TokenPurposePasswordReset)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkPasswordPolicy makes sure a new password meets the password policy, otherwise it responds with a detail for
+// each failed rule on the password field
+func (s *Server) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, field string, password string, email string) bool {
+	violations := s.PasswordPolicy.Check(password, email)
+	if len(violations) == 0 {
+		return true
+	}
+	details := make([]errorDetail, len(violations))
+	for i, violation := range violations {
+		details[i] = errorDetail{
+			Field:   field,
+			Code:    violation.Rule,
+			Message: violation.Message,
+		}
+	}
+	writeError(w, r, http.StatusBadRequest, errCodeWeakPassword, "Password does not meet the password policy", details...)
+	return false
+}
+
+// createUserToken stores the hash of a new token for the user and returns the token
+func (s *Server) createUserToken(ctx context.Context, userID string, purpose string, lifetime time.Duration) (string, error) {
+	return s.createUserTokenForEmail(ctx, userID, "", purpose, lifetime)
+}
+
+// createUserTokenForEmail creates a token that is only valid while the user has the email
+func (s *Server) createUserTokenForEmail(ctx context.Context, userID string, email string, purpose string, lifetime time.Duration) (string, error) {
+	token, err := generateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = s.UserTokens.Add(ctx, models.JSONUserToken{
+		ID:      hashToken(token),
+		User:    userID,
+		Purpose: purpose,
+		Email:   email,
+		Created: now,
+		Expires: now.Add(lifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useUserToken marks an unexpired token as used
+func (s *Server) useUserToken(ctx context.Context, token string, purpose string) (models.JSONUserToken, error) {
+	return s.UserTokens.Use(ctx, hashToken(token), purpose, time.Now())
+}
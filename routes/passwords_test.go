@@ -0,0 +1,258 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var emailTokenRegexp = regexp.MustCompile(`token=(\S+)`)
+
+func TestForgotPasswordPostValid(t *testing.T) {
+	tests.ClearDB()
+	testMailer.Clear()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Email: "test@munch.app",
+	})
+
+	email := "test@munch.app"
+	body, _ := json.Marshal(forgotPasswordRequest{
+		Email: &email,
+	})
+	req, _ := http.NewRequest("POST", "/password/forgot", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostForgotPasswordHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("requesting password reset expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	messages := testMailer.Messages("test@munch.app")
+	if len(messages) != 1 {
+		t.Fatalf("expected one password reset email, but got %v", len(messages))
+	}
+
+	// The emailed token should be stored hashed
+	match := emailTokenRegexp.FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatal("expected password reset email to contain a reset link")
+	}
+	token, _ := url.QueryUnescape(match[1])
+	resetToken := tests.GetUserToken(hashToken(token))
+	if resetToken == nil || resetToken.User != "testuser" || resetToken.Purpose != models.TokenPurposePasswordReset {
+		t.Error("requesting password reset should have stored a reset token for the user")
+	}
+}
+
+func TestForgotPasswordPostUnknownEmail(t *testing.T) {
+	tests.ClearDB()
+	testMailer.Clear()
+
+	email := "nobody@munch.app"
+	body, _ := json.Marshal(forgotPasswordRequest{
+		Email: &email,
+	})
+	req, _ := http.NewRequest("POST", "/password/forgot", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostForgotPasswordHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("requesting password reset for unknown email expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if len(testMailer.Messages("nobody@munch.app")) != 0 {
+		t.Error("requesting password reset for unknown email should not send an email")
+	}
+}
+
+func TestResetPasswordPostValid(t *testing.T) {
+	tests.ClearDB()
+
+	oldPasswordHash, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		PasswordHash: oldPasswordHash,
+	})
+	tests.AddUserToken(models.JSONUserToken{
+		ID:      hashToken("testresettoken"),
+		User:    "testuser",
+		Purpose: models.TokenPurposePasswordReset,
+		Expires: time.Now().Add(time.Hour),
+	})
+	tests.AddRefreshToken(models.JSONRefreshToken{
+		ID:      hashToken("testrefreshtoken"),
+		Family:  "testfamily",
+		User:    "testuser",
+		Expires: time.Now().Add(time.Hour),
+	})
+
+	token := "testresettoken"
+	password := "newpassword"
+	body, _ := json.Marshal(resetPasswordRequest{
+		Token:    &token,
+		Password: &password,
+	})
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostResetPasswordHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("resetting password with valid token expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || bcrypt.CompareHashAndPassword(user.PasswordHash, []byte("newpassword")) != nil {
+		t.Error("resetting password should have changed the password")
+	}
+
+	resetToken := tests.GetUserToken(hashToken("testresettoken"))
+	if resetToken == nil || !resetToken.Used {
+		t.Error("resetting password should have used up the reset token")
+	}
+
+	refreshToken := tests.GetRefreshToken(hashToken("testrefreshtoken"))
+	if refreshToken == nil || !refreshToken.Revoked {
+		t.Error("resetting password should have revoked the user's refresh tokens")
+	}
+
+	// Access tokens issued before the reset should be rejected
+	err := testServer.ValidateToken(context.TODO(), &middleware.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:       "testtoken",
+			IssuedAt: time.Now().Add(-time.Minute).Unix(),
+			Subject:  "testuser",
+		},
+	})
+	if err == nil {
+		t.Error("expected access token issued before resetting password to be invalid")
+	}
+
+	// Tokens only have the second they were issued, so ones from the same second as the reset are rejected too
+	err = testServer.ValidateToken(context.TODO(), &middleware.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:       "testtoken",
+			IssuedAt: user.TokensRevokedAt.Unix(),
+			Subject:  "testuser",
+		},
+	})
+	if err == nil {
+		t.Error("expected access token issued in the same second as resetting password to be invalid")
+	}
+}
+
+func TestResetPasswordPostWeakPassword(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Email: "tester@example.com",
+	})
+	tests.AddUserToken(models.JSONUserToken{
+		ID:      hashToken("testresettoken"),
+		User:    "testuser",
+		Purpose: models.TokenPurposePasswordReset,
+		Expires: time.Now().Add(time.Hour),
+	})
+
+	token := "testresettoken"
+	password := "short"
+	body, _ := json.Marshal(resetPasswordRequest{
+		Token:    &token,
+		Password: &password,
+	})
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostResetPasswordHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("resetting password to a weak password expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// The token should still work for a better password
+	resetToken := tests.GetUserToken(hashToken("testresettoken"))
+	if resetToken == nil || resetToken.Used {
+		t.Error("resetting to a weak password should not have used up the reset token")
+	}
+}
+
+func TestResetPasswordPostExpired(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+	tests.AddUserToken(models.JSONUserToken{
+		ID:      hashToken("testresettoken"),
+		User:    "testuser",
+		Purpose: models.TokenPurposePasswordReset,
+		Expires: time.Now().Add(-time.Hour),
+	})
+
+	token := "testresettoken"
+	password := "newpassword"
+	body, _ := json.Marshal(resetPasswordRequest{
+		Token:    &token,
+		Password: &password,
+	})
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostResetPasswordHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("resetting password with expired token expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestResetPasswordPostUsed(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+	tests.AddUserToken(models.JSONUserToken{
+		ID:      hashToken("testresettoken"),
+		User:    "testuser",
+		Purpose: models.TokenPurposePasswordReset,
+		Expires: time.Now().Add(time.Hour),
+		Used:    true,
+	})
+
+	token := "testresettoken"
+	password := "newpassword"
+	body, _ := json.Marshal(resetPasswordRequest{
+		Token:    &token,
+		Password: &password,
+	})
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostResetPasswordHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("resetting password with used token expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
@@ -0,0 +1,306 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/validation"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type updatePhotoRequest struct {
+	Caption *string `json:"caption" validate:"required,max=300"`
+}
+
+type reorderPhotosRequest struct {
+	PhotoIDs []string `json:"photoIDs" validate:"required"`
+}
+
+func (s *Server) DeletePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	// Get food truck and photo from route params
+	foodTruck, photoIndex, found := s.getFoodTruckPhoto(w, r)
+	if !found {
+		return
+	}
+	photo := foodTruck.Photos[photoIndex]
+
+	// Remove the photo, keeping the others in order
+	photos := make([]models.JSONPhoto, 0, len(foodTruck.Photos)-1)
+	photos = append(photos, foodTruck.Photos[:photoIndex]...)
+	photos = append(photos, foodTruck.Photos[photoIndex+1:]...)
+	if !s.replacePhotos(w, r, foodTruck, photos) {
+		return
+	}
+
+	// Delete the uploaded files, the photo is already gone if this fails
+	for _, key := range photo.BlobKeys {
+		err := s.Blobs.Delete(r.Context(), key)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+
+	// Send response
+	writePhotos(w, photos)
+}
+
+func (s *Server) PutPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoDecoder := json.NewDecoder(r.Body)
+	photoDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var update updatePhotoRequest
+	err := photoDecoder.Decode(&update)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if writeValidationErrors(w, r, validation.Struct(&update)) {
+		return
+	}
+
+	// Get food truck and photo from route params
+	foodTruck, photoIndex, found := s.getFoodTruckPhoto(w, r)
+	if !found {
+		return
+	}
+
+	// Change the caption
+	photos := append([]models.JSONPhoto{}, foodTruck.Photos...)
+	photos[photoIndex].Caption = *update.Caption
+	if !s.replacePhotos(w, r, foodTruck, photos) {
+		return
+	}
+
+	// Send response
+	writePhotos(w, photos)
+}
+
+func (s *Server) PutCoverPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	// Get food truck and photo from route params
+	foodTruck, photoIndex, found := s.getFoodTruckPhoto(w, r)
+	if !found {
+		return
+	}
+
+	// Make the photo the only cover photo
+	photos := append([]models.JSONPhoto{}, foodTruck.Photos...)
+	for i := range photos {
+		photos[i].Cover = i == photoIndex
+	}
+	if !s.replacePhotos(w, r, foodTruck, photos) {
+		return
+	}
+
+	// Send response
+	writePhotos(w, photos)
+}
+
+func (s *Server) PutPhotoOrderHandler(w http.ResponseWriter, r *http.Request) {
+	// Get food truck id from route params
+	params := mux.Vars(r)
+	foodTruckID, foodTruckIDExists := params["foodTruckID"]
+	if !foodTruckIDExists {
+		writeMissingField(w, r, "foodTruckID")
+		return
+	}
+
+	orderDecoder := json.NewDecoder(r.Body)
+	orderDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var order reorderPhotosRequest
+	err := orderDecoder.Decode(&order)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if writeValidationErrors(w, r, validation.Struct(&order)) {
+		return
+	}
+
+	// Get food truck from database
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
+		return
+	}
+
+	// Every photo has to be in the new order exactly once
+	photos := make([]models.JSONPhoto, 0, len(foodTruck.Photos))
+	for _, photoID := range order.PhotoIDs {
+		i := photoIndex(foodTruck.Photos, photoID)
+		if i < 0 || photoIndex(photos, photoID) >= 0 {
+			break
+		}
+		photos = append(photos, foodTruck.Photos[i])
+	}
+	if len(photos) != len(order.PhotoIDs) || len(photos) != len(foodTruck.Photos) {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Photo order is not valid", errorDetail{Field: "photoIDs", Code: errCodeInvalidField, Message: "Expected every photo of the food truck once"})
+		return
+	}
+	if !s.replacePhotos(w, r, foodTruck, photos) {
+		return
+	}
+
+	// Send response
+	writePhotos(w, photos)
+}
+
+func (s *Server) PostPhotoUploadHandler(w http.ResponseWriter, r *http.Request) {
+	// Get food truck id from route params
+	params := mux.Vars(r)
+	foodTruckID, foodTruckIDExists := params["foodTruckID"]
+	if !foodTruckIDExists {
+		writeMissingField(w, r, "foodTruckID")
+		return
+	}
+
+	s.presignUpload(w, r, photoUploadKeyPrefix(foodTruckID))
+}
+
+func (s *Server) PostPhotoUploadCompleteHandler(w http.ResponseWriter, r *http.Request) {
+	// Get food truck id from route params
+	params := mux.Vars(r)
+	foodTruckID, foodTruckIDExists := params["foodTruckID"]
+	if !foodTruckIDExists {
+		writeMissingField(w, r, "foodTruckID")
+		return
+	}
+
+	// Get user from context
+	user, _ := r.Context().Value(middleware.UserKey).(string)
+
+	// Get the food truck's photos to put the new photo after them
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
+		return
+	}
+
+	// Resize the uploaded image
+	image, uploaded := s.completeUpload(w, r, photoUploadKeyPrefix(foodTruckID))
+	if !uploaded {
+		return
+	}
+
+	s.addUploadedPhoto(w, r, foodTruck, user, image)
+}
+
+// addUploadedPhoto adds an uploaded image after the food truck's photos, sending the photo as the response
+func (s *Server) addUploadedPhoto(w http.ResponseWriter, r *http.Request, foodTruck models.JSONFoodTruck, uploader string, image uploadedImage) {
+	// The first photo of a food truck is its cover photo
+	photo := models.JSONPhoto{
+		ID:       image.ID,
+		URL:      image.Variants.Full,
+		Variants: image.Variants,
+		BlobKeys: image.BlobKeys,
+		Uploader: uploader,
+		Created:  time.Now(),
+		Cover:    coverPhotoIndex(foodTruck.Photos) < 0,
+		Order:    len(foodTruck.Photos),
+	}
+	err := s.FoodTrucks.AddPhoto(r.Context(), foodTruck.ID, photo)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Image could not be added to the food truck")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photo)
+}
+
+// photoUploadKeyPrefix starts the keys of images uploaded straight to the blob store for the food truck
+func photoUploadKeyPrefix(foodTruckID string) string {
+	return "foodtrucks_" + foodTruckID + "_"
+}
+
+// getFoodTruckPhoto gets the food truck and the index of the photo in the route, writing an error if either isn't found
+func (s *Server) getFoodTruckPhoto(w http.ResponseWriter, r *http.Request) (models.JSONFoodTruck, int, bool) {
+	// Get food truck and photo id from route params
+	params := mux.Vars(r)
+	foodTruckID, foodTruckIDExists := params["foodTruckID"]
+	if !foodTruckIDExists {
+		writeMissingField(w, r, "foodTruckID")
+		return models.JSONFoodTruck{}, -1, false
+	}
+	photoID, photoIDExists := params["photoID"]
+	if !photoIDExists {
+		writeMissingField(w, r, "photoID")
+		return models.JSONFoodTruck{}, -1, false
+	}
+
+	// Get food truck from database
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
+		return models.JSONFoodTruck{}, -1, false
+	}
+
+	i := photoIndex(foodTruck.Photos, photoID)
+	if i < 0 {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Photo not found")
+		return models.JSONFoodTruck{}, -1, false
+	}
+	return foodTruck, i, true
+}
+
+// replacePhotos numbers the photos in their order and saves them, keeping a cover photo if there are any photos. It
+// writes an error and returns false if the food truck's photos changed since they were read.
+func (s *Server) replacePhotos(w http.ResponseWriter, r *http.Request, foodTruck models.JSONFoodTruck, photos []models.JSONPhoto) bool {
+	for i := range photos {
+		photos[i].Order = i
+	}
+	if len(photos) > 0 && coverPhotoIndex(photos) < 0 {
+		photos[0].Cover = true
+	}
+
+	replaced, err := s.FoodTrucks.ReplacePhotos(r.Context(), foodTruck.ID, foodTruck.Photos, photos)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Photos could not be updated")
+		return false
+	}
+	if !replaced {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Photos were changed at the same time, try again")
+		return false
+	}
+	return true
+}
+
+// writePhotos sends the photos of a food truck as the response
+func writePhotos(w http.ResponseWriter, photos []models.JSONPhoto) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photos)
+}
+
+// photoIndex finds the photo with the id, returning -1 if there isn't one
+func photoIndex(photos []models.JSONPhoto, photoID string) int {
+	for i, photo := range photos {
+		if photo.ID == photoID {
+			return i
+		}
+	}
+	return -1
+}
+
+// coverPhotoIndex finds the cover photo, returning -1 if there isn't one
+func coverPhotoIndex(photos []models.JSONPhoto) int {
+	for i, photo := range photos {
+		if photo.Cover {
+			return i
+		}
+	}
+	return -1
+}
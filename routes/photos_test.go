@@ -0,0 +1,252 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"munchserver/models"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// addTestPhotos adds a food truck owned by the mock user with two photos, the first being the cover photo
+func addTestPhotos() {
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:    "testfoodtruck",
+		Owner: "testuser",
+		Photos: []models.JSONPhoto{
+			{ID: "firstphoto", URL: "http://localhost/uploads/first.jpg", BlobKeys: []string{"first.jpg"}, Cover: true, Order: 0},
+			{ID: "secondphoto", URL: "http://localhost/uploads/second.jpg", BlobKeys: []string{"second.jpg"}, Order: 1},
+		},
+	})
+}
+
+func TestPhotoDeleteValid(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+	testBlobs.Put(context.TODO(), "first.jpg", bytes.NewReader([]byte("testimage")), "image/jpeg")
+
+	req, _ := http.NewRequest("DELETE", "/foodtrucks/testfoodtruck/photos/firstphoto", nil)
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck", "photoID": "firstphoto"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.DeletePhotoHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("deleting photo expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// The other photo moves up and becomes the cover photo
+	photos := tests.GetFoodTruck("testfoodtruck").Photos
+	if len(photos) != 1 || photos[0].ID != "secondphoto" || !photos[0].Cover || photos[0].Order != 0 {
+		t.Errorf("expected only the second photo to be left as the cover photo, but got %v", photos)
+	}
+
+	if _, err := os.Stat(filepath.Join(testBlobs.Dir, "first.jpg")); !os.IsNotExist(err) {
+		t.Errorf("expected deleted photo to be removed from the blob store, but got %v", err)
+	}
+}
+
+func TestPhotoDeleteNotFound(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	req, _ := http.NewRequest("DELETE", "/foodtrucks/testfoodtruck/photos/missingphoto", nil)
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck", "photoID": "missingphoto"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.DeletePhotoHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusNotFound
+	if rr.Code != expected {
+		t.Errorf("deleting missing photo expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if photos := tests.GetFoodTruck("testfoodtruck").Photos; len(photos) != 2 {
+		t.Errorf("expected photos not to change, but got %v", photos)
+	}
+}
+
+func TestPhotoDeleteNotOwner(t *testing.T) {
+	tests.ClearDB()
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:     "testfoodtruck",
+		Owner:  "otheruser",
+		Photos: []models.JSONPhoto{{ID: "firstphoto", Cover: true}},
+	})
+
+	req, _ := http.NewRequest("DELETE", "/foodtrucks/testfoodtruck/photos/firstphoto", nil)
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck", "photoID": "firstphoto"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.DeletePhotoHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("deleting photo of someone else's food truck expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestPhotoPutCaption(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	caption := "Our famous tacos"
+	body, _ := json.Marshal(updatePhotoRequest{Caption: &caption})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/testfoodtruck/photos/secondphoto", bytes.NewBuffer(body))
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck", "photoID": "secondphoto"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutPhotoHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("captioning photo expected status code of %v, but got %v", expected, rr.Code)
+	}
+	photos := tests.GetFoodTruck("testfoodtruck").Photos
+	if photos[1].Caption != caption || photos[0].Caption != "" {
+		t.Errorf("expected only the second photo to have the caption, but got %v", photos)
+	}
+}
+
+func TestPhotoPutMissingCaption(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	req, _ := http.NewRequest("PUT", "/foodtrucks/testfoodtruck/photos/secondphoto", bytes.NewBufferString("{}"))
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck", "photoID": "secondphoto"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutPhotoHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("captioning photo without a caption expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestCoverPhotoPut(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	req, _ := http.NewRequest("PUT", "/foodtrucks/testfoodtruck/photos/secondphoto/cover", nil)
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck", "photoID": "secondphoto"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutCoverPhotoHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("setting cover photo expected status code of %v, but got %v", expected, rr.Code)
+	}
+	photos := tests.GetFoodTruck("testfoodtruck").Photos
+	if photos[0].Cover || !photos[1].Cover {
+		t.Errorf("expected the second photo to be the only cover photo, but got %v", photos)
+	}
+}
+
+func TestPhotoOrderPut(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	body, _ := json.Marshal(reorderPhotosRequest{PhotoIDs: []string{"secondphoto", "firstphoto"}})
+	req, _ := http.NewRequest("PUT", "/foodtrucks/testfoodtruck/photos/order", bytes.NewBuffer(body))
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutPhotoOrderHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("reordering photos expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// The cover photo stays the same when it moves
+	photos := tests.GetFoodTruck("testfoodtruck").Photos
+	if len(photos) != 2 ||
+		photos[0].ID != "secondphoto" || photos[0].Order != 0 || photos[0].Cover ||
+		photos[1].ID != "firstphoto" || photos[1].Order != 1 || !photos[1].Cover {
+		t.Errorf("expected photos to be reordered, but got %v", photos)
+	}
+}
+
+func TestPhotoOrderPutInvalid(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	for _, photoIDs := range [][]string{
+		{"secondphoto"},
+		{"secondphoto", "secondphoto"},
+		{"secondphoto", "firstphoto", "missingphoto"},
+	} {
+		body, _ := json.Marshal(reorderPhotosRequest{PhotoIDs: photoIDs})
+		req, _ := http.NewRequest("PUT", "/foodtrucks/testfoodtruck/photos/order", bytes.NewBuffer(body))
+		req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck"})
+		rr := httptest.NewRecorder()
+		handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PutPhotoOrderHandler))
+		handler.ServeHTTP(rr, req)
+
+		expected := http.StatusBadRequest
+		if rr.Code != expected {
+			t.Errorf("reordering photos as %v expected status code of %v, but got %v", photoIDs, expected, rr.Code)
+		}
+	}
+
+	if photos := tests.GetFoodTruck("testfoodtruck").Photos; photos[0].ID != "firstphoto" {
+		t.Errorf("expected photos not to be reordered, but got %v", photos)
+	}
+}
+
+func TestPhotoUploadsComplete(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	vars := map[string]string{"foodTruckID": "testfoodtruck"}
+	presignHandler := tests.AuthenticateMockUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testServer.FoodTruckOwnerOnly(testServer.PostPhotoUploadHandler)(w, mux.SetURLVars(r, vars))
+	}))
+	key := presignTestUpload(t, presignHandler, testJPEG(100, 100))
+
+	body, _ := json.Marshal(map[string]string{"key": key})
+	req, _ := http.NewRequest("POST", "/foodtrucks/testfoodtruck/photos/uploads/complete", bytes.NewBuffer(body))
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PostPhotoUploadCompleteHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("completing photo upload expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	photos := tests.GetFoodTruck("testfoodtruck").Photos
+	if len(photos) != 3 || photos[2].Order != 2 || photos[2].Cover || photos[2].Variants.Thumbnail == "" {
+		t.Errorf("expected uploaded photo to be added after the other photos, but got %v", photos)
+	}
+}
+
+func TestPhotoUploadsCompleteNotUploaded(t *testing.T) {
+	tests.ClearDB()
+	addTestPhotos()
+
+	body, _ := json.Marshal(map[string]string{"key": "foodtrucks_testfoodtruck_missing.jpg"})
+	req, _ := http.NewRequest("POST", "/foodtrucks/testfoodtruck/photos/uploads/complete", bytes.NewBuffer(body))
+	req = mux.SetURLVars(req, map[string]string{"foodTruckID": "testfoodtruck"})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.FoodTruckOwnerOnly(testServer.PostPhotoUploadCompleteHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusNotFound
+	if rr.Code != expected {
+		t.Errorf("completing photo upload that wasn't uploaded expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if photos := tests.GetFoodTruck("testfoodtruck").Photos; len(photos) != 2 {
+		t.Errorf("expected photos not to change, but got %v", photos)
+	}
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// generateToken creates a random url safe token from n random bytes
+func generateToken(n int) (string, error) {
+	buffer := make([]byte, n)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// hashToken hashes a random token for storing in the database
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// generateCallbackCode creates a random 6 digit code
+func generateCallbackCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// generateRecoveryCode creates a random code like abcd-efgh that is easy to write down
+func generateRecoveryCode() (string, error) {
+	buffer := make([]byte, 5)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(buffer))
+	return code[:4] + "-" + code[4:], nil
+}
+
+// normalizeRecoveryCode removes formatting from a recovery code typed in by a user
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -3,36 +3,39 @@ package routes
 import (
 	"encoding/json"
 	"log"
-	"munchserver/dbutils"
 	"munchserver/middleware"
 	"munchserver/models"
+	"munchserver/store"
+	"munchserver/validation"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 type newReviewRequest struct {
-	ReviewerName string    `json:"reviewerName"`
-	FoodTruck    *string   `json:"foodTruck"`
-	Comment      string    `json:"comment"`
-	Rating       *float64  `json:"rating"`
+	ReviewerName string    `json:"reviewerName" validate:"max=100"`
+	FoodTruck    *string   `json:"foodTruck" validate:"required"`
+	Comment      string    `json:"comment" validate:"max=2000"`
+	Rating       *float64  `json:"rating" validate:"required,min=0,max=5"`
 	Date         time.Time `json:"date"`
-	Origin       string    `json:"origin"`
+	Origin       string    `json:"origin" validate:"max=50"`
 }
 
-func PostReviewsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PostReviewsHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user from context
 	user, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
 
-	// Check for a user, or if the user agent is from the scraper
-	if !userLoggedIn && r.Header.Get("User-Agent") != "MunchCritic/1.0" {
-		w.WriteHeader(http.StatusUnauthorized)
+	// Check for a user, or an api key that can add reviews
+	if !userLoggedIn && !middleware.HasScope(r.Context(), models.ScopeReviewsWrite) {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to add a review")
 		return
 	}
 
+	// Reviews from a scraper account belong to the original reviewer rather than the account
+	reviewerLoggedIn := userLoggedIn && !middleware.HasRole(r.Context(), models.RoleScraper)
+
 	reviewDecoder := json.NewDecoder(r.Body)
 	reviewDecoder.DisallowUnknownFields()
 
@@ -40,23 +43,23 @@ func PostReviewsHandler(w http.ResponseWriter, r *http.Request) {
 	var newReview newReviewRequest
 	err := reviewDecoder.Decode(&newReview)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidJSON(w, r, err)
 		return
 	}
 
-	// Make sure required fields set
-	if (!userLoggedIn && newReview.ReviewerName == "") ||
-		newReview.FoodTruck == nil ||
-		newReview.Rating == nil {
-		w.WriteHeader(http.StatusBadRequest)
+	// Make sure required fields set, reviews not from a logged in user need the reviewer's name
+	fieldErrors := validation.Struct(&newReview)
+	if !reviewerLoggedIn && newReview.ReviewerName == "" {
+		fieldErrors = append(fieldErrors, validation.Missing("reviewerName"))
+	}
+	if writeValidationErrors(w, r, fieldErrors) {
 		return
 	}
 
 	// Lookup food truck
-	var foodTruck models.JSONFoodTruck
-	err = Db.Collection("foodTrucks").FindOne(r.Context(), dbutils.WithIDQuery(*newReview.FoodTruck)).Decode(&foodTruck)
+	foodTruck, err := s.FoodTrucks.Get(r.Context(), *newReview.FoodTruck)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
 		return
 	}
 
@@ -76,7 +79,7 @@ func PostReviewsHandler(w http.ResponseWriter, r *http.Request) {
 		origin = "munchapp"
 	}
 	reviewer := ""
-	if userLoggedIn {
+	if reviewerLoggedIn {
 		reviewer = user
 	}
 
@@ -92,28 +95,28 @@ func PostReviewsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add review to database
-	_, err = Db.Collection("reviews").InsertOne(r.Context(), addedReview)
+	err = s.Reviews.Add(r.Context(), addedReview)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Review could not be added")
 		return
 	}
 
 	// Attach review to user
-	if userLoggedIn {
-		_, err = Db.Collection("users").UpdateOne(r.Context(), dbutils.WithIDQuery(user), dbutils.PushReview(uuid.String()))
+	if reviewerLoggedIn {
+		err = s.Users.AddReview(r.Context(), user, uuid.String())
 		if err != nil {
 			log.Printf("ERROR: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Review could not be added to the user")
 			return
 		}
 	}
 
 	// Attach review to food truck
-	_, err = Db.Collection("foodTrucks").UpdateOne(r.Context(), dbutils.WithIDQuery(*newReview.FoodTruck), dbutils.UpdateFoodTruckWithReview(newAvgRating, uuid.String()))
+	err = s.FoodTrucks.AddReview(r.Context(), *newReview.FoodTruck, uuid.String(), newAvgRating)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Review could not be added to the food truck")
 		return
 	}
 
@@ -122,89 +125,82 @@ func PostReviewsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(addedReview)
 }
 
-func GetReviewsOfFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetReviewsOfFoodTruckHandler(w http.ResponseWriter, r *http.Request) {
 	// Get food truck id from route params
 	params := mux.Vars(r)
 	foodTruckID, foodTruckIDExists := params["foodTruckID"]
 
-	log.Printf("%v", params)
-
 	if !foodTruckIDExists {
-		w.WriteHeader(http.StatusBadRequest)
+		writeMissingField(w, r, "foodTruckID")
 		return
 	}
 
-	// Check that food truck exists
-	var foodTruck models.JSONFoodTruck
-	foodTrucksCollection := Db.Collection("foodTrucks")
-	err := foodTrucksCollection.FindOne(r.Context(), dbutils.WithIDQuery(foodTruckID)).Decode(&foodTruck)
+	page, valid := parsePage(w, r)
+	if !valid {
+		return
+	}
 
+	// Check that food truck exists
+	_, err := s.FoodTrucks.Get(r.Context(), foodTruckID)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Food truck not found")
 		return
 	}
 
-	// Get all reviews with foodtruck from the database into a cursor
-	reviewsCollection := Db.Collection("reviews")
-	cur, err := reviewsCollection.Find(r.Context(), dbutils.WithIDsQuery(foodTruck.Reviews))
+	// Get a page of reviews of the food truck from the database
+	reviews, nextCursor, err := s.Reviews.ListByFoodTruck(r.Context(), foodTruckID, page)
+	if err == store.ErrInvalidCursor {
+		writeInvalidCursor(w, r)
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Reviews could not be found")
 		return
 	}
 
-	// Get reviews from cursor, convert to empty slice if no reviews in DB
-	var reviews []models.JSONReview
-	cur.All(r.Context(), &reviews)
-	if reviews == nil {
-		reviews = make([]models.JSONReview, 0)
-	}
-
 	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(reviews)
+	writePage(w, reviews, nextCursor)
 }
 
-func GetReviewsHandler(w http.ResponseWriter, r *http.Request) {
-	// Get all reviews from the database into a cursor
-	reviewsCollection := Db.Collection("reviews")
-	cur, err := reviewsCollection.Find(r.Context(), bson.D{})
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("ERROR: %v", err)
+func (s *Server) GetReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	page, valid := parsePage(w, r)
+	if !valid {
 		return
 	}
 
-	// Get reviews from cursor, convert to empty slice if no reviews in DB
-	var reviews []models.JSONReview
-	cur.All(r.Context(), &reviews)
-	if reviews == nil {
-		reviews = make([]models.JSONReview, 0)
+	// Get a page of reviews from the database
+	reviews, nextCursor, err := s.Reviews.List(r.Context(), page)
+	if err == store.ErrInvalidCursor {
+		writeInvalidCursor(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Reviews could not be found")
+		return
 	}
 
 	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(reviews)
+	writePage(w, reviews, nextCursor)
 }
 
-func GetReviewHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetReviewHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get review ID from params
 	params := mux.Vars(r)
 	reviewID, reviewIDExists := params["reviewID"]
 
 	if !reviewIDExists {
-		w.WriteHeader(http.StatusBadRequest)
+		writeMissingField(w, r, "reviewID")
 		return
 	}
 
 	// Get review from database
-	var review models.JSONReview
-	reviewsCollection := Db.Collection("reviews")
-	err := reviewsCollection.FindOne(r.Context(), dbutils.WithIDQuery(reviewID)).Decode(&review)
+	review, err := s.Reviews.Get(r.Context(), reviewID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Review could not be found")
 		return
 	}
 
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -17,7 +18,7 @@ func TestReviewsGetEmpty(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/reviews", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewsHandler)
+	handler := http.HandlerFunc(testServer.GetReviewsHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -25,8 +26,9 @@ func TestReviewsGetEmpty(t *testing.T) {
 		t.Errorf("getting reviews of invalid food truck expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var reviews []models.JSONReview
-	json.NewDecoder(rr.Body).Decode(&reviews)
+	var page reviewPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	reviews := page.Items
 
 	if len(reviews) != 0 {
 		t.Errorf("getting all reviews of empty db expected 0 elements, but got %v", len(reviews))
@@ -43,7 +45,7 @@ func TestReviewsGetNonEmpty(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/reviews", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewsHandler)
+	handler := http.HandlerFunc(testServer.GetReviewsHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -51,8 +53,9 @@ func TestReviewsGetNonEmpty(t *testing.T) {
 		t.Errorf("getting reviews of invalid food truck expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var reviews []models.JSONReview
-	json.NewDecoder(rr.Body).Decode(&reviews)
+	var page reviewPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	reviews := page.Items
 
 	if len(reviews) != 1 {
 		t.Errorf("getting all reviews expected 1 element, but got %v", len(reviews))
@@ -63,6 +66,45 @@ func TestReviewsGetNonEmpty(t *testing.T) {
 	}
 }
 
+func TestReviewsGetPages(t *testing.T) {
+	tests.ClearDB()
+	date := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests.AddReview(models.JSONReview{ID: "oldest", Date: date.Add(-time.Hour)})
+	tests.AddReview(models.JSONReview{ID: "newest", Date: date.Add(time.Hour)})
+	tests.AddReview(models.JSONReview{ID: "tiedb", Date: date})
+	tests.AddReview(models.JSONReview{ID: "tieda", Date: date})
+	handler := http.HandlerFunc(testServer.GetReviewsHandler)
+
+	var first reviewPage
+	getTestPage(t, handler, "/reviews?limit=2", &first)
+	if len(first.Items) != 2 || first.Items[0].ID != "newest" || first.Items[1].ID != "tieda" {
+		t.Errorf("expected first page to have the newest reviews, but got %v", first.Items)
+	}
+
+	var second reviewPage
+	getTestPage(t, handler, "/reviews?limit=2&cursor="+first.NextCursor, &second)
+	if len(second.Items) != 2 || second.Items[0].ID != "tiedb" || second.Items[1].ID != "oldest" {
+		t.Errorf("expected second page to have the oldest reviews, but got %v", second.Items)
+	}
+	if second.NextCursor != "" {
+		t.Errorf("expected last page not to have a next cursor, but got %v", second.NextCursor)
+	}
+}
+
+func TestReviewsGetInvalidCursor(t *testing.T) {
+	tests.ClearDB()
+
+	req, _ := http.NewRequest("GET", "/reviews?cursor=notacursor", nil)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.GetReviewsHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("getting reviews with invalid cursor expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
 func TestReviewsOfFoodTruckGetInvalidID(t *testing.T) {
 	tests.ClearDB()
 
@@ -72,7 +114,7 @@ func TestReviewsOfFoodTruckGetInvalidID(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewsOfFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.GetReviewsOfFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusNotFound
@@ -86,7 +128,7 @@ func TestReviewsOfFoodTruckGetInvalid(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/reviews/foodtruck", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewsOfFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.GetReviewsOfFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -115,7 +157,7 @@ func TestReviewsOfFoodTruckGetValidWithReview(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewsOfFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.GetReviewsOfFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -123,8 +165,9 @@ func TestReviewsOfFoodTruckGetValidWithReview(t *testing.T) {
 		t.Errorf("getting reviews of valid food truck expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var reviews []models.JSONReview
-	json.NewDecoder(rr.Body).Decode(&reviews)
+	var page reviewPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	reviews := page.Items
 
 	if len(reviews) != 1 {
 		t.Errorf("getting reviews of valid food truck expected 1 element, but got %v", len(reviews))
@@ -150,7 +193,7 @@ func TestReviewsOfFoodTruckGetValidWithoutReview(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewsOfFoodTruckHandler)
+	handler := http.HandlerFunc(testServer.GetReviewsOfFoodTruckHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -158,14 +201,40 @@ func TestReviewsOfFoodTruckGetValidWithoutReview(t *testing.T) {
 		t.Errorf("getting reviews of valid food truck expected status code of %v, but got %v", expected, rr.Code)
 	}
 
-	var reviews []models.JSONReview
-	json.NewDecoder(rr.Body).Decode(&reviews)
+	var page reviewPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	reviews := page.Items
 
 	if len(reviews) != 0 {
 		t.Errorf("getting reviews of valid food truck expected 0 elements, but got %v", len(reviews))
 	}
 }
 
+func TestReviewsOfFoodTruckGetPages(t *testing.T) {
+	tests.ClearDB()
+	date := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests.AddFoodTruck(models.JSONFoodTruck{ID: "test", Reviews: []string{"first", "second", "third"}})
+	tests.AddReview(models.JSONReview{ID: "first", FoodTruck: "test", Date: date})
+	tests.AddReview(models.JSONReview{ID: "second", FoodTruck: "test", Date: date.Add(time.Hour)})
+	tests.AddReview(models.JSONReview{ID: "third", FoodTruck: "test", Date: date.Add(2 * time.Hour)})
+	tests.AddReview(models.JSONReview{ID: "other", FoodTruck: "other", Date: date.Add(3 * time.Hour)})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testServer.GetReviewsOfFoodTruckHandler(w, mux.SetURLVars(r, map[string]string{"foodTruckID": "test"}))
+	})
+
+	var first reviewPage
+	getTestPage(t, handler, "/reviews/foodtruck/test?limit=2", &first)
+	if len(first.Items) != 2 || first.Items[0].ID != "third" || first.Items[1].ID != "second" {
+		t.Errorf("expected first page to have the food truck's newest reviews, but got %v", first.Items)
+	}
+
+	var second reviewPage
+	getTestPage(t, handler, "/reviews/foodtruck/test?limit=2&cursor="+first.NextCursor, &second)
+	if len(second.Items) != 1 || second.Items[0].ID != "first" || second.NextCursor != "" {
+		t.Errorf("expected last page to have the food truck's oldest review, but got %v", second.Items)
+	}
+}
+
 func TestReviewsPostUnauthorized(t *testing.T) {
 	tests.ClearDB()
 
@@ -174,7 +243,7 @@ func TestReviewsPostUnauthorized(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostReviewsHandler)
+	handler := http.HandlerFunc(testServer.PostReviewsHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusUnauthorized
@@ -183,6 +252,41 @@ func TestReviewsPostUnauthorized(t *testing.T) {
 	}
 }
 
+func TestReviewsPostSpoofedScraper(t *testing.T) {
+	tests.ClearDB()
+
+	reviewsRequest := newReviewRequest{}
+	body, _ := json.Marshal(reviewsRequest)
+
+	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
+	req.Header.Set("User-Agent", "MunchCritic/1.0")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostReviewsHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("adding review with only the scraper's user agent expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestReviewsPostWrongScope(t *testing.T) {
+	tests.ClearDB()
+
+	reviewsRequest := newReviewRequest{}
+	body, _ := json.Marshal(reviewsRequest)
+
+	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockAPIKey(models.ScopeTrucksWrite)(http.HandlerFunc(testServer.PostReviewsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("adding review with an api key without the reviews scope expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
 func TestReviewsPostInvalidRequestClient(t *testing.T) {
 	tests.ClearDB()
 
@@ -193,7 +297,7 @@ func TestReviewsPostInvalidRequestClient(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostReviewsHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostReviewsHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -211,9 +315,8 @@ func TestReviewsPostInvalidRequestScraper(t *testing.T) {
 	body, _ := json.Marshal(reviewsRequest)
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
-	req.Header.Set("User-Agent", "MunchCritic/1.0")
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostReviewsHandler)
+	handler := tests.AuthenticateMockAPIKey(models.ScopeReviewsWrite)(http.HandlerFunc(testServer.PostReviewsHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -230,7 +333,7 @@ func TestReviewsPostInvalidBody(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostReviewsHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostReviewsHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -253,7 +356,7 @@ func TestReviewsPostInvalidFoodTruck(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostReviewsHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostReviewsHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusNotFound
@@ -262,6 +365,42 @@ func TestReviewsPostInvalidFoodTruck(t *testing.T) {
 	}
 }
 
+func TestReviewsPostInvalidRating(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID: "testtruck",
+	})
+
+	var rating float64 = 6.0
+	name := "testtruck"
+	reviewsRequest := newReviewRequest{
+		FoodTruck: &name,
+		Comment:   "Amazing food",
+		Rating:    &rating,
+	}
+	body, _ := json.Marshal(reviewsRequest)
+
+	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostReviewsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("adding review with rating over 5 expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if len(response.Error.Details) != 1 || response.Error.Details[0].Field != "rating" {
+		t.Errorf("expected rating to be invalid, but got %v", response.Error.Details)
+	}
+	if foodTruck := tests.GetFoodTruck("testtruck"); len(foodTruck.Reviews) != 0 {
+		t.Error("adding review with invalid rating should not have added the review")
+	}
+}
+
 func TestReviewsPostValidClient(t *testing.T) {
 	tests.ClearDB()
 
@@ -286,7 +425,7 @@ func TestReviewsPostValidClient(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostReviewsHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostReviewsHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -335,9 +474,8 @@ func TestReviewsPostValidScraper(t *testing.T) {
 	body, _ := json.Marshal(reviewsRequest)
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
-	req.Header.Set("User-Agent", "MunchCritic/1.0")
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostReviewsHandler)
+	handler := tests.AuthenticateMockAPIKey(models.ScopeReviewsWrite)(http.HandlerFunc(testServer.PostReviewsHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -359,6 +497,53 @@ func TestReviewsPostValidScraper(t *testing.T) {
 	}
 }
 
+func TestReviewsPostValidScraperAccount(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddFoodTruck(models.JSONFoodTruck{
+		ID:      "testfoodtruck",
+		Reviews: []string{},
+	})
+	tests.AddUser(models.JSONUser{
+		ID:      "testuser",
+		Reviews: []string{},
+	})
+
+	var rating float64 = 4.0
+	name := "testfoodtruck"
+	reviewsRequest := newReviewRequest{
+		ReviewerName: "Test User",
+		FoodTruck:    &name,
+		Comment:      "Amazing food",
+		Rating:       &rating,
+		Origin:       "Yelp",
+	}
+	body, _ := json.Marshal(reviewsRequest)
+
+	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUserWithRoles(models.RoleScraper)(http.HandlerFunc(testServer.PostReviewsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("adding review as scraper account expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var addedReturnedReview models.JSONReview
+	json.NewDecoder(rr.Body).Decode(&addedReturnedReview)
+
+	addedReview := tests.GetReview(addedReturnedReview.ID)
+	if addedReview == nil || addedReview.Reviewer != "" || addedReview.ReviewerName != "Test User" {
+		t.Error("adding review as scraper account should credit the original reviewer")
+	}
+
+	scraperUser := tests.GetUser("testuser")
+	if scraperUser == nil || len(scraperUser.Reviews) != 0 {
+		t.Error("adding review as scraper account should not attach review to the account")
+	}
+}
+
 func TestReviewsPostNewRating(t *testing.T) {
 	tests.ClearDB()
 
@@ -383,7 +568,7 @@ func TestReviewsPostNewRating(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/reviews", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PostReviewsHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostReviewsHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -413,7 +598,7 @@ func TestReviewGet(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewHandler)
+	handler := http.HandlerFunc(testServer.GetReviewHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -438,7 +623,7 @@ func TestReviewGetNoID(t *testing.T) {
 	})
 	req, _ := http.NewRequest("GET", "/reviews", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetReviewHandler)
+	handler := http.HandlerFunc(testServer.GetReviewHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -1,55 +1,133 @@
 package routes
 
 import (
-	"context"
-	"log"
-	"munchserver/secrets"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"mime/multipart"
+	"munchserver/blobstore"
+	"munchserver/mailer"
+	"munchserver/models"
+	"munchserver/store"
 	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// testMailer keeps the emails sent during tests
+var testMailer = mailer.NewMemoryMailer()
+
+// testServer is the server most tests run their handlers on
+var testServer *Server
+
+// testBlobs keeps the files uploaded during tests in a temporary directory
+var testBlobs *blobstore.LocalStore
+
 type invalidRequestBody struct {
 	InvalidField string `json:"invalidField"`
 }
 
-func TestMain(m *testing.M) {
-	// Connect to MongoDB
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(secrets.GetMongoURI()))
-	if err != nil {
-		panic(err)
-	}
-
-	Db = client.Database(secrets.GetTestMongoDBName())
-	// Inject db to tests
-	tests.Db = Db
+// foodTruckPage is a page of food trucks as handlers send it
+type foodTruckPage struct {
+	Items      []store.FoodTruckWithDistance `json:"items"`
+	NextCursor string                        `json:"nextCursor"`
+}
 
-	tests.ClearDB()
+// reviewPage is a page of reviews as handlers send it
+type reviewPage struct {
+	Items      []models.JSONReview `json:"items"`
+	NextCursor string              `json:"nextCursor"`
+}
 
-	// Setup db indexes
-	userIndex := mongo.IndexModel{
-		Keys:    bson.M{"email": 1},
-		Options: options.Index().SetUnique(true).SetBackground(true),
-	}
-	_, err = Db.Collection("users").Indexes().CreateOne(context.TODO(), userIndex)
+func TestMain(m *testing.M) {
+	blobDir, err := ioutil.TempDir("", "munch-uploads")
 	if err != nil {
-		log.Fatal(err)
-	}
-	locationIndex := mongo.IndexModel{
-		Keys: bson.M{"location": "2dsphere"},
+		panic(err)
 	}
-	_, err = Db.Collection("foodTrucks").Indexes().CreateOne(context.TODO(), locationIndex)
+	testBlobs, err = blobstore.NewLocalStore(blobDir, "http://localhost/uploads")
 	if err != nil {
-		log.Fatal(err)
+		panic(err)
 	}
 
+	// Tests sign tokens with the development secret
+	os.Setenv("MUNCH_ENV", "development")
+
+	// Share the in-memory stores with tests
+	testServer = NewServer(tests.Stores(), testBlobs, testMailer)
+
 	code := m.Run()
 
 	tests.ClearDB()
+	os.RemoveAll(blobDir)
 
 	os.Exit(code)
 }
+
+// newIsolatedTestServer creates a server with its own stores and mailer
+func newIsolatedTestServer() *Server {
+	return NewServer(store.NewMemoryStores(), testBlobs, mailer.NewMemoryMailer())
+}
+
+// getTestPage gets the url with the handler and decodes the page it sends, stopping the test if it isn't sent
+func getTestPage(t *testing.T, handler http.Handler, url string, page interface{}) {
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Fatalf("getting page %v expected status code of %v, but got %v", url, expected, rr.Code)
+	}
+	json.NewDecoder(rr.Body).Decode(page)
+}
+
+// newImageUploadRequest creates a request uploading the image as a multipart form
+func newImageUploadRequest(url string, image []byte) *http.Request {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, _ := form.CreateFormFile("image", "image.jpg")
+	part.Write(image)
+	form.Close()
+
+	req, _ := http.NewRequest("PUT", url, body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+// testJPEG encodes a gray JPEG image of the size
+func testJPEG(width int, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	var buffer bytes.Buffer
+	jpeg.Encode(&buffer, img, nil)
+	return buffer.Bytes()
+}
+
+// presignTestUpload starts a presigned upload with the handler and puts the image at the presigned url, returning
+// the upload's key
+func presignTestUpload(t *testing.T, handler http.Handler, image []byte) string {
+	body, _ := json.Marshal(map[string]interface{}{"contentType": "image/jpeg", "size": len(image)})
+	req, _ := http.NewRequest("POST", "/uploads", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("starting presigned upload expected status code of %v, but got %v", http.StatusOK, rr.Code)
+	}
+	var presigned presignUploadResponse
+	json.NewDecoder(rr.Body).Decode(&presigned)
+
+	// Upload the image to the local blob store like a client would
+	req, _ = http.NewRequest(presigned.Method, presigned.URL, bytes.NewReader(image))
+	for name, value := range presigned.Headers {
+		req.Header.Set(name, value)
+	}
+	rr = httptest.NewRecorder()
+	testServer.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("putting presigned upload expected status code of %v, but got %v", http.StatusOK, rr.Code)
+	}
+	return presigned.Key
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"munchserver/blobstore"
+	"munchserver/mailer"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/oidc"
+	"munchserver/passwordpolicy"
+	"munchserver/store"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Server holds what the route handlers depend on, so more than one can run in a process
+type Server struct {
+	FoodTrucks    store.FoodTruckStore
+	Reviews       store.ReviewStore
+	Users         store.UserStore
+	Claims        store.ClaimStore
+	APIKeys       store.APIKeyStore
+	Sessions      store.SessionStore
+	RefreshTokens store.RefreshTokenStore
+	RevokedTokens store.RevokedTokenStore
+	UserTokens    store.UserTokenStore
+	LoginAttempts store.LoginAttemptStore
+	Router        *mux.Router
+	Blobs         blobstore.BlobStore
+	Mailer        mailer.Mailer
+	// OIDCProviders are the providers users can log in with, by name
+	OIDCProviders map[string]*oidc.Provider
+	// PasswordPolicy is what new passwords must meet
+	PasswordPolicy passwordpolicy.Policy
+}
+
+// NewServer creates a server using the given stores, blob store and mailer, with all routes setup
+func NewServer(stores store.Stores, blobs blobstore.BlobStore, mailer mailer.Mailer) *Server {
+	s := &Server{
+		FoodTrucks:     stores.FoodTrucks,
+		Reviews:        stores.Reviews,
+		Users:          stores.Users,
+		Claims:         stores.Claims,
+		APIKeys:        stores.APIKeys,
+		Sessions:       stores.Sessions,
+		RefreshTokens:  stores.RefreshTokens,
+		RevokedTokens:  stores.RevokedTokens,
+		UserTokens:     stores.UserTokens,
+		LoginAttempts:  stores.LoginAttempts,
+		Blobs:          blobs,
+		Mailer:         mailer,
+		OIDCProviders:  make(map[string]*oidc.Provider),
+		PasswordPolicy: passwordpolicy.DefaultPolicy,
+	}
+
+	// Setup http router
+	router := mux.NewRouter()
+	router.Use(middleware.RequestID)
+	router.HandleFunc("/register", s.PostRegisterHandler).Methods("POST")
+	router.HandleFunc("/login", s.PostLoginHandler).Methods("POST")
+	router.HandleFunc("/token/refresh", s.PostRefreshTokenHandler).Methods("POST")
+	router.HandleFunc("/logout", s.PostLogoutHandler).Methods("POST")
+	router.HandleFunc("/password/forgot", s.PostForgotPasswordHandler).Methods("POST")
+	router.HandleFunc("/password/reset", s.PostResetPasswordHandler).Methods("POST")
+	router.HandleFunc("/login/2fa", s.PostTwoFactorLoginHandler).Methods("POST")
+	router.HandleFunc("/login/oidc/{provider}", s.PostOIDCLoginHandler).Methods("POST")
+	router.HandleFunc("/verify-email", s.PostVerifyEmailHandler).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", s.GetJWKSHandler).Methods("GET")
+	router.HandleFunc("/foodtrucks", s.GetFoodTrucksHandler).Methods("GET")
+	router.HandleFunc("/foodtrucks/{foodTruckID}", s.GetFoodTruckHandler).Methods("GET")
+	router.HandleFunc("/reviews", s.GetReviewsHandler).Methods("GET")
+	router.HandleFunc("/reviews/{reviewID}", s.GetReviewHandler).Methods("GET")
+	router.HandleFunc("/reviews/foodtruck/{foodTruckID}", s.GetReviewsOfFoodTruckHandler).Methods("GET")
+	router.HandleFunc("/contributors", s.GetContributorsHandler).Methods("GET")
+	router.HandleFunc("/users/{userID}", s.GetUserHandler).Methods("GET")
+
+	// Serve uploads kept on disk
+	if localBlobs, ok := blobs.(*blobstore.LocalStore); ok {
+		router.PathPrefix(localBlobs.Path()).Handler(localBlobs).Methods("GET", "PUT")
+	}
+
+	// Auth required routes
+	router.Use(middleware.AuthenticateUser(s.ValidateToken))
+	router.Use(middleware.AuthenticateAPIKey(s.ValidateAPIKey))
+	router.HandleFunc("/profile", s.GetProfileHandler).Methods("GET")
+	router.HandleFunc("/profile/upload", s.PutProfileUploadHandler).Methods("PUT")
+	router.HandleFunc("/profile/uploads", s.PostProfileUploadHandler).Methods("POST")
+	router.HandleFunc("/profile/uploads/complete", s.PostProfileUploadCompleteHandler).Methods("POST")
+	router.HandleFunc("/foodtrucks", s.PostFoodTrucksHandler).Methods("POST")
+	router.HandleFunc("/verify-email/resend", s.PostResendVerificationHandler).Methods("POST")
+	router.HandleFunc("/foodtrucks/claim/{foodTruckID}", s.VerifiedEmailOnly(s.PutClaimFoodTruckHandler)).Methods("PUT")
+	router.HandleFunc("/foodtrucks/upload/{foodTruckID}", s.FoodTruckOwnerOnly(s.PutFoodTruckUploadHandler)).Methods("PUT")
+	router.HandleFunc("/foodtrucks/{foodTruckID}/photos/uploads", s.FoodTruckOwnerOnly(s.PostPhotoUploadHandler)).Methods("POST")
+	router.HandleFunc("/foodtrucks/{foodTruckID}/photos/uploads/complete", s.FoodTruckOwnerOnly(s.PostPhotoUploadCompleteHandler)).Methods("POST")
+	router.HandleFunc("/foodtrucks/{foodTruckID}/photos/order", s.FoodTruckOwnerOnly(s.PutPhotoOrderHandler)).Methods("PUT")
+	router.HandleFunc("/foodtrucks/{foodTruckID}/photos/{photoID}", s.FoodTruckOwnerOnly(s.PutPhotoHandler)).Methods("PUT")
+	router.HandleFunc("/foodtrucks/{foodTruckID}/photos/{photoID}", s.FoodTruckOwnerOnly(s.DeletePhotoHandler)).Methods("DELETE")
+	router.HandleFunc("/foodtrucks/{foodTruckID}/photos/{photoID}/cover", s.FoodTruckOwnerOnly(s.PutCoverPhotoHandler)).Methods("PUT")
+	router.HandleFunc("/reviews", s.VerifiedEmailOnly(s.PostReviewsHandler)).Methods("POST")
+	router.HandleFunc("/users/favorite/{foodTruckID}", s.PutFavoriteHandler).Methods("PUT")
+	router.HandleFunc("/profile", s.PutUpdateProfileHandler).Methods("PUT")
+	router.HandleFunc("/profile/password", s.PutChangePasswordHandler).Methods("PUT")
+	router.HandleFunc("/profile/export", s.GetProfileExportHandler).Methods("GET")
+	router.HandleFunc("/profile/sessions", s.GetSessionsHandler).Methods("GET")
+	router.HandleFunc("/profile/sessions", s.DeleteOtherSessionsHandler).Methods("DELETE")
+	router.HandleFunc("/profile/sessions/{sessionID}", s.DeleteSessionHandler).Methods("DELETE")
+	router.HandleFunc("/profile/2fa/setup", s.PostTwoFactorSetupHandler).Methods("POST")
+	router.HandleFunc("/profile/2fa/confirm", s.PostTwoFactorConfirmHandler).Methods("POST")
+	router.HandleFunc("/profile/2fa/disable", s.PostTwoFactorDisableHandler).Methods("POST")
+	router.HandleFunc("/profile/2fa/recovery-codes", s.PostRecoveryCodesHandler).Methods("POST")
+	router.HandleFunc("/profile", s.DeleteProfileHandler).Methods("DELETE")
+	router.HandleFunc("/profile/email", s.PutChangeEmailHandler).Methods("PUT")
+	router.HandleFunc("/foodtrucks/{foodTruckID}", s.FoodTruckOwnerOnly(s.PutFoodTrucksHandler)).Methods("PUT")
+	router.HandleFunc("/claims/{claimID}/verify", s.PutVerifyClaimHandler).Methods("PUT")
+
+	// Admin only routes
+	adminOnly := middleware.RequireRoles(models.RoleAdmin)
+	router.Handle("/claims", adminOnly(http.HandlerFunc(s.GetClaimsHandler))).Methods("GET")
+	router.Handle("/claims/{claimID}/approve", adminOnly(http.HandlerFunc(s.PutApproveClaimHandler))).Methods("PUT")
+	router.Handle("/claims/{claimID}/reject", adminOnly(http.HandlerFunc(s.PutRejectClaimHandler))).Methods("PUT")
+	router.Handle("/apikeys", adminOnly(http.HandlerFunc(s.GetAPIKeysHandler))).Methods("GET")
+	router.Handle("/apikeys", adminOnly(http.HandlerFunc(s.PostAPIKeysHandler))).Methods("POST")
+	router.Handle("/apikeys/{apiKeyID}", adminOnly(http.HandlerFunc(s.DeleteAPIKeyHandler))).Methods("DELETE")
+	router.Handle("/users/{userID}/unlock", adminOnly(http.HandlerFunc(s.PutUnlockUserHandler))).Methods("PUT")
+
+	s.Router = router
+	return s
+}
+
+// ServeHTTP lets the server be used as a http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Router.ServeHTTP(w, r)
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"munchserver/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerIsolatedInstances(t *testing.T) {
+	firstServer := newIsolatedTestServer()
+	secondServer := newIsolatedTestServer()
+
+	// Register through the first server's router
+	name := "tester"
+	email := "isolated@example.com"
+	password := "tasty tacos 4 lunch"
+	dob, _ := time.Parse(time.RFC3339, "1969-04-20T05:00:00.000Z")
+	registerBody := registerRequest{
+		NameFirst:   &name,
+		NameLast:    &name,
+		Email:       &email,
+		Password:    &password,
+		DateOfBirth: &dob,
+	}
+	body, _ := json.Marshal(registerBody)
+
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	firstServer.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Fatalf("register on an isolated server expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// Only the first server should have the user
+	_, err := firstServer.Users.GetByEmail(context.TODO(), email)
+	if err != nil {
+		t.Errorf("expected the registering server to have the user, but got %v", err)
+	}
+	_, err = secondServer.Users.GetByEmail(context.TODO(), email)
+	if err != store.ErrNotFound {
+		t.Errorf("expected the other server not to have the user, but got %v", err)
+	}
+}
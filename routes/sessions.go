@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/store"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type sessionResponse struct {
+	models.JSONSession
+	// Current is true for the session making the request
+	Current bool `json:"current"`
+}
+
+// GetSessionsHandler lists the devices the logged in user is logged in on
+func (s *Server) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to see your sessions")
+		return
+	}
+	claims, _ := r.Context().Value(middleware.ClaimsKey).(middleware.Claims)
+
+	// Get active sessions, most recently used first
+	sessions, err := s.Sessions.ListActive(r.Context(), userID, time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Sessions could not be found")
+		return
+	}
+
+	// Mark which session is this one
+	sessionResponses := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, sessionResponse{
+			JSONSession: session,
+			Current:     session.ID == claims.SessionID,
+		})
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionResponses)
+}
+
+// DeleteSessionHandler logs the user out of one of their sessions
+func (s *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	// Checks for session ID
+	params := mux.Vars(r)
+	sessionID, sessionIDExists := params["sessionID"]
+	if !sessionIDExists {
+		writeMissingField(w, r, "sessionID")
+		return
+	}
+
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to log out a session")
+		return
+	}
+
+	// Make sure the session belongs to the user
+	session, err := s.Sessions.Get(r.Context(), sessionID)
+	if err != nil && err != store.ErrNotFound {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Session could not be found")
+		return
+	}
+	if err == store.ErrNotFound || session.User != userID {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Session not found")
+		return
+	}
+
+	err = s.revokeRefreshTokenFamily(r.Context(), sessionID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Session could not be logged out")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteOtherSessionsHandler logs the user out of every session except the one making the request
+func (s *Server) DeleteOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to log out your other sessions")
+		return
+	}
+	claims, _ := r.Context().Value(middleware.ClaimsKey).(middleware.Claims)
+
+	// Find the other sessions
+	sessions, err := s.Sessions.ListOthers(r.Context(), userID, claims.SessionID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Sessions could not be found")
+		return
+	}
+
+	for _, session := range sessions {
+		err = s.revokeRefreshTokenFamily(r.Context(), session.ID)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Sessions could not be logged out")
+			return
+		}
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
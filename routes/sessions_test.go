@@ -0,0 +1,153 @@
+package routes
+
+import (
+	"encoding/json"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// loginFrom issues tokens to the user as if they logged in from the device
+func loginFrom(user models.JSONUser, userAgent string) tokenResponse {
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.Header.Set("User-Agent", userAgent)
+	tokens, _ := testServer.issueTokens(req, user, "", time.Now())
+	return tokens
+}
+
+func TestSessionsGet(t *testing.T) {
+	tests.ClearDB()
+
+	user := models.JSONUser{
+		ID: "testuser",
+	}
+	tests.AddUser(user)
+	phoneTokens := loginFrom(user, "Munch iOS")
+	loginFrom(user, "Firefox")
+
+	req, _ := http.NewRequest("GET", "/profile/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+phoneTokens.Token)
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetSessionsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("getting sessions expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var sessions []sessionResponse
+	json.NewDecoder(rr.Body).Decode(&sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected two sessions, but got %v", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.Current != (session.UserAgent == "Munch iOS") {
+			t.Errorf("expected only the session making the request to be current, but got %v", session)
+		}
+	}
+}
+
+func TestSessionDeleteValid(t *testing.T) {
+	tests.ClearDB()
+
+	user := models.JSONUser{
+		ID: "testuser",
+	}
+	tests.AddUser(user)
+	phoneTokens := loginFrom(user, "Munch iOS")
+	laptopTokens := loginFrom(user, "Firefox")
+	laptopSessionID := tests.GetRefreshToken(hashToken(laptopTokens.RefreshToken)).Family
+
+	req, _ := http.NewRequest("DELETE", "/profile/sessions/"+laptopSessionID, nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"sessionID": laptopSessionID,
+	})
+	req.Header.Set("Authorization", "Bearer "+phoneTokens.Token)
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.DeleteSessionHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("deleting session expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	session := tests.GetSession(laptopSessionID)
+	if session == nil || !session.Revoked {
+		t.Error("deleting session should have revoked it")
+	}
+
+	// The laptop's access token should stop working right away
+	req, _ = http.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+laptopTokens.Token)
+	rr = httptest.NewRecorder()
+	handler = middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected = http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("getting profile from deleted session expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestSessionDeleteOtherUser(t *testing.T) {
+	tests.ClearDB()
+
+	otherUser := models.JSONUser{
+		ID: "otheruser",
+	}
+	tests.AddUser(otherUser)
+	otherTokens := loginFrom(otherUser, "Firefox")
+	otherSessionID := tests.GetRefreshToken(hashToken(otherTokens.RefreshToken)).Family
+
+	req, _ := http.NewRequest("DELETE", "/profile/sessions/"+otherSessionID, nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"sessionID": otherSessionID,
+	})
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.DeleteSessionHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusNotFound
+	if rr.Code != expected {
+		t.Errorf("deleting another user's session expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestOtherSessionsDelete(t *testing.T) {
+	tests.ClearDB()
+
+	user := models.JSONUser{
+		ID: "testuser",
+	}
+	tests.AddUser(user)
+	phoneTokens := loginFrom(user, "Munch iOS")
+	laptopTokens := loginFrom(user, "Firefox")
+
+	req, _ := http.NewRequest("DELETE", "/profile/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+phoneTokens.Token)
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.DeleteOtherSessionsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("deleting other sessions expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	phoneRefreshToken := tests.GetRefreshToken(hashToken(phoneTokens.RefreshToken))
+	if phoneRefreshToken == nil || phoneRefreshToken.Revoked {
+		t.Error("deleting other sessions should not have revoked the current session")
+	}
+	laptopRefreshToken := tests.GetRefreshToken(hashToken(laptopTokens.RefreshToken))
+	if laptopRefreshToken == nil || !laptopRefreshToken.Revoked {
+		t.Error("deleting other sessions should have revoked the other session")
+	}
+}
@@ -0,0 +1,279 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/secrets"
+	"munchserver/store"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// Access tokens are short lived, refresh tokens keep the user logged in
+const (
+	accessTokenLifetime  = time.Minute * 15
+	refreshTokenLifetime = time.Hour * 24 * 60
+)
+
+var (
+	errTokenRevoked   = errors.New("token has been revoked")
+	errNotAccessToken = errors.New("token is not an access token")
+)
+
+type refreshTokenRequest struct {
+	RefreshToken *string `json:"refreshToken"`
+}
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// ValidateToken checks that an access token hasn't been revoked and its user still exists
+func (s *Server) ValidateToken(ctx context.Context, claims *middleware.Claims) error {
+	// Tokens without an id can't be revoked, so they aren't accepted
+	if claims.Id == "" {
+		return errTokenRevoked
+	}
+
+	// Tokens for other purposes, like two factor challenges, have an audience and aren't access tokens
+	if claims.Audience != "" {
+		return errNotAccessToken
+	}
+
+	revoked, err := s.RevokedTokens.IsRevoked(ctx, claims.Id)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errTokenRevoked
+	}
+
+	// Tokens from a session that was logged out are no longer valid. Changing the password logs out every session, so
+	// tokens from a session that is still logged in were issued after the password last changed.
+	if claims.SessionID != "" {
+		session, err := s.Sessions.Get(ctx, claims.SessionID)
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		if err == nil {
+			if session.Revoked {
+				return errTokenRevoked
+			}
+			return nil
+		}
+	}
+
+	// Other tokens issued before the user's password changed are no longer valid. Tokens only have the second they were
+	// issued, so ones issued in the same second as the change can't be told apart and are rejected too.
+	user, err := s.Users.Get(ctx, claims.Subject)
+	if err != nil {
+		return err
+	}
+	if !user.TokensRevokedAt.IsZero() && claims.IssuedAt <= user.TokensRevokedAt.Unix() {
+		return errTokenRevoked
+	}
+	return nil
+}
+
+// PostRefreshTokenHandler exchanges a refresh token for a new access token and refresh token
+func (s *Server) PostRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode request
+	refreshDecoder := json.NewDecoder(r.Body)
+	refreshDecoder.DisallowUnknownFields()
+	var refresh refreshTokenRequest
+	err := refreshDecoder.Decode(&refresh)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if refresh.RefreshToken == nil {
+		writeMissingField(w, r, "refreshToken")
+		return
+	}
+
+	// Use up the refresh token
+	tokenHash := hashToken(*refresh.RefreshToken)
+	refreshToken, err := s.RefreshTokens.Use(r.Context(), tokenHash, time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+
+		// A refresh token being used twice means it was stolen, so log out everyone using its family
+		refreshToken, err = s.RefreshTokens.Get(r.Context(), tokenHash)
+		if err == nil && refreshToken.Used {
+			err = s.revokeRefreshTokenFamily(r.Context(), refreshToken.Family)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Refresh token is not valid")
+		return
+	}
+
+	// Find user in database, so the new token has their current roles
+	user, err := s.Users.Get(r.Context(), refreshToken.User)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Refresh token is not valid")
+		return
+	}
+
+	// Create new tokens in the same family
+	tokens, err := s.issueTokens(r, user, refreshToken.Family, refreshToken.AuthTime)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Tokens could not be issued")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// PostLogoutHandler revokes the refresh token's family and the access token used for the request
+func (s *Server) PostLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode request
+	logoutDecoder := json.NewDecoder(r.Body)
+	logoutDecoder.DisallowUnknownFields()
+	var logout refreshTokenRequest
+	err := logoutDecoder.Decode(&logout)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if logout.RefreshToken == nil {
+		writeMissingField(w, r, "refreshToken")
+		return
+	}
+
+	// Revoke every refresh token descended from the same login
+	refreshToken, err := s.RefreshTokens.Get(r.Context(), hashToken(*logout.RefreshToken))
+	if err == nil {
+		err = s.revokeRefreshTokenFamily(r.Context(), refreshToken.Family)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Tokens could not be revoked")
+			return
+		}
+	}
+
+	// Revoke the access token until it expires
+	claims, userLoggedIn := r.Context().Value(middleware.ClaimsKey).(middleware.Claims)
+	if userLoggedIn {
+		err = s.revokeAccessToken(r.Context(), claims)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Token could not be revoked")
+			return
+		}
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetJWKSHandler publishes the public keys so other services can verify access tokens
+func (s *Server) GetJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secrets.GetJWKS())
+}
+
+// issueTokens creates an access token for the user and a refresh token in the family, starting a new family if it is empty.
+// The family is the session of the device making the request, which is updated with where it was last used. The auth
+// time is when the user last logged in, so refreshing tokens doesn't make a login look recent.
+func (s *Server) issueTokens(r *http.Request, user models.JSONUser, family string, authTime time.Time) (tokenResponse, error) {
+	ctx := r.Context()
+	if family == "" {
+		familyUUID, err := uuid.NewRandom()
+		if err != nil {
+			return tokenResponse{}, err
+		}
+		family = familyUUID.String()
+	}
+
+	// Create a JWT for the user that expires in 15 minutes
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	now := time.Now()
+	claims := middleware.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(accessTokenLifetime).Unix(),
+			Subject:   user.ID,
+		},
+		Roles:     user.Roles,
+		SessionID: family,
+		AuthTime:  authTime.Unix(),
+	}
+	jwtString, err := secrets.SignJWT(claims)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	// Create a refresh token to get the next access token
+	refreshTokenString, err := generateToken(32)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	refreshToken := models.JSONRefreshToken{
+		ID:       hashToken(refreshTokenString),
+		Family:   family,
+		User:     user.ID,
+		Created:  now,
+		Expires:  now.Add(refreshTokenLifetime),
+		AuthTime: authTime,
+	}
+	err = s.RefreshTokens.Add(ctx, refreshToken)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	// Start or update the session
+	err = s.Sessions.Use(ctx, family, user.ID, r.UserAgent(), clientIP(r), now, refreshToken.Expires)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		Token:        jwtString,
+		RefreshToken: refreshTokenString,
+	}, nil
+}
+
+// revokeRefreshTokenFamily revokes every refresh token in the family and ends its session
+func (s *Server) revokeRefreshTokenFamily(ctx context.Context, family string) error {
+	err := s.RefreshTokens.RevokeFamily(ctx, family)
+	if err != nil {
+		return err
+	}
+	return s.Sessions.Revoke(ctx, family)
+}
+
+// revokeAccessToken adds an access token to the revocation list until it expires
+func (s *Server) revokeAccessToken(ctx context.Context, claims middleware.Claims) error {
+	return s.RevokedTokens.Add(ctx, models.JSONRevokedToken{
+		ID:      claims.Id,
+		Expires: time.Unix(claims.ExpiresAt, 0),
+	})
+}
+
+// revokeUserRefreshTokens revokes every refresh token of the user, logging them out on every device
+func (s *Server) revokeUserRefreshTokens(ctx context.Context, userID string) error {
+	err := s.RefreshTokens.RevokeByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.Sessions.RevokeByUser(ctx, userID)
+}
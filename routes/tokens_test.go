@@ -0,0 +1,356 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/secrets"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestRefreshTokenPostValid(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Roles: []string{models.RoleOwner},
+	})
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	tests.AddRefreshToken(models.JSONRefreshToken{
+		ID:       hashToken("testrefreshtoken"),
+		Family:   "testfamily",
+		User:     "testuser",
+		Expires:  time.Now().Add(time.Hour),
+		AuthTime: authTime,
+	})
+
+	refreshToken := "testrefreshtoken"
+	body, _ := json.Marshal(refreshTokenRequest{
+		RefreshToken: &refreshToken,
+	})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostRefreshTokenHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("refreshing with valid refresh token expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var tokens tokenResponse
+	json.NewDecoder(rr.Body).Decode(&tokens)
+
+	usedToken := tests.GetRefreshToken(hashToken("testrefreshtoken"))
+	if usedToken == nil || !usedToken.Used {
+		t.Error("refreshing should have used up the refresh token")
+	}
+
+	newToken := tests.GetRefreshToken(hashToken(tokens.RefreshToken))
+	if newToken == nil || newToken.Family != "testfamily" || newToken.Used {
+		t.Error("refreshing should have created a new refresh token in the same family")
+	}
+
+	var claims middleware.Claims
+	_, err := jwt.ParseWithClaims(tokens.Token, &claims, secrets.GetJWTSecret)
+	if err != nil || claims.Subject != "testuser" || len(claims.Roles) != 1 {
+		t.Errorf("refreshing should have created an access token for the user, but got error %v", err)
+	}
+
+	// Refreshing isn't logging in again, so the tokens keep the time of the login
+	if claims.AuthTime != authTime.Unix() || newToken == nil || !newToken.AuthTime.Equal(authTime) {
+		t.Errorf("refreshing should have kept the auth time %v, but got %v", authTime.Unix(), claims.AuthTime)
+	}
+}
+
+func TestRefreshTokenPostReused(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+	tests.AddRefreshToken(models.JSONRefreshToken{
+		ID:      hashToken("stolenrefreshtoken"),
+		Family:  "testfamily",
+		User:    "testuser",
+		Expires: time.Now().Add(time.Hour),
+		Used:    true,
+	})
+	tests.AddRefreshToken(models.JSONRefreshToken{
+		ID:      hashToken("latestrefreshtoken"),
+		Family:  "testfamily",
+		User:    "testuser",
+		Expires: time.Now().Add(time.Hour),
+	})
+
+	refreshToken := "stolenrefreshtoken"
+	body, _ := json.Marshal(refreshTokenRequest{
+		RefreshToken: &refreshToken,
+	})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostRefreshTokenHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("refreshing with used refresh token expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	latestToken := tests.GetRefreshToken(hashToken("latestrefreshtoken"))
+	if latestToken == nil || !latestToken.Revoked {
+		t.Error("reusing a refresh token should have revoked its family")
+	}
+}
+
+func TestRefreshTokenPostExpired(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+	tests.AddRefreshToken(models.JSONRefreshToken{
+		ID:      hashToken("testrefreshtoken"),
+		Family:  "testfamily",
+		User:    "testuser",
+		Expires: time.Now().Add(-time.Hour),
+	})
+
+	refreshToken := "testrefreshtoken"
+	body, _ := json.Marshal(refreshTokenRequest{
+		RefreshToken: &refreshToken,
+	})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostRefreshTokenHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("refreshing with expired refresh token expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestRefreshTokenPostInvalidBody(t *testing.T) {
+	tests.ClearDB()
+
+	body, _ := json.Marshal(invalidRequestBody{})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostRefreshTokenHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("refreshing with invalid body expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestLogoutPost(t *testing.T) {
+	tests.ClearDB()
+
+	user := models.JSONUser{
+		ID: "testuser",
+	}
+	tests.AddUser(user)
+	tokens, _ := testServer.issueTokens(httptest.NewRequest("POST", "/login", nil), user, "", time.Now())
+
+	body, _ := json.Marshal(refreshTokenRequest{
+		RefreshToken: &tokens.RefreshToken,
+	})
+	req, _ := http.NewRequest("POST", "/logout", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.PostLogoutHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("logging out expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	refreshToken := tests.GetRefreshToken(hashToken(tokens.RefreshToken))
+	if refreshToken == nil || !refreshToken.Revoked {
+		t.Error("logging out should have revoked the refresh token")
+	}
+
+	// The access token should no longer work
+	req, _ = http.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rr = httptest.NewRecorder()
+	handler = middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected = http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("getting profile after logging out expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestProfileGetTokenWithoutID(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	// Create a JWT like the ones issued before tokens could be revoked
+	claims := jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(time.Hour * 24 * 60).Unix(),
+		Subject:   "testuser",
+	}
+	jwtString, _ := secrets.SignJWT(claims)
+
+	req, _ := http.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+jwtString)
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("getting profile with a token without an id expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	tests.ClearDB()
+
+	user := models.JSONUser{
+		ID: "testuser",
+	}
+	tests.AddUser(user)
+
+	// Sign a token with the development secret before rotating
+	oldTokens, _ := testServer.issueTokens(httptest.NewRequest("POST", "/login", nil), user, "", time.Now())
+
+	// Rotate to an RSA key while keeping the old secret to verify tokens
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+	os.Setenv("JWT_SECRET", "MunchIsReallyCool")
+	os.Setenv("JWT_PRIVATE_KEYS", string(privateKeyPEM))
+	defer func() {
+		os.Unsetenv("JWT_SECRET")
+		os.Unsetenv("JWT_PRIVATE_KEYS")
+		secrets.LoadSigningKeys()
+	}()
+	err := secrets.LoadSigningKeys()
+	if err != nil {
+		t.Fatalf("loading rsa signing key failed with error %v", err)
+	}
+
+	newTokens, _ := testServer.issueTokens(httptest.NewRequest("POST", "/login", nil), user, "", time.Now())
+
+	// The jwks should only have the rsa key
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testServer.GetJWKSHandler).ServeHTTP(rr, req)
+
+	var jwks secrets.JWKS
+	json.NewDecoder(rr.Body).Decode(&jwks)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].Alg != "RS256" {
+		t.Fatalf("expected jwks with one rsa key, but got %v", jwks)
+	}
+
+	// New tokens should be signed by the rsa key
+	token, _, _ := new(jwt.Parser).ParseUnverified(newTokens.Token, &middleware.Claims{})
+	if token.Method.Alg() != "RS256" || token.Header["kid"] != jwks.Keys[0].Kid {
+		t.Errorf("expected new token to be signed with rs256 key %v, but got %v", jwks.Keys[0].Kid, token.Header)
+	}
+
+	// Tokens signed with either key should be accepted
+	for _, accessToken := range []string{oldTokens.Token, newTokens.Token} {
+		req, _ = http.NewRequest("GET", "/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		rr = httptest.NewRecorder()
+		handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
+		handler.ServeHTTP(rr, req)
+
+		expected := http.StatusOK
+		if rr.Code != expected {
+			t.Errorf("getting profile during key rotation expected status code of %v, but got %v", expected, rr.Code)
+		}
+	}
+}
+
+func TestSigningKeyAlgorithmMismatch(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+	publicKeyDER, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyDER,
+	})
+	os.Setenv("JWT_PRIVATE_KEYS", string(privateKeyPEM))
+	defer func() {
+		os.Unsetenv("JWT_PRIVATE_KEYS")
+		secrets.LoadSigningKeys()
+	}()
+	secrets.LoadSigningKeys()
+	kid := secrets.GetJWKS().Keys[0].Kid
+
+	// Forge a token using the public key as an HMAC secret
+	claims := jwt.StandardClaims{
+		Id:        "testtoken",
+		ExpiresAt: time.Now().Add(time.Minute * 15).Unix(),
+		Subject:   "testuser",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	jwtString, _ := token.SignedString(publicKeyPEM)
+
+	req, _ := http.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+jwtString)
+	rr := httptest.NewRecorder()
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("getting profile with a token signed by the wrong algorithm expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "testuser") {
+		t.Error("forged token should not have returned the profile")
+	}
+}
+
+func TestSigningKeysRequiredOutsideDevelopment(t *testing.T) {
+	os.Unsetenv("MUNCH_ENV")
+	defer os.Setenv("MUNCH_ENV", "development")
+
+	err := secrets.LoadSigningKeys()
+	if err == nil {
+		t.Error("loading signing keys outside development without any keys should have failed")
+	}
+
+	// The keys from before are still used
+	_, err = secrets.SignJWT(jwt.StandardClaims{Subject: "testuser"})
+	if err != nil {
+		t.Errorf("signing a token after failing to load keys expected no error, but got %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/secrets"
+	"munchserver/totp"
+	"munchserver/validation"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// twoFactorChallengeAudience marks challenge tokens so they can't be used as access tokens
+	twoFactorChallengeAudience = "munch-2fa"
+	// twoFactorChallengeLifetime is how long the user has to enter their code after their password
+	twoFactorChallengeLifetime = time.Minute * 5
+	// totpIssuer is shown next to the code in authenticator apps
+	totpIssuer = "Munch"
+	// recoveryCodeCount is how many recovery codes a user gets
+	recoveryCodeCount = 10
+)
+
+var errNotTwoFactorChallenge = errors.New("token is not a two factor challenge")
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken *string `json:"challengeToken"`
+	Code           *string `json:"code"`
+}
+
+type twoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type twoFactorCodeRequest struct {
+	Code *string `json:"code"`
+}
+
+type disableTwoFactorRequest struct {
+	Password *string `json:"password"`
+	Code     *string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// PostTwoFactorSetupHandler starts enrolling the logged in user in two factor authentication
+func (s *Server) PostTwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to set up two factor authentication")
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+	if user.TwoFactorEnabled {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Two factor authentication is already enabled")
+		return
+	}
+
+	// Generate a secret, which isn't used until the user confirms they have added it
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Secret could not be generated")
+		return
+	}
+	err = s.Users.SetPendingTOTPSecret(r.Context(), userID, secret)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Secret could not be saved")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(twoFactorSetupResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Email, secret),
+	})
+}
+
+// PostTwoFactorConfirmHandler turns on two factor authentication once the user enters a code from their new secret
+func (s *Server) PostTwoFactorConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to set up two factor authentication")
+		return
+	}
+
+	// Decode request
+	confirmDecoder := json.NewDecoder(r.Body)
+	confirmDecoder.DisallowUnknownFields()
+	var confirm twoFactorCodeRequest
+	err := confirmDecoder.Decode(&confirm)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if confirm.Code == nil {
+		writeMissingField(w, r, "code")
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+	if user.TwoFactorEnabled {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Two factor authentication is already enabled")
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		writeError(w, r, http.StatusBadRequest, errCodeConflict, "Set up two factor authentication before confirming it")
+		return
+	}
+
+	// Check the code
+	step, valid := totp.Validate(user.TOTPPendingSecret, *confirm.Code, time.Now())
+	if !valid {
+		writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Code is incorrect", errorDetail{Field: "code", Code: errCodeInvalidCredentials, Message: "Code is incorrect"})
+		return
+	}
+
+	// Turn on two factor authentication with new recovery codes
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Recovery codes could not be generated")
+		return
+	}
+	err = s.Users.EnableTwoFactor(r.Context(), userID, user.TOTPPendingSecret, step, recoveryCodeHashes)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Two factor authentication could not be enabled")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// PostTwoFactorDisableHandler turns off two factor authentication, needing both the password and a code
+func (s *Server) PostTwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to disable two factor authentication")
+		return
+	}
+
+	// Decode request
+	disableDecoder := json.NewDecoder(r.Body)
+	disableDecoder.DisallowUnknownFields()
+	var disable disableTwoFactorRequest
+	err := disableDecoder.Decode(&disable)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	var fieldErrors []validation.FieldError
+	if disable.Password == nil {
+		fieldErrors = append(fieldErrors, validation.Missing("password"))
+	}
+	if disable.Code == nil {
+		fieldErrors = append(fieldErrors, validation.Missing("code"))
+	}
+	if writeValidationErrors(w, r, fieldErrors) {
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+	if !user.TwoFactorEnabled {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Two factor authentication is not enabled")
+		return
+	}
+
+	// Check the password and code
+	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(*disable.Password))
+	if err != nil {
+		writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Password is incorrect", errorDetail{Field: "password", Code: errCodeInvalidCredentials, Message: "Password is incorrect"})
+		return
+	}
+	valid, err := s.useTwoFactorCode(r, user, *disable.Code)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Code could not be checked")
+		return
+	}
+	if !valid {
+		writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Code is incorrect", errorDetail{Field: "code", Code: errCodeInvalidCredentials, Message: "Code is incorrect"})
+		return
+	}
+
+	err = s.Users.DisableTwoFactor(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Two factor authentication could not be disabled")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// PostRecoveryCodesHandler replaces the user's recovery codes, for when they have used or lost them
+func (s *Server) PostRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to get new recovery codes")
+		return
+	}
+
+	// Decode request
+	codesDecoder := json.NewDecoder(r.Body)
+	codesDecoder.DisallowUnknownFields()
+	var codesRequest twoFactorCodeRequest
+	err := codesDecoder.Decode(&codesRequest)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if codesRequest.Code == nil {
+		writeMissingField(w, r, "code")
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+	if !user.TwoFactorEnabled {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Two factor authentication is not enabled")
+		return
+	}
+
+	// Check the code
+	valid, err := s.useTwoFactorCode(r, user, *codesRequest.Code)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Code could not be checked")
+		return
+	}
+	if !valid {
+		writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Code is incorrect", errorDetail{Field: "code", Code: errCodeInvalidCredentials, Message: "Code is incorrect"})
+		return
+	}
+
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Recovery codes could not be generated")
+		return
+	}
+	err = s.Users.SetRecoveryCodes(r.Context(), userID, recoveryCodeHashes)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Recovery codes could not be saved")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// PostTwoFactorLoginHandler finishes logging in by exchanging a challenge token and code for access tokens
+func (s *Server) PostTwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode request
+	loginDecoder := json.NewDecoder(r.Body)
+	loginDecoder.DisallowUnknownFields()
+	var login twoFactorLoginRequest
+	err := loginDecoder.Decode(&login)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	var fieldErrors []validation.FieldError
+	if login.ChallengeToken == nil {
+		fieldErrors = append(fieldErrors, validation.Missing("challengeToken"))
+	}
+	if login.Code == nil {
+		fieldErrors = append(fieldErrors, validation.Missing("code"))
+	}
+	if writeValidationErrors(w, r, fieldErrors) {
+		return
+	}
+
+	// Check the challenge token
+	var claims middleware.Claims
+	_, err = jwt.ParseWithClaims(*login.ChallengeToken, &claims, secrets.GetJWTSecret)
+	if err == nil && !claims.VerifyAudience(twoFactorChallengeAudience, true) {
+		err = errNotTwoFactorChallenge
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Challenge token is not valid")
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), claims.Subject)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Challenge token is not valid")
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	ip := clientIP(r)
+	lockout, err := s.checkLoginLockout(r.Context(), user.Email, ip)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Login attempts could not be checked")
+		return
+	}
+	if lockout != nil {
+		writeLoginLockout(w, r, lockout)
+		return
+	}
+
+	// Check the code
+	valid, err := s.useTwoFactorCode(r, user, *login.Code)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Code could not be checked")
+		return
+	}
+	if !valid {
+		s.failLogin(w, r, user.Email, ip)
+		return
+	}
+
+	s.completeLogin(w, r, user)
+}
+
+// writeTwoFactorChallenge sends a challenge token that can be exchanged for access tokens with a code
+func writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user models.JSONUser) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Challenge could not be created")
+		return
+	}
+	now := time.Now()
+	challengeToken, err := secrets.SignJWT(jwt.StandardClaims{
+		Id:        tokenID.String(),
+		Audience:  twoFactorChallengeAudience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(twoFactorChallengeLifetime).Unix(),
+		Subject:   user.ID,
+	})
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Challenge could not be created")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(twoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+	})
+}
+
+// useTwoFactorCode checks a code from the user's authenticator app or one of their recovery codes.
+// Each code can only be used once, so a code seen over someone's shoulder can't be reused.
+func (s *Server) useTwoFactorCode(r *http.Request, user models.JSONUser, code string) (bool, error) {
+	step, valid := totp.Validate(user.TOTPSecret, code, time.Now())
+	if valid {
+		return s.Users.UseTOTPStep(r.Context(), user.ID, step)
+	}
+
+	recoveryCodeHash := hashToken(normalizeRecoveryCode(code))
+	return s.Users.UseRecoveryCode(r.Context(), user.ID, recoveryCodeHash)
+}
+
+// generateRecoveryCodes creates a set of recovery codes and their hashes for storing
+func generateRecoveryCodes() ([]string, []string, error) {
+	recoveryCodes := make([]string, recoveryCodeCount)
+	recoveryCodeHashes := make([]string, recoveryCodeCount)
+	for i := range recoveryCodes {
+		recoveryCode, err := generateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		recoveryCodes[i] = recoveryCode
+		recoveryCodeHashes[i] = hashToken(normalizeRecoveryCode(recoveryCode))
+	}
+	return recoveryCodes, recoveryCodeHashes, nil
+}
@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/tests"
+	"munchserver/totp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// addTwoFactorUser adds a user with two factor authentication and the recovery code abcd-efgh
+func addTwoFactorUser() string {
+	secret, _ := totp.GenerateSecret()
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:               "testuser",
+		Email:            "test@munch.app",
+		PasswordHash:     passwordHash,
+		TwoFactorEnabled: true,
+		TOTPSecret:       secret,
+		RecoveryCodes:    []string{hashToken(normalizeRecoveryCode("abcd-efgh"))},
+	})
+	return secret
+}
+
+func postTwoFactorLogin(challengeToken string, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(twoFactorLoginRequest{
+		ChallengeToken: &challengeToken,
+		Code:           &code,
+	})
+	req, _ := http.NewRequest("POST", "/login/2fa", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostTwoFactorLoginHandler)
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTwoFactorSetupAndConfirm(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Email: "test@munch.app",
+	})
+
+	req, _ := http.NewRequest("POST", "/profile/2fa/setup", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostTwoFactorSetupHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Fatalf("setting up two factor expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var setup twoFactorSetupResponse
+	json.NewDecoder(rr.Body).Decode(&setup)
+
+	// Confirm with a code from the new secret
+	code, _ := totp.Code(setup.Secret, totp.Step(time.Now()))
+	body, _ := json.Marshal(twoFactorCodeRequest{
+		Code: &code,
+	})
+	req, _ = http.NewRequest("POST", "/profile/2fa/confirm", bytes.NewBuffer(body))
+	rr = httptest.NewRecorder()
+	handler = tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostTwoFactorConfirmHandler))
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != expected {
+		t.Errorf("confirming two factor expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var recoveryCodes recoveryCodesResponse
+	json.NewDecoder(rr.Body).Decode(&recoveryCodes)
+	if len(recoveryCodes.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("expected %v recovery codes, but got %v", recoveryCodeCount, len(recoveryCodes.RecoveryCodes))
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || !user.TwoFactorEnabled || user.TOTPSecret != setup.Secret || user.TOTPPendingSecret != "" {
+		t.Error("confirming two factor should have enabled it with the new secret")
+	}
+}
+
+func TestTwoFactorConfirmWrongCode(t *testing.T) {
+	tests.ClearDB()
+
+	secret, _ := totp.GenerateSecret()
+	tests.AddUser(models.JSONUser{
+		ID:                "testuser",
+		TOTPPendingSecret: secret,
+	})
+
+	code := "000000"
+	body, _ := json.Marshal(twoFactorCodeRequest{
+		Code: &code,
+	})
+	req, _ := http.NewRequest("POST", "/profile/2fa/confirm", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostTwoFactorConfirmHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("confirming two factor with wrong code expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestLoginPostTwoFactor(t *testing.T) {
+	tests.ClearDB()
+
+	secret := addTwoFactorUser()
+
+	rr := postLogin("test@munch.app", "password123", "10.0.0.1:1234")
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Fatalf("login with two factor expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var challenge twoFactorChallengeResponse
+	json.NewDecoder(rr.Body).Decode(&challenge)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatal("login with two factor should have returned a challenge token")
+	}
+
+	// The challenge token can't be used as an access token
+	req, _ := http.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+challenge.ChallengeToken)
+	rr = httptest.NewRecorder()
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected = http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("getting profile with a challenge token expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	// Exchange the challenge token and a code for access tokens
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+	rr = postTwoFactorLogin(challenge.ChallengeToken, code)
+	expected = http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("login with two factor code expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var login loginResponse
+	json.NewDecoder(rr.Body).Decode(&login)
+	if login.Token == "" || login.RefreshToken == "" {
+		t.Error("login with two factor code should have returned tokens")
+	}
+
+	// The same code can't be used twice
+	rr = postTwoFactorLogin(challenge.ChallengeToken, code)
+	expected = http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("login with reused two factor code expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestTwoFactorLoginRecoveryCode(t *testing.T) {
+	tests.ClearDB()
+
+	addTwoFactorUser()
+	challengeToken := signTwoFactorChallenge(t)
+
+	rr := postTwoFactorLogin(challengeToken, "ABCD-EFGH")
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("login with recovery code expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	rr = postTwoFactorLogin(challengeToken, "abcdefgh")
+	expected = http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("login with used recovery code expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestTwoFactorLoginWrongCode(t *testing.T) {
+	tests.ClearDB()
+
+	addTwoFactorUser()
+	challengeToken := signTwoFactorChallenge(t)
+
+	rr := postTwoFactorLogin(challengeToken, "000000")
+	expected := http.StatusUnauthorized
+	if rr.Code != expected {
+		t.Errorf("login with wrong two factor code expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	loginAttempt := tests.GetLoginAttempt(emailAttemptID("test@munch.app"))
+	if loginAttempt == nil || loginAttempt.Failures != 1 {
+		t.Error("login with wrong two factor code should have counted as a failed login")
+	}
+}
+
+// signTwoFactorChallenge gets a challenge token for the test user
+func signTwoFactorChallenge(t *testing.T) string {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	writeTwoFactorChallenge(rr, req, models.JSONUser{
+		ID: "testuser",
+	})
+	var challenge twoFactorChallengeResponse
+	json.NewDecoder(rr.Body).Decode(&challenge)
+	if challenge.ChallengeToken == "" {
+		t.Fatal("expected a challenge token")
+	}
+	return challenge.ChallengeToken
+}
@@ -0,0 +1,262 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"munchserver/blobstore"
+	"munchserver/imaging"
+	"munchserver/models"
+	"munchserver/validation"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxUploadSize is the most bytes an image uploaded through the server can be
+const maxUploadSize = 1024000 * 4
+
+// maxPresignedUploadSize is the most bytes an image uploaded straight to the blob store can be
+const maxPresignedUploadSize = 1024000 * 20
+
+// presignedUploadExpiry is how long clients have to upload an image once they have a presigned url
+const presignedUploadExpiry = 15 * time.Minute
+
+// uploadExtensions are the content types images can be uploaded with, and the extension they are stored with until
+// they are processed
+var uploadExtensions = map[string]string{
+	imaging.ContentTypeJPEG: ".jpg",
+	imaging.ContentTypePNG:  ".png",
+	imaging.ContentTypeWebP: ".webp",
+}
+
+type presignUploadRequest struct {
+	ContentType *string `json:"contentType" validate:"required"`
+	Size        *int64  `json:"size" validate:"required,min=1"`
+}
+
+type presignUploadResponse struct {
+	// Key is sent back once the upload is done to attach it
+	Key string `json:"key"`
+	blobstore.PresignedUpload
+}
+
+type completeUploadRequest struct {
+	Key *string `json:"key" validate:"required"`
+}
+
+// uploadedImage is an uploaded image after every size of it was put in the blob store
+type uploadedImage struct {
+	ID       string
+	Variants models.JSONImageVariants
+	BlobKeys []string
+}
+
+// uploadImage reads the image field of a multipart form, resizes it and puts every size in the blob store. It writes
+// an error and returns false if the image couldn't be uploaded.
+func (s *Server) uploadImage(w http.ResponseWriter, r *http.Request) (uploadedImage, bool) {
+	err := r.ParseMultipartForm(maxUploadSize)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusRequestEntityTooLarge, errCodeTooLarge, "Image must be smaller than 4MB")
+		return uploadedImage{}, false
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeMissingField(w, r, "image")
+		return uploadedImage{}, false
+	}
+	defer file.Close()
+
+	// Read one byte more than allowed to tell if the image is too large
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Image could not be read")
+		return uploadedImage{}, false
+	}
+	if len(data) > maxUploadSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, errCodeTooLarge, "Image must be smaller than 4MB")
+		return uploadedImage{}, false
+	}
+
+	return s.storeImage(w, r, bytes.NewReader(data))
+}
+
+// storeImage resizes an uploaded image read from file and puts every size in the blob store. It writes an error and
+// returns false if the image couldn't be stored.
+func (s *Server) storeImage(w http.ResponseWriter, r *http.Request, file io.Reader) (uploadedImage, bool) {
+	// Check what the image really is and resize it, which also removes its metadata
+	processed, err := imaging.Process(file)
+	switch err {
+	case nil:
+	case imaging.ErrUnsupportedFormat:
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Image is not valid", errorDetail{Field: "image", Code: errCodeInvalidField, Message: "Expected a JPEG, PNG or WebP image"})
+		return uploadedImage{}, false
+	case imaging.ErrTooLarge:
+		writeError(w, r, http.StatusRequestEntityTooLarge, errCodeTooLarge, "Image has too many pixels")
+		return uploadedImage{}, false
+	default:
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Image is not valid", errorDetail{Field: "image", Code: errCodeInvalidField, Message: "Image could not be decoded"})
+		return uploadedImage{}, false
+	}
+
+	// Generate a random uuidv4 shared by every size of the image
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Image could not be uploaded")
+		return uploadedImage{}, false
+	}
+
+	// Upload every size of the image
+	image := uploadedImage{ID: uuid.String()}
+	for _, resized := range processed.Variants {
+		filename := uuid.String() + "_" + resized.Variant + processed.Extension
+		url, err := s.Blobs.Put(r.Context(), filename, bytes.NewReader(resized.Data), processed.ContentType)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusConflict, errCodeUploadFailed, "Image could not be uploaded")
+			return uploadedImage{}, false
+		}
+		image.BlobKeys = append(image.BlobKeys, filename)
+
+		switch resized.Variant {
+		case imaging.VariantThumbnail:
+			image.Variants.Thumbnail = url
+		case imaging.VariantCard:
+			image.Variants.Card = url
+		case imaging.VariantFull:
+			image.Variants.Full = url
+		}
+	}
+	return image, true
+}
+
+// presignUpload lets the client upload an image straight to the blob store under a key starting with the prefix,
+// sending the presigned upload as the response
+func (s *Server) presignUpload(w http.ResponseWriter, r *http.Request, keyPrefix string) {
+	// Only some blob stores take uploads straight from clients
+	presigner, ok := s.Blobs.(blobstore.Presigner)
+	if !ok {
+		writeError(w, r, http.StatusNotImplemented, errCodeNotImplemented, "Images can only be uploaded through the server")
+		return
+	}
+
+	uploadDecoder := json.NewDecoder(r.Body)
+	uploadDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var upload presignUploadRequest
+	err := uploadDecoder.Decode(&upload)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if writeValidationErrors(w, r, validation.Struct(&upload)) {
+		return
+	}
+	if *upload.Size > maxPresignedUploadSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, errCodeTooLarge, "Image must be smaller than 20MB")
+		return
+	}
+	extension, supported := uploadExtensions[*upload.ContentType]
+	if !supported {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Image is not valid", errorDetail{Field: "contentType", Code: errCodeInvalidField, Message: "Expected a JPEG, PNG or WebP image"})
+		return
+	}
+
+	// Generate a random uuidv4 for the upload
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Upload could not be started")
+		return
+	}
+
+	key := keyPrefix + uuid.String() + extension
+	presigned, err := presigner.PresignPut(r.Context(), key, *upload.ContentType, *upload.Size, presignedUploadExpiry)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Upload could not be started")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presignUploadResponse{Key: key, PresignedUpload: presigned})
+}
+
+// completeUpload processes an image the client uploaded straight to the blob store under a key starting with the
+// prefix, then deletes what was uploaded. It writes an error and returns false if the image couldn't be stored.
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, keyPrefix string) (uploadedImage, bool) {
+	presigner, ok := s.Blobs.(blobstore.Presigner)
+	if !ok {
+		writeError(w, r, http.StatusNotImplemented, errCodeNotImplemented, "Images can only be uploaded through the server")
+		return uploadedImage{}, false
+	}
+
+	uploadDecoder := json.NewDecoder(r.Body)
+	uploadDecoder.DisallowUnknownFields()
+
+	// Decode request
+	var upload completeUploadRequest
+	err := uploadDecoder.Decode(&upload)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeInvalidJSON(w, r, err)
+		return uploadedImage{}, false
+	}
+	if writeValidationErrors(w, r, validation.Struct(&upload)) {
+		return uploadedImage{}, false
+	}
+
+	// Uploads can only be attached where they were started
+	key := *upload.Key
+	if !strings.HasPrefix(key, keyPrefix) {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Upload not found")
+		return uploadedImage{}, false
+	}
+
+	// Make sure the upload finished
+	info, err := presigner.Stat(r.Context(), key)
+	if err == blobstore.ErrNotFound {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Upload not found")
+		return uploadedImage{}, false
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Upload could not be found")
+		return uploadedImage{}, false
+	}
+	if info.Size > maxPresignedUploadSize {
+		presigner.Delete(r.Context(), key)
+		writeError(w, r, http.StatusRequestEntityTooLarge, errCodeTooLarge, "Image must be smaller than 20MB")
+		return uploadedImage{}, false
+	}
+
+	// Stream the upload into the decoder to resize it and remove its metadata, so it is never all kept in memory
+	file, err := presigner.Get(r.Context(), key)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Upload could not be read")
+		return uploadedImage{}, false
+	}
+	image, stored := s.storeImage(w, r, io.LimitReader(file, maxPresignedUploadSize))
+	file.Close()
+
+	// The upload isn't needed once it is processed, or if it isn't a valid image
+	err = presigner.Delete(r.Context(), key)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	return image, stored
+}
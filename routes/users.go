@@ -1,119 +1,133 @@
 package routes
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
-	"munchserver/dbutils"
+	"munchserver/mailer"
 	"munchserver/middleware"
 	"munchserver/models"
-	"munchserver/secrets"
+	"munchserver/store"
+	"munchserver/validation"
 	"net/http"
-	"path/filepath"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type loginRequest struct {
-	Email    *string `json:"email"`
-	Password *string `json:"password"`
+	Email    *string `json:"email" validate:"required"`
+	Password *string `json:"password" validate:"required"`
 }
 
 type loginResponse struct {
-	Token string          `json:"token"`
-	User  models.JSONUser `json:"userObject"`
+	Token        string          `json:"token"`
+	RefreshToken string          `json:"refreshToken"`
+	User         models.JSONUser `json:"userObject"`
 }
 
 type registerRequest struct {
-	NameFirst   *string    `json:"firstName"`
-	NameLast    *string    `json:"lastName"`
-	Email       *string    `json:"email"`
-	Password    *string    `json:"password"`
-	DateOfBirth *time.Time `json:"dateOfBirth"`
+	NameFirst   *string    `json:"firstName" validate:"required,max=50"`
+	NameLast    *string    `json:"lastName" validate:"required,max=50"`
+	Email       *string    `json:"email" validate:"required,email,max=254"`
+	Password    *string    `json:"password" validate:"required,max=72"`
+	DateOfBirth *time.Time `json:"dateOfBirth" validate:"required"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword *string `json:"currentPassword" validate:"required"`
+	NewPassword     *string `json:"newPassword" validate:"required,max=72"`
+}
+
+type changeEmailRequest struct {
+	Password *string `json:"password" validate:"required"`
+	Email    *string `json:"email" validate:"required,email,max=254"`
 }
 
 type updateUserRequest struct {
-	NameFirst   *string    `json:"firstName"`
-	NameLast    *string    `json:"lastName"`
-	PhoneNumber *string    `json:"phoneNumber"`
-	City        *string    `json:"city"`
-	State       *string    `json:"state"`
+	NameFirst   *string    `json:"firstName" validate:"max=50"`
+	NameLast    *string    `json:"lastName" validate:"max=50"`
+	PhoneNumber *string    `json:"phoneNumber" validate:"phone"`
+	City        *string    `json:"city" validate:"max=100"`
+	State       *string    `json:"state" validate:"max=100"`
 	DateOfBirth *time.Time `json:"dateOfBirth"`
 }
 
-func PutProfileUploadHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PutProfileUploadHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get user from context
 	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
 
 	// Check for a user, or if the user agent is from the scraper
 	if !userLoggedIn {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to upload a profile picture")
 		return
 	}
 
-	err := r.ParseMultipartForm(1024000 * 4)
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	// Resize and upload image
+	picture, uploaded := s.uploadImage(w, r)
+	if !uploaded {
 		return
 	}
 
-	file, fileHeader, err := r.FormFile("image")
+	err := s.Users.SetPicture(r.Context(), userID, picture.Variants)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Profile picture could not be updated")
 		return
 	}
-	if filepath.Ext(fileHeader.Filename) != ".jpg" {
-		w.WriteHeader(http.StatusBadRequest)
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) PostProfileUploadHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to upload a profile picture")
 		return
 	}
 
-	defer file.Close()
-	size := fileHeader.Size
-	buffer := make([]byte, size)
-	file.Read(buffer)
-
-	// Generate a random uuidv4
-	uuid, _ := uuid.NewRandom()
+	s.presignUpload(w, r, profileUploadKeyPrefix(userID))
+}
 
-	// Create file name for image
-	filename := uuid.String() + filepath.Ext(fileHeader.Filename)
+func (s *Server) PostProfileUploadCompleteHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to upload a profile picture")
+		return
+	}
 
-	// Upload image to s3
-	result, err := Uploader.UploadWithContext(r.Context(), &s3manager.UploadInput{
-		Bucket: aws.String("munch-assets"),
-		Key:    aws.String(filename),
-		Body:   bytes.NewReader(buffer),
-	})
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusConflict)
+	// Resize the uploaded image
+	picture, uploaded := s.completeUpload(w, r, profileUploadKeyPrefix(userID))
+	if !uploaded {
 		return
 	}
 
-	_, err = Db.Collection("users").UpdateOne(r.Context(), dbutils.WithIDQuery(userID), dbutils.SetProfilePicture(result.Location))
+	err := s.Users.SetPicture(r.Context(), userID, picture.Variants)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Profile picture could not be updated")
 		return
 	}
 
 	// Send response
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(picture.Variants)
+}
+
+// profileUploadKeyPrefix starts the keys of images uploaded straight to the blob store for the user's picture
+func profileUploadKeyPrefix(userID string) string {
+	return "users_" + userID + "_"
 }
 
 // PostRegisterHandler handles the logic for registering a user
-func PostRegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PostRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode registered user's data
 	userDecoder := json.NewDecoder(r.Body)
 	userDecoder.DisallowUnknownFields()
@@ -121,17 +135,17 @@ func PostRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	err := userDecoder.Decode(&newUser)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidJSON(w, r, err)
 		return
 	}
 
-	// Make sure all fields in registered user are provided
-	if newUser.NameFirst == nil ||
-		newUser.NameLast == nil ||
-		newUser.Email == nil ||
-		newUser.Password == nil ||
-		newUser.DateOfBirth == nil {
-		w.WriteHeader(http.StatusBadRequest)
+	// Make sure all fields in registered user are provided and valid
+	if writeValidationErrors(w, r, validation.Struct(&newUser)) {
+		return
+	}
+
+	// Make sure the password is hard to guess
+	if !s.checkPasswordPolicy(w, r, "password", *newUser.Password, *newUser.Email) {
 		return
 	}
 
@@ -152,45 +166,64 @@ func PostRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		Favorites:       []string{},
 		Reviews:         []string{},
 		OwnedFoodTrucks: []string{},
+		Roles:           []string{},
+	}
+	err = s.Users.Add(r.Context(), registeredUser)
+	if err == store.ErrDuplicateEmail {
+		writeDuplicateEmail(w, r)
+		return
 	}
-	_, err = Db.Collection("users").InsertOne(r.Context(), registeredUser)
-
-	// If there is an error, it is most likely a duplicate user (email must be unique)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusConflict)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "User could not be registered")
 		return
 	}
 
+	// Send a link to verify the email, the user can ask for another if this fails
+	err = s.sendVerificationEmail(r.Context(), registeredUser)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
 	// Create the response
 	w.WriteHeader(http.StatusOK)
 }
 
 // PostLoginHandler handles the logic for logging in
-func PostLoginHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PostLoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode login user
 	userDecoder := json.NewDecoder(r.Body)
 	userDecoder.DisallowUnknownFields()
 	var login loginRequest
 	err := userDecoder.Decode(&login)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidJSON(w, r, err)
 		return
 	}
 
 	// Make sure all fields in request are provided
-	if login.Email == nil ||
-		login.Password == nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if writeValidationErrors(w, r, validation.Struct(&login)) {
 		return
 	}
 
-	// Find user in database
-	var user models.JSONUser
-	err = Db.Collection("users").FindOne(r.Context(), dbutils.WithEmailQuery(*login.Email)).Decode(&user)
+	// Stop guessing passwords for locked out emails and clients
+	ip := clientIP(r)
+	lockout, err := s.checkLoginLockout(r.Context(), *login.Email, ip)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Login could not be checked")
+		return
+	}
+	if lockout != nil {
+		writeLoginLockout(w, r, lockout)
+		return
+	}
+
+	// Find user in database, unknown emails count as failures too so they can't be told apart
+	user, err := s.Users.GetByEmail(r.Context(), *login.Email)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		s.failLogin(w, r, *login.Email, ip)
 		return
 	}
 
@@ -198,34 +231,51 @@ func PostLoginHandler(w http.ResponseWriter, r *http.Request) {
 	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(*login.Password))
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		s.failLogin(w, r, *login.Email, ip)
 		return
 	}
 
-	// Create a JWT for the user that expires in 15 minutes
-	claims := jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 60).Unix(),
-		Subject:   user.ID,
+	// Users with two factor authentication need to enter a code before getting tokens
+	if user.TwoFactorEnabled {
+		writeTwoFactorChallenge(w, r, user)
+		return
+	}
+
+	s.completeLogin(w, r, user)
+}
+
+// completeLogin sends tokens to a user who has proven who they are
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, user models.JSONUser) {
+	// Forget earlier failures now that the user logged in
+	err := s.clearLoginFailures(r.Context(), user.Email)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	// Create an access token and refresh token for the user
+	tokens, err := s.issueTokens(r, user, "", time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Tokens could not be issued")
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret, _ := secrets.GetJWTSecret(nil)
-	jwtString, _ := token.SignedString(jwtSecret)
 
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(loginResponse{
-		Token: jwtString,
-		User:  user,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		User:         user,
 	})
 }
 
-func PutFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PutFavoriteHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Checks for food truck ID
 	params := mux.Vars(r)
 	foodTruckID, foodTruckIDExists := params["foodTruckID"]
 	if !foodTruckIDExists {
-		w.WriteHeader(http.StatusBadRequest)
+		writeMissingField(w, r, "foodTruckID")
 		return
 	}
 
@@ -234,30 +284,28 @@ func PutFavoriteHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check for a user, or if the user agent is from the scraper
 	if !userLoggedIn {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to change favorites")
 		return
 	}
 
-	var updateOperator string
-
 	// Determine if an add or delete
 	action := r.URL.Query().Get("action")
-	if action == "add" {
-		updateOperator = "$addToSet"
-	} else if action == "delete" {
-		updateOperator = "$pull"
-	} else {
+	add := action == "add"
+	if !add && action != "delete" {
 		log.Printf("ERROR: Incorrect action to edit user favorites.")
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Action is not valid", errorDetail{Field: "action", Code: errCodeInvalidField, Message: "Expected add or delete"})
 		return
 	}
 
-	updateFavesFilter := bson.M{updateOperator: bson.M{"favorites": foodTruckID}}
-
-	_, err := Db.Collection("users").UpdateOne(r.Context(), dbutils.WithIDQuery(userID), updateFavesFilter)
+	var err error
+	if add {
+		err = s.Users.AddFavorite(r.Context(), userID, foodTruckID)
+	} else {
+		err = s.Users.RemoveFavorite(r.Context(), userID, foodTruckID)
+	}
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
 		return
 	}
 
@@ -266,22 +314,21 @@ func PutFavoriteHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user from context
 	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
 
 	// Check for a user, or if the user agent is from the scraper
 	if !userLoggedIn {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to see your profile")
 		return
 	}
 
 	// Get user from database
-	var user models.JSONUser
-	err := Db.Collection("users").FindOne(r.Context(), dbutils.WithIDQuery(userID), dbutils.OptionsWithProjection(dbutils.ProfileProjection())).Decode(&user)
+	user, err := s.Users.GetProfile(r.Context(), userID)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Profile could not be found")
 		return
 	}
 
@@ -290,21 +337,20 @@ func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
-func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user id from route params
 	params := mux.Vars(r)
 	userID, userIDExists := params["userID"]
 	if !userIDExists {
-		w.WriteHeader(http.StatusBadRequest)
+		writeMissingField(w, r, "userID")
 		return
 	}
 
 	// Get user from database
-	var user models.JSONUser
-	err := Db.Collection("users").FindOne(r.Context(), dbutils.WithIDQuery(userID), dbutils.OptionsWithProjection(dbutils.UserProjection())).Decode(&user)
+	user, err := s.Users.GetPublic(r.Context(), userID)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
 		return
 	}
 
@@ -313,14 +359,14 @@ func GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
-func PutUpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PutUpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get user from context
 	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
 
 	// Check for a user
 	if !userLoggedIn {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to update your profile")
 		return
 	}
 
@@ -332,45 +378,199 @@ func PutUpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	err := userDecoder.Decode(&updatedUser)
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidJSON(w, r, err)
+		return
+	}
+
+	// Validate the fields being updated
+	if writeValidationErrors(w, r, validation.Struct(&updatedUser)) {
+		return
+	}
+
+	// Update user document
+	err = s.Users.Update(r.Context(), userID, store.UserUpdate{
+		NameFirst:   updatedUser.NameFirst,
+		NameLast:    updatedUser.NameLast,
+		PhoneNumber: updatedUser.PhoneNumber,
+		City:        updatedUser.City,
+		State:       updatedUser.State,
+		DateOfBirth: updatedUser.DateOfBirth,
+	})
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Profile could not be updated")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+
+}
+
+// PutChangePasswordHandler changes the logged in user's password and logs them out everywhere else
+func (s *Server) PutChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to change your password")
+		return
+	}
+
+	// Decode request
+	passwordDecoder := json.NewDecoder(r.Body)
+	passwordDecoder.DisallowUnknownFields()
+	var change changePasswordRequest
+	err := passwordDecoder.Decode(&change)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if writeValidationErrors(w, r, validation.Struct(&change)) {
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
 		return
 	}
 
-	// Determine which fields should be updated
-	var updateData bson.D
+	// Check if current password matches
+	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(*change.CurrentPassword))
+	if err != nil {
+		writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Current password is incorrect", errorDetail{Field: "currentPassword", Code: errCodeInvalidCredentials, Message: "Password is incorrect"})
+		return
+	}
+
+	// Make sure the new password is hard to guess
+	if !s.checkPasswordPolicy(w, r, "newPassword", *change.NewPassword, user.Email) {
+		return
+	}
+
+	// Salt and hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*change.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Password could not be changed")
+		return
+	}
 
-	if updatedUser.NameFirst != nil {
-		updateData = append(updateData, bson.E{"firstName", *updatedUser.NameFirst})
+	// Update the password, which also invalidates existing access tokens
+	err = s.Users.SetPassword(r.Context(), userID, hashedPassword, time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Password could not be changed")
+		return
+	}
+	err = s.revokeUserRefreshTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Other sessions could not be logged out")
+		return
+	}
+
+	// Give this device new tokens so it stays logged in
+	tokens, err := s.issueTokens(r, user, "", time.Now())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Tokens could not be issued")
+		return
 	}
-	if updatedUser.NameLast != nil {
-		updateData = append(updateData, bson.E{"lastName", *updatedUser.NameLast})
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// PutChangeEmailHandler changes the logged in user's email, which has to be verified again
+func (s *Server) PutChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to change your email")
+		return
 	}
-	if updatedUser.PhoneNumber != nil {
-		updateData = append(updateData, bson.E{"phoneNumber", *updatedUser.PhoneNumber})
+
+	// Decode request
+	emailDecoder := json.NewDecoder(r.Body)
+	emailDecoder.DisallowUnknownFields()
+	var change changeEmailRequest
+	err := emailDecoder.Decode(&change)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
 	}
-	if updatedUser.City != nil {
-		updateData = append(updateData, bson.E{"city", *updatedUser.City})
+	if writeValidationErrors(w, r, validation.Struct(&change)) {
+		return
 	}
-	if updatedUser.State != nil {
-		updateData = append(updateData, bson.E{"state", *updatedUser.State})
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
 	}
-	if updatedUser.DateOfBirth != nil {
-		updateData = append(updateData, bson.E{"dateOfBirth", *updatedUser.DateOfBirth})
+
+	// Check if password matches
+	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(*change.Password))
+	if err != nil {
+		writeError(w, r, http.StatusForbidden, errCodeInvalidCredentials, "Password is incorrect", errorDetail{Field: "password", Code: errCodeInvalidCredentials, Message: "Password is incorrect"})
+		return
 	}
 
-	// Update food truck document
-	update := bson.D{
-		{"$set", updateData},
+	// Nothing to do if the email is the same
+	if *change.Email == user.Email {
+		w.WriteHeader(http.StatusOK)
+		return
 	}
 
-	_, err = Db.Collection("users").UpdateOne(r.Context(), dbutils.WithIDQuery(userID), update)
+	// Update the email, another user may already have it
+	err = s.Users.SetEmail(r.Context(), userID, *change.Email)
+	if err == store.ErrDuplicateEmail {
+		writeDuplicateEmail(w, r)
+		return
+	}
 	if err != nil {
 		log.Printf("ERROR: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Email could not be changed")
 		return
 	}
 
+	// Let the old email know in case someone else changed it
+	oldEmail := user.Email
+	err = s.Mailer.Send(r.Context(), mailer.Message{
+		To:      oldEmail,
+		Subject: "Your Munch email was changed",
+		Body: fmt.Sprintf("Hi %v,\r\n\r\nThe email for your Munch account was changed to %v. "+
+			"If this wasn't you, reset your password right away.\r\n", user.NameFirst, *change.Email),
+	})
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	// Verify the new email
+	user.Email = *change.Email
+	err = s.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
 	// Send response
 	w.WriteHeader(http.StatusOK)
+}
 
+// writeDuplicateEmail responds that another user already has the email in the request
+func writeDuplicateEmail(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusConflict, errCodeDuplicateEmail, "Email is already in use", errorDetail{
+		Field:   "email",
+		Code:    errCodeDuplicateEmail,
+		Message: "Another account already has this email",
+	})
 }
@@ -2,13 +2,20 @@ package routes
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"hash/crc32"
+	"image/jpeg"
+	"munchserver/blobstore"
 	"munchserver/middleware"
 	"munchserver/models"
+	"munchserver/passwordpolicy"
 	"munchserver/secrets"
 	"munchserver/tests"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,7 +40,7 @@ func TestLoginPostInvalidCredentials(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostLoginHandler)
+	handler := http.HandlerFunc(testServer.PostLoginHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusUnauthorized
@@ -51,7 +58,7 @@ func TestLoginPostInvalidBody(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostLoginHandler)
+	handler := http.HandlerFunc(testServer.PostLoginHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -69,7 +76,7 @@ func TestLoginPostInvalidRequest(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostLoginHandler)
+	handler := http.HandlerFunc(testServer.PostLoginHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -107,7 +114,7 @@ func TestLoginPostValid(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostLoginHandler)
+	handler := http.HandlerFunc(testServer.PostLoginHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -116,6 +123,48 @@ func TestLoginPostValid(t *testing.T) {
 	}
 }
 
+func TestLoginPostRolesInToken(t *testing.T) {
+	tests.ClearDB()
+
+	// Add admin to db
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		PasswordHash: hashedPassword,
+		Email:        "tester@example.com",
+		Roles:        []string{models.RoleAdmin},
+	})
+
+	// Login as admin
+	email := "tester@example.com"
+	password := "password123"
+	body, _ := json.Marshal(loginRequest{
+		Email:    &email,
+		Password: &password,
+	})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostLoginHandler)
+	handler.ServeHTTP(rr, req)
+
+	var login loginResponse
+	json.NewDecoder(rr.Body).Decode(&login)
+
+	// Use the token on an admin only route
+	req, _ = http.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	rr = httptest.NewRecorder()
+	adminHandler := middleware.AuthenticateUser(testServer.ValidateToken)(middleware.RequireRoles(models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	adminHandler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("using admin's token on admin only route expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
 func TestLoginPostIncorrectPassword(t *testing.T) {
 	tests.ClearDB()
 
@@ -145,7 +194,7 @@ func TestLoginPostIncorrectPassword(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostLoginHandler)
+	handler := http.HandlerFunc(testServer.PostLoginHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusUnauthorized
@@ -160,7 +209,7 @@ func TestRegisterPostValid(t *testing.T) {
 	// Create request body
 	name := "tester"
 	email := "tester@example.com"
-	password := "password123"
+	password := "tasty tacos 4 lunch"
 	dob, _ := time.Parse(time.RFC3339, "1969-04-20T05:00:00.000Z")
 	registerBody := registerRequest{
 		NameFirst:   &name,
@@ -175,7 +224,7 @@ func TestRegisterPostValid(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostRegisterHandler)
+	handler := http.HandlerFunc(testServer.PostRegisterHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -197,7 +246,7 @@ func TestRegisterPostInvalidBody(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostRegisterHandler)
+	handler := http.HandlerFunc(testServer.PostRegisterHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -217,7 +266,7 @@ func TestRegisterPostInvalid(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostRegisterHandler)
+	handler := http.HandlerFunc(testServer.PostRegisterHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -226,6 +275,81 @@ func TestRegisterPostInvalid(t *testing.T) {
 	}
 }
 
+func TestRegisterPostInvalidEmail(t *testing.T) {
+	tests.ClearDB()
+
+	// Create request body
+	name := "tester"
+	email := "not an email"
+	password := "password123"
+	dob, _ := time.Parse(time.RFC3339, "1969-04-20T05:00:00.000Z")
+	registerBody := registerRequest{
+		NameFirst:   &name,
+		NameLast:    &name,
+		Email:       &email,
+		Password:    &password,
+		DateOfBirth: &dob,
+	}
+	body, _ := json.Marshal(registerBody)
+
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostRegisterHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("register with invalid email expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestRegisterPostWeakPassword(t *testing.T) {
+	tests.ClearDB()
+
+	// Create request body
+	name := "tester"
+	email := "tester@example.com"
+	password := "password"
+	dob, _ := time.Parse(time.RFC3339, "1969-04-20T05:00:00.000Z")
+	registerBody := registerRequest{
+		NameFirst:   &name,
+		NameLast:    &name,
+		Email:       &email,
+		Password:    &password,
+		DateOfBirth: &dob,
+	}
+	body, _ := json.Marshal(registerBody)
+
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostRegisterHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("register with weak password expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeWeakPassword {
+		t.Errorf("expected error code %v, but got %v", errCodeWeakPassword, response.Error.Code)
+	}
+	failedRules := make(map[string]bool)
+	for _, detail := range response.Error.Details {
+		if detail.Field == "password" {
+			failedRules[detail.Code] = true
+		}
+	}
+	if len(failedRules) != 2 || !failedRules[passwordpolicy.RuleCommon] || !failedRules[passwordpolicy.RuleEntropy] {
+		t.Errorf("expected common and entropy rules to fail, but got %v", response.Error.Details)
+	}
+}
+
 func TestRegisterPostDuplicate(t *testing.T) {
 	tests.ClearDB()
 
@@ -238,7 +362,7 @@ func TestRegisterPostDuplicate(t *testing.T) {
 	// Create request body
 	name := "tester"
 	email := "tester@example.com"
-	password := "password123"
+	password := "tasty tacos 4 lunch"
 	dob, _ := time.Parse(time.RFC3339, "1969-04-20T05:00:00.000Z")
 	registerBody := registerRequest{
 		NameFirst:   &name,
@@ -253,7 +377,7 @@ func TestRegisterPostDuplicate(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PostRegisterHandler)
+	handler := http.HandlerFunc(testServer.PostRegisterHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusConflict
@@ -274,19 +398,18 @@ func TestProfileGetAuthorized(t *testing.T) {
 
 	// Create a JWT
 	claims := jwt.StandardClaims{
+		Id:        "testtoken",
 		ExpiresAt: time.Now().Add(time.Minute * 15).Unix(),
 		Subject:   "testuser",
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret, _ := secrets.GetJWTSecret(nil)
-	jwtString, _ := token.SignedString(jwtSecret)
+	jwtString, _ := secrets.SignJWT(claims)
 
 	req, _ := http.NewRequest("GET", "/profile", nil)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+jwtString)
 
 	rr := httptest.NewRecorder()
-	handler := middleware.AuthenticateUser(http.HandlerFunc(GetProfileHandler))
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -302,7 +425,7 @@ func TestProfileGetUnauthorized(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
-	handler := middleware.AuthenticateUser(http.HandlerFunc(GetProfileHandler))
+	handler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusUnauthorized
@@ -320,7 +443,7 @@ func TestUserGetInvalidID(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetUserHandler)
+	handler := http.HandlerFunc(testServer.GetUserHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusNotFound
@@ -334,7 +457,7 @@ func TestUserGetNoID(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/users", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetUserHandler)
+	handler := http.HandlerFunc(testServer.GetUserHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -357,7 +480,7 @@ func TestUserGetValidID(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(GetUserHandler)
+	handler := http.HandlerFunc(testServer.GetUserHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -382,7 +505,7 @@ func TestProfilePutValid(t *testing.T) {
 
 	nameFirst := "newFirst"
 	nameLast := "newLast"
-	phoneNumber := "654321"
+	phoneNumber := "5126543210"
 	city := "Albany"
 	state := "New York"
 	dateOfBirth, _ := time.Parse(time.RFC3339, "1967-09-07T05:00:00.000Z")
@@ -398,7 +521,7 @@ func TestProfilePutValid(t *testing.T) {
 
 	req, _ := http.NewRequest("PUT", "/users", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutUpdateProfileHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutUpdateProfileHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -414,7 +537,7 @@ func TestProfilePutValid(t *testing.T) {
 		t.Errorf("expected updated user with nameLast 'newLast', but got %v", updatedUser.NameLast)
 	}
 	if updatedUser.PhoneNumber != phoneNumber {
-		t.Errorf("expected updated user with phoneNumber '654321', but got %v", updatedUser.PhoneNumber)
+		t.Errorf("expected updated user with phoneNumber '5126543210', but got %v", updatedUser.PhoneNumber)
 	}
 	if updatedUser.City != city {
 		t.Errorf("expected updated user with city 'Albany', but got %v", updatedUser.City)
@@ -436,7 +559,7 @@ func TestProfilePutInvalidBody(t *testing.T) {
 
 	req, _ := http.NewRequest("PUT", "/profile", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutUpdateProfileHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutUpdateProfileHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusBadRequest
@@ -453,7 +576,7 @@ func TestProfilePutUnauthorized(t *testing.T) {
 
 	req, _ := http.NewRequest("PUT", "/profile", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(PutUpdateProfileHandler)
+	handler := http.HandlerFunc(testServer.PutUpdateProfileHandler)
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusUnauthorized
@@ -476,7 +599,7 @@ func TestAddFavorite(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutFavoriteHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutFavoriteHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -505,7 +628,7 @@ func TestDeleteFavorite(t *testing.T) {
 	}
 	req = mux.SetURLVars(req, vars)
 	rr := httptest.NewRecorder()
-	handler := tests.AuthenticateMockUser(http.HandlerFunc(PutFavoriteHandler))
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutFavoriteHandler))
 	handler.ServeHTTP(rr, req)
 
 	expected := http.StatusOK
@@ -519,3 +642,418 @@ func TestDeleteFavorite(t *testing.T) {
 	}
 
 }
+
+func TestChangePasswordPutValid(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		PasswordHash: passwordHash,
+	})
+	tests.AddRefreshToken(models.JSONRefreshToken{
+		ID:      hashToken("testrefreshtoken"),
+		Family:  "testfamily",
+		User:    "testuser",
+		Expires: time.Now().Add(time.Hour),
+	})
+	testServer.Sessions.Use(context.TODO(), "testfamily", "testuser", "", "", time.Now(), time.Now().Add(time.Hour))
+
+	currentPassword := "oldpassword"
+	newPassword := "newpassword"
+	body, _ := json.Marshal(changePasswordRequest{
+		CurrentPassword: &currentPassword,
+		NewPassword:     &newPassword,
+	})
+	req, _ := http.NewRequest("PUT", "/profile/password", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutChangePasswordHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("changing password expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || bcrypt.CompareHashAndPassword(user.PasswordHash, []byte("newpassword")) != nil {
+		t.Error("changing password should have updated the password")
+	}
+
+	refreshToken := tests.GetRefreshToken(hashToken("testrefreshtoken"))
+	if refreshToken == nil || !refreshToken.Revoked {
+		t.Error("changing password should have revoked existing refresh tokens")
+	}
+
+	// Access tokens from other sessions are rejected, even ones issued in the same second as the change
+	err := testServer.ValidateToken(context.TODO(), &middleware.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:       "testtoken",
+			IssuedAt: time.Now().Unix(),
+			Subject:  "testuser",
+		},
+		SessionID: "testfamily",
+	})
+	if err == nil {
+		t.Error("expected access token from a session logged out by changing password to be invalid")
+	}
+
+	// The new tokens should still work
+	var tokens tokenResponse
+	json.NewDecoder(rr.Body).Decode(&tokens)
+	req, _ = http.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rr = httptest.NewRecorder()
+	profileHandler := middleware.AuthenticateUser(testServer.ValidateToken)(http.HandlerFunc(testServer.GetProfileHandler))
+	profileHandler.ServeHTTP(rr, req)
+
+	expected = http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("getting profile after changing password expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestChangePasswordPutWrongPassword(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		PasswordHash: passwordHash,
+	})
+
+	currentPassword := "notmypassword"
+	newPassword := "newpassword"
+	body, _ := json.Marshal(changePasswordRequest{
+		CurrentPassword: &currentPassword,
+		NewPassword:     &newPassword,
+	})
+	req, _ := http.NewRequest("PUT", "/profile/password", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutChangePasswordHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("changing password with wrong current password expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestChangePasswordPutWeakPassword(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		Email:        "tester@example.com",
+		PasswordHash: passwordHash,
+	})
+
+	currentPassword := "oldpassword"
+	newPassword := "Tester@Example.com"
+	body, _ := json.Marshal(changePasswordRequest{
+		CurrentPassword: &currentPassword,
+		NewPassword:     &newPassword,
+	})
+	req, _ := http.NewRequest("PUT", "/profile/password", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutChangePasswordHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("changing password to email expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	details := response.Error.Details
+	if len(details) != 1 || details[0].Field != "newPassword" || details[0].Code != passwordpolicy.RuleEmail {
+		t.Errorf("expected only the email rule to fail, but got %v", details)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || bcrypt.CompareHashAndPassword(user.PasswordHash, []byte("oldpassword")) != nil {
+		t.Error("changing to a weak password should not have updated the password")
+	}
+}
+
+func TestChangeEmailPutValid(t *testing.T) {
+	tests.ClearDB()
+	testMailer.Clear()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:            "testuser",
+		Email:         "old@munch.app",
+		EmailVerified: true,
+		PasswordHash:  passwordHash,
+	})
+
+	password := "password123"
+	email := "new@munch.app"
+	body, _ := json.Marshal(changeEmailRequest{
+		Password: &password,
+		Email:    &email,
+	})
+	req, _ := http.NewRequest("PUT", "/profile/email", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutChangeEmailHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("changing email expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || user.Email != "new@munch.app" || user.EmailVerified {
+		t.Error("changing email should have set the new email as unverified")
+	}
+	if len(testMailer.Messages("new@munch.app")) != 1 {
+		t.Error("changing email should have sent a verification email to the new email")
+	}
+	if len(testMailer.Messages("old@munch.app")) != 1 {
+		t.Error("changing email should have notified the old email")
+	}
+}
+
+func TestChangeEmailPutDuplicate(t *testing.T) {
+	tests.ClearDB()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	tests.AddUser(models.JSONUser{
+		ID:           "testuser",
+		Email:        "old@munch.app",
+		PasswordHash: passwordHash,
+	})
+	tests.AddUser(models.JSONUser{
+		ID:    "otheruser",
+		Email: "taken@munch.app",
+	})
+
+	password := "password123"
+	email := "taken@munch.app"
+	body, _ := json.Marshal(changeEmailRequest{
+		Password: &password,
+		Email:    &email,
+	})
+	req, _ := http.NewRequest("PUT", "/profile/email", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutChangeEmailHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusConflict
+	if rr.Code != expected {
+		t.Errorf("changing email to one already in use expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestProfileUploadPut(t *testing.T) {
+	tests.ClearDB()
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	req := newImageUploadRequest("/profile/upload", testJPEG(800, 400))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutProfileUploadHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("uploading profile picture expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || !strings.HasPrefix(user.Picture, "http://localhost/uploads/") || user.Picture != user.PictureVariants.Full {
+		t.Fatalf("expected profile picture to be in the blob store, but got %v", user)
+	}
+
+	// The resized thumbnail is served back from the local blob store
+	req, _ = http.NewRequest("GET", strings.TrimPrefix(user.PictureVariants.Thumbnail, "http://localhost"), nil)
+	rr = httptest.NewRecorder()
+	testServer.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected uploaded thumbnail to be served, but got status code %v", rr.Code)
+	}
+	thumbnail, err := jpeg.Decode(rr.Body)
+	if err != nil || thumbnail.Bounds().Dx() != 200 || thumbnail.Bounds().Dy() != 100 {
+		t.Errorf("expected thumbnail to be resized to 200x100, but got %v", err)
+	}
+}
+
+func TestProfileUploadPutNotImage(t *testing.T) {
+	tests.ClearDB()
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	req := newImageUploadRequest("/profile/upload", []byte("not an image"))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutProfileUploadHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("uploading a profile picture that isn't an image expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if user := tests.GetUser("testuser"); user == nil || user.Picture != "" {
+		t.Errorf("expected profile picture not to change, but got %v", user)
+	}
+}
+
+func TestProfileUploadPutTooManyPixels(t *testing.T) {
+	tests.ClearDB()
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	// Only the header of a PNG is needed, its size is checked before it is decoded
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], 4097)
+	binary.BigEndian.PutUint32(ihdr[8:], 4097)
+	ihdr[12], ihdr[13] = 8, 6
+	data := []byte("\x89PNG\r\n\x1A\n\x00\x00\x00\x0D")
+	data = append(data, ihdr...)
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(ihdr))
+	data = append(data, checksum...)
+
+	req := newImageUploadRequest("/profile/upload", data)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PutProfileUploadHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusRequestEntityTooLarge
+	if rr.Code != expected {
+		t.Errorf("uploading a profile picture with too many pixels expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if user := tests.GetUser("testuser"); user == nil || user.Picture != "" {
+		t.Errorf("expected profile picture not to change, but got %v", user)
+	}
+}
+
+func TestProfileUploadsComplete(t *testing.T) {
+	tests.ClearDB()
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	key := presignTestUpload(t, tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostProfileUploadHandler)), testJPEG(100, 100))
+
+	body, _ := json.Marshal(map[string]string{"key": key})
+	req, _ := http.NewRequest("POST", "/profile/uploads/complete", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostProfileUploadCompleteHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("completing profile picture upload expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || user.Picture == "" || user.Picture != user.PictureVariants.Full {
+		t.Errorf("expected profile picture to be set, but got %v", user)
+	}
+
+	// The upload itself is removed once it is resized
+	if _, err := testBlobs.Stat(context.TODO(), key); err != blobstore.ErrNotFound {
+		t.Errorf("expected upload to be deleted, but got %v", err)
+	}
+}
+
+func TestProfileUploadsCompleteHugeHeader(t *testing.T) {
+	tests.ClearDB()
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	// Uploads are streamed into the decoder, so a JPEG whose segments before the image size are larger than what is
+	// kept in memory to find it is rejected
+	data := []byte("\xFF\xD8")
+	segment := append([]byte("\xFF\xEF\xFF\xFF"), make([]byte, 0xFFFF-2)...)
+	for len(data) < maxUploadSize/2 {
+		data = append(data, segment...)
+	}
+	key := presignTestUpload(t, tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostProfileUploadHandler)), data)
+
+	body, _ := json.Marshal(map[string]string{"key": key})
+	req, _ := http.NewRequest("POST", "/profile/uploads/complete", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostProfileUploadCompleteHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("completing upload with a huge header expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if user := tests.GetUser("testuser"); user == nil || user.Picture != "" {
+		t.Errorf("expected profile picture not to change, but got %v", user)
+	}
+	if _, err := testBlobs.Stat(context.TODO(), key); err != blobstore.ErrNotFound {
+		t.Errorf("expected upload to be deleted, but got %v", err)
+	}
+}
+
+func TestProfileUploadsPostInvalidContentType(t *testing.T) {
+	tests.ClearDB()
+
+	body, _ := json.Marshal(map[string]interface{}{"contentType": "image/gif", "size": 100})
+	req, _ := http.NewRequest("POST", "/profile/uploads", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostProfileUploadHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("starting upload of a gif expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestProfileUploadsPostTooLarge(t *testing.T) {
+	tests.ClearDB()
+
+	body, _ := json.Marshal(map[string]interface{}{"contentType": "image/jpeg", "size": maxPresignedUploadSize + 1})
+	req, _ := http.NewRequest("POST", "/profile/uploads", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostProfileUploadHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusRequestEntityTooLarge
+	if rr.Code != expected {
+		t.Errorf("starting upload that is too large expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeTooLarge {
+		t.Errorf("expected error code %v, but got %v", errCodeTooLarge, response.Error.Code)
+	}
+}
+
+func TestProfileUploadsCompleteOtherUsersUpload(t *testing.T) {
+	tests.ClearDB()
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	// Keys of other users' uploads can't be attached
+	testBlobs.Put(context.TODO(), "users_otheruser_upload.jpg", bytes.NewReader(testJPEG(10, 10)), "image/jpeg")
+
+	body, _ := json.Marshal(map[string]string{"key": "users_otheruser_upload.jpg"})
+	req, _ := http.NewRequest("POST", "/profile/uploads/complete", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostProfileUploadCompleteHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusNotFound
+	if rr.Code != expected {
+		t.Errorf("completing another user's upload expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if user := tests.GetUser("testuser"); user == nil || user.Picture != "" {
+		t.Errorf("expected profile picture not to change, but got %v", user)
+	}
+}
@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"munchserver/mailer"
+	"munchserver/middleware"
+	"munchserver/models"
+	"munchserver/secrets"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// emailVerificationTokenLifetime is how long a verification email can be used for
+const emailVerificationTokenLifetime = time.Hour * 24
+
+type verifyEmailRequest struct {
+	Token *string `json:"token"`
+}
+
+// PostVerifyEmailHandler marks the user's email as verified using a token from a verification email
+func (s *Server) PostVerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode request
+	verifyDecoder := json.NewDecoder(r.Body)
+	verifyDecoder.DisallowUnknownFields()
+	var verify verifyEmailRequest
+	err := verifyDecoder.Decode(&verify)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if verify.Token == nil {
+		writeMissingField(w, r, "token")
+		return
+	}
+
+	// Use up the verification token
+	verificationToken, err := s.useUserToken(r.Context(), *verify.Token, models.TokenPurposeEmailVerification)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Token is not valid", errorDetail{Field: "token", Code: errCodeInvalidField, Message: "Token is invalid, expired or already used"})
+		return
+	}
+
+	// Only verify the email the token was sent to, in case the user changed it since
+	verified, err := s.Users.SetEmailVerified(r.Context(), verificationToken.User, verificationToken.Email)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Email could not be verified")
+		return
+	}
+	if !verified {
+		writeError(w, r, http.StatusBadRequest, errCodeInvalidField, "Token is not valid", errorDetail{Field: "token", Code: errCodeInvalidField, Message: "Token is invalid, expired or already used"})
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// PostResendVerificationHandler sends another verification email to the logged in user
+func (s *Server) PostResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from context
+	userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+
+	// Check for a user
+	if !userLoggedIn {
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to resend the verification email")
+		return
+	}
+
+	// Find user in database
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+
+	// Nothing to do if the email is already verified
+	if user.EmailVerified {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Email is already verified")
+		return
+	}
+
+	err = s.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Verification email could not be sent")
+		return
+	}
+
+	// Send response
+	w.WriteHeader(http.StatusOK)
+}
+
+// VerifiedEmailOnly is a middleware which stops logged in users that haven't verified their email.
+// Requests without a user are let through so the handler can authenticate api keys, scraper accounts are
+// let through since they have no inbox.
+func (s *Server) VerifiedEmailOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user from context
+		userID, userLoggedIn := r.Context().Value(middleware.UserKey).(string)
+		if !userLoggedIn || middleware.HasRole(r.Context(), models.RoleScraper) {
+			next(w, r)
+			return
+		}
+
+		// Lookup user in db
+		user, err := s.Users.Get(r.Context(), userID)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Log in to do this")
+			return
+		}
+
+		if !user.EmailVerified {
+			writeError(w, r, http.StatusForbidden, errCodeForbidden, "Verify your email to do this")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// sendVerificationEmail emails the user a link to verify their current email
+func (s *Server) sendVerificationEmail(ctx context.Context, user models.JSONUser) error {
+	token, err := s.createUserTokenForEmail(ctx, user.ID, user.Email, models.TokenPurposeEmailVerification, emailVerificationTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	verifyURL := secrets.GetAppURL() + "/verify-email?token=" + url.QueryEscape(token)
+	return s.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Munch email",
+		Body: fmt.Sprintf("Hi %v,\r\n\r\nWelcome to Munch! Use this link within the next day to verify your email:\r\n\r\n%v\r\n",
+			user.NameFirst, verifyURL),
+	})
+}
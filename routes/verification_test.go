@@ -0,0 +1,195 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"munchserver/models"
+	"munchserver/tests"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRegisterPostSendsVerificationEmail(t *testing.T) {
+	tests.ClearDB()
+	testMailer.Clear()
+
+	name := "tester"
+	email := "tester@example.com"
+	password := "tasty tacos 4 lunch"
+	dob, _ := time.Parse(time.RFC3339, "1969-04-20T05:00:00.000Z")
+	body, _ := json.Marshal(registerRequest{
+		NameFirst:   &name,
+		NameLast:    &name,
+		Email:       &email,
+		Password:    &password,
+		DateOfBirth: &dob,
+	})
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostRegisterHandler)
+	handler.ServeHTTP(rr, req)
+
+	messages := testMailer.Messages("tester@example.com")
+	if len(messages) != 1 {
+		t.Fatalf("expected one verification email, but got %v", len(messages))
+	}
+
+	// Verify with the emailed token
+	match := emailTokenRegexp.FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatal("expected verification email to contain a verification link")
+	}
+	token, _ := url.QueryUnescape(match[1])
+	body, _ = json.Marshal(verifyEmailRequest{
+		Token: &token,
+	})
+	req, _ = http.NewRequest("POST", "/verify-email", bytes.NewBuffer(body))
+	rr = httptest.NewRecorder()
+	handler = http.HandlerFunc(testServer.PostVerifyEmailHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("verifying email with emailed token expected status code of %v, but got %v", expected, rr.Code)
+	}
+}
+
+func TestVerifyEmailPostValid(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Email: "test@munch.app",
+	})
+	tests.AddUserToken(models.JSONUserToken{
+		ID:      hashToken("testverificationtoken"),
+		User:    "testuser",
+		Purpose: models.TokenPurposeEmailVerification,
+		Email:   "test@munch.app",
+		Expires: time.Now().Add(time.Hour),
+	})
+
+	token := "testverificationtoken"
+	body, _ := json.Marshal(verifyEmailRequest{
+		Token: &token,
+	})
+	req, _ := http.NewRequest("POST", "/verify-email", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostVerifyEmailHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("verifying email with valid token expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || !user.EmailVerified {
+		t.Error("verifying email should have marked the email verified")
+	}
+}
+
+func TestVerifyEmailPostChangedEmail(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Email: "new@munch.app",
+	})
+	tests.AddUserToken(models.JSONUserToken{
+		ID:      hashToken("testverificationtoken"),
+		User:    "testuser",
+		Purpose: models.TokenPurposeEmailVerification,
+		Email:   "old@munch.app",
+		Expires: time.Now().Add(time.Hour),
+	})
+
+	token := "testverificationtoken"
+	body, _ := json.Marshal(verifyEmailRequest{
+		Token: &token,
+	})
+	req, _ := http.NewRequest("POST", "/verify-email", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testServer.PostVerifyEmailHandler)
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusBadRequest
+	if rr.Code != expected {
+		t.Errorf("verifying email with token for an old email expected status code of %v, but got %v", expected, rr.Code)
+	}
+
+	user := tests.GetUser("testuser")
+	if user == nil || user.EmailVerified {
+		t.Error("verifying an old email should not have verified the new email")
+	}
+}
+
+func TestResendVerificationPost(t *testing.T) {
+	tests.ClearDB()
+	testMailer.Clear()
+
+	tests.AddUser(models.JSONUser{
+		ID:    "testuser",
+		Email: "test@munch.app",
+	})
+
+	req, _ := http.NewRequest("POST", "/verify-email/resend", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(http.HandlerFunc(testServer.PostResendVerificationHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusOK
+	if rr.Code != expected {
+		t.Errorf("resending verification email expected status code of %v, but got %v", expected, rr.Code)
+	}
+	if len(testMailer.Messages("test@munch.app")) != 1 {
+		t.Error("resending verification email should have sent an email")
+	}
+}
+
+func TestVerifiedEmailOnlyUnverified(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID: "testuser",
+	})
+
+	req, _ := http.NewRequest("POST", "/reviews", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.VerifiedEmailOnly(testServer.PostReviewsHandler))
+	handler.ServeHTTP(rr, req)
+
+	expected := http.StatusForbidden
+	if rr.Code != expected {
+		t.Errorf("adding review with unverified email expected status code of %v, but got %v", expected, rr.Code)
+	}
+	var response errorResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Error.Code != errCodeForbidden {
+		t.Errorf("expected error code %v, but got %v", errCodeForbidden, response.Error.Code)
+	}
+}
+
+func TestVerifiedEmailOnlyVerified(t *testing.T) {
+	tests.ClearDB()
+
+	tests.AddUser(models.JSONUser{
+		ID:            "testuser",
+		EmailVerified: true,
+	})
+
+	called := false
+	req, _ := http.NewRequest("POST", "/reviews", nil)
+	rr := httptest.NewRecorder()
+	handler := tests.AuthenticateMockUser(testServer.VerifiedEmailOnly(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	handler.ServeHTTP(rr, req)
+
+	if !called {
+		t.Error("expected user with verified email to be let through")
+	}
+}
@@ -0,0 +1,315 @@
+package secrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// developmentJWTSecret is only used in development when no signing keys are configured
+const developmentJWTSecret = "MunchIsReallyCool"
+
+// hmacKeyID is the kid of the key from JWT_SECRET
+const hmacKeyID = "hs256"
+
+// SigningKey is a key used to sign and verify JWTs
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private is the key used to sign, it is nil for keys that can only verify
+	Private interface{}
+	// Public is the key used to verify
+	Public interface{}
+}
+
+// JWK is the public part of a signing key as a JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a set of JSON Web Keys
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	signingKeysLock   sync.RWMutex
+	signingKeys       map[string]*SigningKey
+	activeSigningKey  *SigningKey
+	signingKeysLoaded bool
+)
+
+// LoadSigningKeys loads the JWT signing keys from the environment.
+//
+// JWT_SECRET is a secret for HS256, JWT_PRIVATE_KEYS holds PEM encoded RSA or EC keys and
+// JWT_KEY_FILES is a comma separated list of PEM files. Public keys can be given to keep
+// verifying tokens signed by a rotated out key. JWT_SIGNING_KEY_ID picks the key that signs
+// new tokens, defaulting to the first private key. Without any keys it fails unless MUNCH_ENV
+// is development, where an insecure development secret is used instead.
+func LoadSigningKeys() error {
+	keys := make(map[string]*SigningKey)
+	var orderedKeys []*SigningKey
+
+	// Load the HMAC secret
+	secret, secretExists := os.LookupEnv("JWT_SECRET")
+	if secretExists {
+		key := &SigningKey{
+			ID:      hmacKeyID,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(secret),
+			Public:  []byte(secret),
+		}
+		keys[key.ID] = key
+		orderedKeys = append(orderedKeys, key)
+	}
+
+	// Load PEM keys from the environment and from files
+	var pemData [][]byte
+	if privateKeys, exists := os.LookupEnv("JWT_PRIVATE_KEYS"); exists {
+		pemData = append(pemData, []byte(privateKeys))
+	}
+	if keyFiles, exists := os.LookupEnv("JWT_KEY_FILES"); exists {
+		for _, keyFile := range strings.Split(keyFiles, ",") {
+			data, err := ioutil.ReadFile(strings.TrimSpace(keyFile))
+			if err != nil {
+				return err
+			}
+			pemData = append(pemData, data)
+		}
+	}
+	for _, data := range pemData {
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			key, err := parseSigningKey(pem.EncodeToMemory(block))
+			if err != nil {
+				return err
+			}
+			keys[key.ID] = key
+			orderedKeys = append(orderedKeys, key)
+		}
+	}
+
+	// Fall back to the development secret so the server still runs locally, but never in production where anyone could
+	// sign tokens with it
+	if len(orderedKeys) == 0 {
+		if !IsDevelopment() {
+			return errors.New("no JWT signing keys found, set JWT_SECRET, JWT_PRIVATE_KEYS or JWT_KEY_FILES, or MUNCH_ENV=development to use an insecure development secret")
+		}
+		log.Println("JWT signing keys not found, using an insecure development secret")
+		key := &SigningKey{
+			ID:      hmacKeyID,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(developmentJWTSecret),
+			Public:  []byte(developmentJWTSecret),
+		}
+		keys[key.ID] = key
+		orderedKeys = append(orderedKeys, key)
+	}
+
+	// Pick the key that signs new tokens
+	var active *SigningKey
+	if activeID, exists := os.LookupEnv("JWT_SIGNING_KEY_ID"); exists {
+		active = keys[activeID]
+		if active == nil || active.Private == nil {
+			return fmt.Errorf("signing key %v not found", activeID)
+		}
+	} else {
+		for _, key := range orderedKeys {
+			if key.Private != nil && key.ID != hmacKeyID {
+				active = key
+				break
+			}
+		}
+		if active == nil {
+			active = keys[hmacKeyID]
+		}
+		if active == nil {
+			return errors.New("no private key to sign tokens with")
+		}
+	}
+
+	signingKeysLock.Lock()
+	defer signingKeysLock.Unlock()
+	signingKeys = keys
+	activeSigningKey = active
+	signingKeysLoaded = true
+	return nil
+}
+
+// GetJWTSecret finds the key to verify a token with from its kid header
+func GetJWTSecret(token *jwt.Token) (interface{}, error) {
+	ensureSigningKeys()
+	signingKeysLock.RLock()
+	defer signingKeysLock.RUnlock()
+
+	// Tokens without a kid were signed with the HMAC secret
+	keyID, _ := token.Header["kid"].(string)
+	if keyID == "" {
+		keyID = hmacKeyID
+	}
+
+	key, exists := signingKeys[keyID]
+	if !exists {
+		return nil, fmt.Errorf("unknown signing key %v", keyID)
+	}
+
+	// Make sure the token uses the key's algorithm, so a public key can't be used as an HMAC secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// SignJWT signs the claims with the active signing key
+func SignJWT(claims jwt.Claims) (string, error) {
+	ensureSigningKeys()
+	signingKeysLock.RLock()
+	key := activeSigningKey
+	signingKeysLock.RUnlock()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// GetJWKS gets the public keys that can verify tokens, HMAC secrets are never included
+func GetJWKS() JWKS {
+	ensureSigningKeys()
+	signingKeysLock.RLock()
+	defer signingKeysLock.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range signingKeys {
+		jwk, ok := toJWK(key)
+		if ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// ensureSigningKeys loads the signing keys the first time they are needed
+func ensureSigningKeys() {
+	signingKeysLock.RLock()
+	loaded := signingKeysLoaded
+	signingKeysLock.RUnlock()
+	if !loaded {
+		err := LoadSigningKeys()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// parseSigningKey parses a PEM encoded RSA or EC key
+func parseSigningKey(data []byte) (*SigningKey, error) {
+	if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return newSigningKey(privateKey, &privateKey.PublicKey)
+	}
+	if privateKey, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+		return newSigningKey(privateKey, &privateKey.PublicKey)
+	}
+	if publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return newSigningKey(nil, publicKey)
+	}
+	if publicKey, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return newSigningKey(nil, publicKey)
+	}
+	return nil, errors.New("signing key must be a PEM encoded RSA or EC key")
+}
+
+// newSigningKey creates a signing key with a kid of the public key's thumbprint
+func newSigningKey(privateKey interface{}, publicKey interface{}) (*SigningKey, error) {
+	key := &SigningKey{
+		Private: privateKey,
+		Public:  publicKey,
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch publicKey.Curve.Params().Name {
+		case "P-256":
+			key.Method = jwt.SigningMethodES256
+		case "P-384":
+			key.Method = jwt.SigningMethodES384
+		default:
+			return nil, fmt.Errorf("unsupported curve %v", publicKey.Curve.Params().Name)
+		}
+	}
+
+	// The thumbprint only depends on the key, so every service agrees on its kid
+	jwk, _ := toJWK(key)
+	thumbprintMembers := map[string]string{"kty": jwk.Kty}
+	if jwk.Kty == "RSA" {
+		thumbprintMembers["e"] = jwk.E
+		thumbprintMembers["n"] = jwk.N
+	} else {
+		thumbprintMembers["crv"] = jwk.Crv
+		thumbprintMembers["x"] = jwk.X
+		thumbprintMembers["y"] = jwk.Y
+	}
+	thumbprintJSON, _ := json.Marshal(thumbprintMembers)
+	thumbprint := sha256.Sum256(thumbprintJSON)
+	key.ID = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	return key, nil
+}
+
+// toJWK converts the public part of a key to a JWK
+func toJWK(key *SigningKey) (JWK, bool) {
+	jwk := JWK{
+		Kid: key.ID,
+		Use: "sig",
+		Alg: key.Method.Alg(),
+	}
+	switch publicKey := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = publicKey.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(padBytes(publicKey.X.Bytes(), size))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(padBytes(publicKey.Y.Bytes(), size))
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// padBytes left pads b with zeros to size bytes
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
@@ -3,13 +3,14 @@ package secrets
 import (
 	"log"
 	"os"
-
-	"github.com/dgrijalva/jwt-go"
+	"strconv"
+	"strings"
 )
 
-// TODO: Move the secret to an env var
-func GetJWTSecret(token *jwt.Token) (interface{}, error) {
-	return []byte("MunchIsReallyCool"), nil
+// IsDevelopment is true when MUNCH_ENV is development, which lets the server run locally without its secrets
+func IsDevelopment() bool {
+	env, _ := os.LookupEnv("MUNCH_ENV")
+	return env == "development"
 }
 
 func GetMongoURI() string {
@@ -60,3 +61,149 @@ func GetAWSSecretAccessKey() string {
 	}
 	return secretAccessKey
 }
+
+func GetSMTPHost() string {
+	host, exists := os.LookupEnv("SMTP_HOST")
+	if !exists {
+		log.Println("SMTP host not found, emails will be written to the mail directory")
+	}
+	return host
+}
+
+func GetSMTPPort() string {
+	port, exists := os.LookupEnv("SMTP_PORT")
+	if !exists {
+		port = "587"
+	}
+	return port
+}
+
+func GetSMTPUsername() string {
+	username, _ := os.LookupEnv("SMTP_USERNAME")
+	return username
+}
+
+func GetSMTPPassword() string {
+	password, _ := os.LookupEnv("SMTP_PASSWORD")
+	return password
+}
+
+func GetMailFrom() string {
+	from, exists := os.LookupEnv("MAIL_FROM")
+	if !exists {
+		from = "Munch <noreply@munch.app>"
+	}
+	return from
+}
+
+func GetMailDir() string {
+	dir, exists := os.LookupEnv("MAIL_DIR")
+	if !exists {
+		dir = "mail"
+	}
+	return dir
+}
+
+func GetAppURL() string {
+	appURL, exists := os.LookupEnv("APP_URL")
+	if !exists {
+		appURL = "http://localhost:3000"
+	}
+	return appURL
+}
+
+// GetTrustProxy is true when the server is behind a proxy, like Heroku's router, that sets X-Forwarded-For
+func GetTrustProxy() bool {
+	trustProxy, _ := os.LookupEnv("TRUST_PROXY")
+	return trustProxy == "true"
+}
+
+// GetOIDCProviders gets the names of the OpenID Connect providers users can log in with, like google,apple
+func GetOIDCProviders() []string {
+	providers, exists := os.LookupEnv("OIDC_PROVIDERS")
+	if !exists || providers == "" {
+		return nil
+	}
+	return strings.Split(providers, ",")
+}
+
+// GetOIDCProviderConfig gets the issuer, client id, client secret and redirect url of a provider from
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_REDIRECT_URL
+func GetOIDCProviderConfig(name string) (string, string, string, string) {
+	prefix := "OIDC_" + strings.ToUpper(strings.TrimSpace(name)) + "_"
+	issuer, exists := os.LookupEnv(prefix + "ISSUER")
+	if !exists {
+		log.Printf("%vISSUER not found, logging in with %v will not work", prefix, name)
+	}
+	clientID, exists := os.LookupEnv(prefix + "CLIENT_ID")
+	if !exists {
+		log.Printf("%vCLIENT_ID not found, logging in with %v will not work", prefix, name)
+	}
+	clientSecret, _ := os.LookupEnv(prefix + "CLIENT_SECRET")
+	redirectURL, _ := os.LookupEnv(prefix + "REDIRECT_URL")
+	return issuer, clientID, clientSecret, redirectURL
+}
+
+// GetPasswordMinLength gets the fewest characters a password can have, or 0 to use the default policy
+func GetPasswordMinLength() int {
+	minLength, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH"))
+	if err != nil {
+		return 0
+	}
+	return minLength
+}
+
+// GetPasswordMinEntropy gets the fewest bits of estimated entropy a password can have, or 0 to use the default policy
+func GetPasswordMinEntropy() float64 {
+	minEntropy, err := strconv.ParseFloat(os.Getenv("PASSWORD_MIN_ENTROPY"), 64)
+	if err != nil {
+		return 0
+	}
+	return minEntropy
+}
+
+// GetBlobStore gets where uploads are kept, s3 or local, defaulting to s3 only when there are AWS credentials
+func GetBlobStore() string {
+	blobStore, exists := os.LookupEnv("BLOB_STORE")
+	if !exists {
+		if _, hasKey := os.LookupEnv("AWS_ACCESS_KEY"); hasKey {
+			return "s3"
+		}
+		return "local"
+	}
+	return blobStore
+}
+
+func GetS3Bucket() string {
+	bucket, exists := os.LookupEnv("S3_BUCKET")
+	if !exists {
+		bucket = "munch-assets"
+	}
+	return bucket
+}
+
+func GetS3Region() string {
+	region, exists := os.LookupEnv("S3_REGION")
+	if !exists {
+		region = "us-west-2"
+	}
+	return region
+}
+
+// GetBlobDir gets the directory uploads are written to when they are kept locally
+func GetBlobDir() string {
+	dir, exists := os.LookupEnv("BLOB_DIR")
+	if !exists {
+		dir = "uploads"
+	}
+	return dir
+}
+
+// GetBlobBaseURL gets the url locally kept uploads are served from, its path is where they are routed
+func GetBlobBaseURL() string {
+	baseURL, exists := os.LookupEnv("BLOB_BASE_URL")
+	if !exists {
+		baseURL = "http://localhost:" + GetPort() + "/uploads"
+	}
+	return baseURL
+}
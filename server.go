@@ -4,45 +4,27 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"munchserver/middleware"
+	"munchserver/blobstore"
+	"munchserver/mailer"
+	"munchserver/oidc"
 	"munchserver/routes"
 	"munchserver/secrets"
+	"munchserver/store"
 	"net/http"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func main() {
-	// Setup http router
-	router := mux.NewRouter()
-	router.HandleFunc("/register", routes.PostRegisterHandler).Methods("POST")
-	router.HandleFunc("/login", routes.PostLoginHandler).Methods("POST")
-	router.HandleFunc("/foodtrucks", routes.GetFoodTrucksHandler).Methods("GET")
-	router.HandleFunc("/foodtrucks/{foodTruckID}", routes.GetFoodTruckHandler).Methods("GET")
-	router.HandleFunc("/reviews", routes.GetReviewsHandler).Methods("GET")
-	router.HandleFunc("/reviews/{reviewID}", routes.GetReviewHandler).Methods("GET")
-	router.HandleFunc("/reviews/foodtruck/{foodTruckID}", routes.GetReviewsOfFoodTruckHandler).Methods("GET")
-	router.HandleFunc("/contributors", routes.GetContributorsHandler).Methods("GET")
-	router.HandleFunc("/users/{userID}", routes.GetUserHandler).Methods("GET")
-
-	// Auth required routes
-	router.Use(middleware.AuthenticateUser)
-	router.HandleFunc("/profile", routes.GetProfileHandler).Methods("GET")
-	router.HandleFunc("/profile/upload", routes.PutProfileUploadHandler).Methods("PUT")
-	router.HandleFunc("/foodtrucks", routes.PostFoodTrucksHandler).Methods("POST")
-	router.HandleFunc("/foodtrucks/claim/{foodTruckID}", routes.PutClaimFoodTruckHandler).Methods("PUT")
-	router.HandleFunc("/foodtrucks/upload/{foodTruckID}", routes.PutFoodTruckUploadHandler).Methods("PUT")
-	router.HandleFunc("/reviews", routes.PostReviewsHandler).Methods("POST")
-	router.HandleFunc("/users/favorite/{foodTruckID}", routes.PutFavoriteHandler).Methods("PUT")
-	router.HandleFunc("/profile", routes.PutUpdateProfileHandler).Methods("PUT")
-	router.HandleFunc("/foodtrucks/{foodTruckID}", routes.PutFoodTrucksHandler).Methods("PUT")
+	// Load JWT signing keys
+	err := secrets.LoadSigningKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Connect to MongoDB
 	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(secrets.GetMongoURI()))
@@ -54,41 +36,82 @@ func main() {
 
 	db := client.Database(secrets.GetMongoDBName())
 
-	// Inject db to routes
-	routes.Db = db
-	routes.Router = router
-
-	// Create aws session
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-west-2"),
-		Credentials: credentials.NewStaticCredentials(
-			secrets.GetAWSAccessKey(),       // id
-			secrets.GetAWSSecretAccessKey(), // secret
-			""),                             // token can be left blank for now
-	})
-	if err != nil {
-		log.Printf("ERROR: %v", err)
+	// Keep uploads in S3, or on disk when developing locally
+	var blobs blobstore.BlobStore
+	if secrets.GetBlobStore() == "s3" {
+		// Create aws session
+		sess, err := session.NewSession(&aws.Config{
+			Region: aws.String(secrets.GetS3Region()),
+			Credentials: credentials.NewStaticCredentials(
+				secrets.GetAWSAccessKey(),       // id
+				secrets.GetAWSSecretAccessKey(), // secret
+				""),                             // token can be left blank for now
+		})
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+		blobs = blobstore.NewS3Store(sess, secrets.GetS3Bucket())
+	} else {
+		blobs, err = blobstore.NewLocalStore(secrets.GetBlobDir(), secrets.GetBlobBaseURL())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Send emails through SMTP, or write them to files when developing locally
+	var mail mailer.Mailer
+	smtpHost := secrets.GetSMTPHost()
+	if smtpHost != "" {
+		mail = mailer.NewSMTPMailer(smtpHost, secrets.GetSMTPPort(), secrets.GetSMTPUsername(), secrets.GetSMTPPassword(), secrets.GetMailFrom())
+	} else {
+		mail, err = mailer.NewFileMailer(secrets.GetMailDir(), secrets.GetMailFrom())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Inject dependencies to routes
+	server := routes.NewServer(store.NewMongoStores(db), blobs, mail)
+
+	// Setup OpenID Connect providers for social login
+	for _, providerName := range secrets.GetOIDCProviders() {
+		issuer, clientID, clientSecret, redirectURL := secrets.GetOIDCProviderConfig(providerName)
+		server.OIDCProviders[providerName] = oidc.NewProvider(providerName, issuer, clientID, clientSecret, redirectURL)
 	}
 
-	routes.Uploader = s3manager.NewUploader(sess)
+	// Setup the password policy, anything not configured uses the default
+	if minLength := secrets.GetPasswordMinLength(); minLength > 0 {
+		server.PasswordPolicy.MinLength = minLength
+	}
+	if minEntropy := secrets.GetPasswordMinEntropy(); minEntropy > 0 {
+		server.PasswordPolicy.MinEntropy = minEntropy
+	}
 
 	// Setup db indexes
-	userIndex := mongo.IndexModel{
-		Keys:    bson.M{"email": 1},
-		Options: options.Index().SetUnique(true).SetBackground(true),
+	err = store.CreateIndexes(context.TODO(), db)
+	if err != nil {
+		log.Fatal(err)
 	}
-	_, err = db.Collection("users").Indexes().CreateOne(context.TODO(), userIndex)
+
+	// Move food truck photos kept as urls to their own fields
+	foodTrucks := store.NewMongoFoodTruckStore(db)
+	err = foodTrucks.MigratePhotos(context.TODO())
 	if err != nil {
 		log.Fatal(err)
 	}
-	locationIndex := mongo.IndexModel{
-		Keys: bson.M{"location": "2dsphere"},
+
+	// Date food trucks added before they were dated, so they can be sorted by when they were added
+	err = foodTrucks.MigrateCreated(context.TODO())
+	if err != nil {
+		log.Fatal(err)
 	}
-	_, err = db.Collection("foodTrucks").Indexes().CreateOne(context.TODO(), locationIndex)
+
+	// Verify the emails of users who registered before emails were verified, so they aren't locked out of reviewing
+	err = store.NewMongoUserStore(db).MigrateEmailVerified(context.TODO())
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	fmt.Println("Connected to MongoDB!")
-	log.Fatal(http.ListenAndServe(":"+secrets.GetPort(), router))
+	log.Fatal(http.ListenAndServe(":"+secrets.GetPort(), server))
 }
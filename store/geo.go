@@ -0,0 +1,20 @@
+package store
+
+import "math"
+
+// earthRadius is the radius in meters mongo uses for spherical distances
+const earthRadius = 6378100
+
+// Distance is the great circle distance in meters between two longitude and latitude points
+func Distance(from [2]float64, to [2]float64) float64 {
+	lon1, lat1 := radians(from[0]), radians(from[1])
+	lon2, lat2 := radians(to[0]), radians(to[1])
+	sinLat := math.Sin((lat2 - lat1) / 2)
+	sinLon := math.Sin((lon2 - lon1) / 2)
+	a := sinLat*sinLat + math.Cos(lat1)*math.Cos(lat2)*sinLon*sinLon
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
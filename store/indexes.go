@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateIndexes sets up the indexes the mongo stores rely on in the database
+func CreateIndexes(ctx context.Context, db *mongo.Database) error {
+	indexes := map[string][]mongo.IndexModel{
+		"users": {
+			{
+				Keys:    bson.M{"email": 1},
+				Options: options.Index().SetUnique(true).SetBackground(true),
+			},
+			{
+				Keys: bson.D{{"identities.provider", 1}, {"identities.subject", 1}},
+			},
+		},
+		"foodTrucks": {
+			{
+				Keys: bson.M{"location": "2dsphere"},
+			},
+			{
+				Keys: bson.D{{"avgRating", -1}, {"_id", 1}},
+			},
+			{
+				Keys: bson.D{{"name", 1}, {"_id", 1}},
+			},
+			{
+				Keys: bson.D{{"created", -1}, {"_id", 1}},
+			},
+		},
+		"reviews": {
+			{
+				Keys: bson.D{{"date", -1}, {"_id", 1}},
+			},
+			{
+				Keys: bson.D{{"foodTruck", 1}, {"date", -1}, {"_id", 1}},
+			},
+		},
+		"claims": {
+			{
+				Keys: bson.D{{"foodTruck", 1}, {"status", 1}},
+			},
+		},
+		"apiKeys": {
+			{
+				Keys:    bson.M{"hash": 1},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+		"refreshTokens": {
+			{
+				Keys: bson.M{"family": 1},
+			},
+			{
+				Keys: bson.M{"user": 1},
+			},
+			{
+				Keys:    bson.M{"expires": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+		"revokedTokens": {
+			{
+				Keys:    bson.M{"expires": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+		"userTokens": {
+			{
+				Keys: bson.M{"user": 1},
+			},
+			{
+				Keys:    bson.M{"expires": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+		"sessions": {
+			{
+				Keys: bson.M{"user": 1},
+			},
+			{
+				Keys:    bson.M{"expires": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+		"loginAttempts": {
+			{
+				Keys:    bson.M{"expires": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	}
+	for collection, indexModels := range indexes {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexModels)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1395 @@
+package store
+
+import (
+	"context"
+	"munchserver/models"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryFoodTruckStore keeps food trucks in memory, in the order they were added
+type MemoryFoodTruckStore struct {
+	mu         sync.Mutex
+	foodTrucks []models.JSONFoodTruck
+}
+
+// NewMemoryFoodTruckStore creates an empty in-memory food truck store
+func NewMemoryFoodTruckStore() *MemoryFoodTruckStore {
+	return &MemoryFoodTruckStore{}
+}
+
+func (s *MemoryFoodTruckStore) Get(ctx context.Context, id string) (models.JSONFoodTruck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.JSONFoodTruck{}, ErrNotFound
+	}
+	return copyFoodTruck(s.foodTrucks[i]), nil
+}
+
+func (s *MemoryFoodTruckStore) GetMany(ctx context.Context, ids []string) ([]models.JSONFoodTruck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	foodTrucks := make([]models.JSONFoodTruck, 0)
+	for _, foodTruck := range s.foodTrucks {
+		if containsString(ids, foodTruck.ID) {
+			foodTrucks = append(foodTrucks, copyFoodTruck(foodTruck))
+		}
+	}
+	return foodTrucks, nil
+}
+
+func (s *MemoryFoodTruckStore) List(ctx context.Context, query FoodTruckQuery, page Page) ([]FoodTruckWithDistance, string, error) {
+	sortBy := query.sortOrder()
+	after, err := page.after(sortBy)
+	if err != nil {
+		return make([]FoodTruckWithDistance, 0), "", err
+	}
+
+	var pattern *regexp.Regexp
+	if query.Text != "" {
+		pattern, err = regexp.Compile(textPattern(query.Text))
+		if err != nil {
+			return make([]FoodTruckWithDistance, 0), "", err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	foodTrucks := make([]FoodTruckWithDistance, 0)
+	for _, foodTruck := range s.foodTrucks {
+		if pattern != nil && !pattern.MatchString(foodTruck.Name) && !matchesAny(pattern, foodTruck.Tags) {
+			continue
+		}
+		if query.MinRating != nil && foodTruck.AvgRating < *query.MinRating {
+			continue
+		}
+		if len(query.Tags) > 0 && !hasTags(foodTruck.Tags, query.Tags, query.AnyTag) {
+			continue
+		}
+		if query.Status != nil && foodTruck.Status != *query.Status {
+			continue
+		}
+		if query.Claimed != nil && (foodTruck.Owner != "") != *query.Claimed {
+			continue
+		}
+		listed := FoodTruckWithDistance{JSONFoodTruck: copyFoodTruck(foodTruck)}
+		if query.Near != nil {
+			listed.Distance = Distance(*query.Near, foodTruck.Location)
+			if query.MaxDistance != nil && listed.Distance > *query.MaxDistance {
+				continue
+			}
+		}
+		foodTrucks = append(foodTrucks, listed)
+	}
+
+	// Sort like mongo, with ids breaking ties
+	sort.Slice(foodTrucks, func(i, j int) bool {
+		return foodTruckCursor(foodTrucks[i], sortBy).before(foodTruckCursor(foodTrucks[j], sortBy))
+	})
+
+	// Start after the last food truck of the page before
+	if after != nil {
+		foodTrucks = foodTrucks[sort.Search(len(foodTrucks), func(i int) bool {
+			return after.before(foodTruckCursor(foodTrucks[i], sortBy))
+		}):]
+	}
+	foodTrucks, next := nextFoodTrucksPage(foodTrucks, page.limit(), sortBy)
+	return foodTrucks, next, nil
+}
+
+func (s *MemoryFoodTruckStore) ListByOwner(ctx context.Context, owner string) ([]models.JSONFoodTruck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	foodTrucks := make([]models.JSONFoodTruck, 0)
+	for _, foodTruck := range s.foodTrucks {
+		if foodTruck.Owner == owner {
+			foodTrucks = append(foodTrucks, copyFoodTruck(foodTruck))
+		}
+	}
+	return foodTrucks, nil
+}
+
+func (s *MemoryFoodTruckStore) Add(ctx context.Context, foodTruck models.JSONFoodTruck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index(foodTruck.ID) >= 0 {
+		return ErrDuplicateID
+	}
+	s.foodTrucks = append(s.foodTrucks, copyFoodTruck(foodTruck))
+	return nil
+}
+
+func (s *MemoryFoodTruckStore) Update(ctx context.Context, id string, update FoodTruckUpdate) error {
+	return s.update(id, func(foodTruck *models.JSONFoodTruck) {
+		if update.Name != nil {
+			foodTruck.Name = *update.Name
+		}
+		if update.Address != nil {
+			foodTruck.Address = *update.Address
+		}
+		if update.Location != nil {
+			foodTruck.Location = *update.Location
+		}
+		if update.Status != nil {
+			foodTruck.Status = *update.Status
+		}
+		if update.Hours != nil {
+			foodTruck.Hours = *update.Hours
+		}
+		if update.Website != nil {
+			foodTruck.Website = *update.Website
+		}
+		if update.PhoneNumber != nil {
+			foodTruck.PhoneNumber = *update.PhoneNumber
+		}
+		if update.Description != nil {
+			foodTruck.Description = *update.Description
+		}
+		if update.Tags != nil {
+			foodTruck.Tags = copyStrings(update.Tags)
+		}
+	})
+}
+
+func (s *MemoryFoodTruckStore) AddReview(ctx context.Context, id string, reviewID string, avgRating float64) error {
+	return s.update(id, func(foodTruck *models.JSONFoodTruck) {
+		foodTruck.AvgRating = avgRating
+		foodTruck.Reviews = append(foodTruck.Reviews, reviewID)
+	})
+}
+
+func (s *MemoryFoodTruckStore) AddPhoto(ctx context.Context, id string, photo models.JSONPhoto) error {
+	return s.update(id, func(foodTruck *models.JSONFoodTruck) {
+		foodTruck.Photos = append(foodTruck.Photos, copyPhotos([]models.JSONPhoto{photo})...)
+	})
+}
+
+func (s *MemoryFoodTruckStore) ReplacePhotos(ctx context.Context, id string, oldPhotos []models.JSONPhoto, photos []models.JSONPhoto) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || !reflect.DeepEqual(s.foodTrucks[i].Photos, oldPhotos) {
+		return false, nil
+	}
+	s.foodTrucks[i].Photos = copyPhotos(photos)
+	return true, nil
+}
+
+func (s *MemoryFoodTruckStore) ReplaceOwner(ctx context.Context, id string, oldOwner string, newOwner string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || s.foodTrucks[i].Owner != oldOwner {
+		return false, nil
+	}
+	s.foodTrucks[i].Owner = newOwner
+	return true, nil
+}
+
+func (s *MemoryFoodTruckStore) ClearOwner(ctx context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.foodTrucks {
+		if s.foodTrucks[i].Owner == owner {
+			s.foodTrucks[i].Owner = ""
+		}
+	}
+	return nil
+}
+
+// Clear removes all food trucks
+func (s *MemoryFoodTruckStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.foodTrucks = nil
+}
+
+// index finds where the food truck with the id is, or -1 if there isn't one
+func (s *MemoryFoodTruckStore) index(id string) int {
+	for i, foodTruck := range s.foodTrucks {
+		if foodTruck.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// update changes the food truck with the id, it isn't an error if there isn't one
+func (s *MemoryFoodTruckStore) update(id string, change func(*models.JSONFoodTruck)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i >= 0 {
+		change(&s.foodTrucks[i])
+	}
+	return nil
+}
+
+// MemoryReviewStore keeps reviews in memory, in the order they were added
+type MemoryReviewStore struct {
+	mu      sync.Mutex
+	reviews []models.JSONReview
+}
+
+// NewMemoryReviewStore creates an empty in-memory review store
+func NewMemoryReviewStore() *MemoryReviewStore {
+	return &MemoryReviewStore{}
+}
+
+func (s *MemoryReviewStore) Get(ctx context.Context, id string) (models.JSONReview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, review := range s.reviews {
+		if review.ID == id {
+			return review, nil
+		}
+	}
+	return models.JSONReview{}, ErrNotFound
+}
+
+func (s *MemoryReviewStore) GetMany(ctx context.Context, ids []string) ([]models.JSONReview, error) {
+	return s.filter(func(review models.JSONReview) bool {
+		return containsString(ids, review.ID)
+	}), nil
+}
+
+func (s *MemoryReviewStore) List(ctx context.Context, page Page) ([]models.JSONReview, string, error) {
+	return listReviews(s.filter(func(review models.JSONReview) bool {
+		return true
+	}), page)
+}
+
+func (s *MemoryReviewStore) ListByFoodTruck(ctx context.Context, foodTruckID string, page Page) ([]models.JSONReview, string, error) {
+	return listReviews(s.filter(func(review models.JSONReview) bool {
+		return review.FoodTruck == foodTruckID
+	}), page)
+}
+
+func (s *MemoryReviewStore) ListByReviewer(ctx context.Context, reviewer string) ([]models.JSONReview, error) {
+	return s.filter(func(review models.JSONReview) bool {
+		return review.Reviewer == reviewer
+	}), nil
+}
+
+func (s *MemoryReviewStore) Add(ctx context.Context, review models.JSONReview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.reviews {
+		if existing.ID == review.ID {
+			return ErrDuplicateID
+		}
+	}
+	s.reviews = append(s.reviews, review)
+	return nil
+}
+
+func (s *MemoryReviewStore) SetReviewer(ctx context.Context, oldReviewer string, reviewer string, reviewerName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.reviews {
+		if s.reviews[i].Reviewer == oldReviewer {
+			s.reviews[i].Reviewer = reviewer
+			s.reviews[i].ReviewerName = reviewerName
+		}
+	}
+	return nil
+}
+
+// Clear removes all reviews
+func (s *MemoryReviewStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reviews = nil
+}
+
+// filter gets the reviews that match
+func (s *MemoryReviewStore) filter(match func(models.JSONReview) bool) []models.JSONReview {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reviews := make([]models.JSONReview, 0)
+	for _, review := range s.reviews {
+		if match(review) {
+			reviews = append(reviews, review)
+		}
+	}
+	return reviews
+}
+
+// listReviews gets a page of reviews, newest first like mongo with ids breaking ties
+func listReviews(reviews []models.JSONReview, page Page) ([]models.JSONReview, string, error) {
+	after, err := page.after(SortNewest)
+	if err != nil {
+		return make([]models.JSONReview, 0), "", err
+	}
+
+	sort.Slice(reviews, func(i, j int) bool {
+		return reviewCursor(reviews[i]).before(reviewCursor(reviews[j]))
+	})
+
+	// Start after the last review of the page before
+	if after != nil {
+		reviews = reviews[sort.Search(len(reviews), func(i int) bool {
+			return after.before(reviewCursor(reviews[i]))
+		}):]
+	}
+	reviews, next := nextReviewsPage(reviews, page.limit())
+	return reviews, next, nil
+}
+
+// MemoryUserStore keeps users in memory
+type MemoryUserStore struct {
+	mu    sync.Mutex
+	users []models.JSONUser
+}
+
+// NewMemoryUserStore creates an empty in-memory user store
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{}
+}
+
+func (s *MemoryUserStore) Get(ctx context.Context, id string) (models.JSONUser, error) {
+	return s.find(func(user models.JSONUser) bool {
+		return user.ID == id
+	})
+}
+
+func (s *MemoryUserStore) GetProfile(ctx context.Context, id string) (models.JSONUser, error) {
+	user, err := s.Get(ctx, id)
+	user.PasswordHash = nil
+	return user, err
+}
+
+func (s *MemoryUserStore) GetPublic(ctx context.Context, id string) (models.JSONUser, error) {
+	user, err := s.Get(ctx, id)
+	if err != nil {
+		return models.JSONUser{}, err
+	}
+	user.PasswordHash = nil
+	user.DateOfBirth = time.Time{}
+	user.PhoneNumber = ""
+	user.Roles = nil
+	user.EmailVerified = false
+	user.TwoFactorEnabled = false
+	user.Identities = nil
+	return user, nil
+}
+
+func (s *MemoryUserStore) GetByEmail(ctx context.Context, email string) (models.JSONUser, error) {
+	return s.find(func(user models.JSONUser) bool {
+		return user.Email == email
+	})
+}
+
+func (s *MemoryUserStore) GetByIdentity(ctx context.Context, provider string, subject string) (models.JSONUser, error) {
+	return s.find(func(user models.JSONUser) bool {
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (s *MemoryUserStore) Add(ctx context.Context, user models.JSONUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.users {
+		if existing.ID == user.ID {
+			return ErrDuplicateID
+		}
+		if existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+	}
+	s.users = append(s.users, copyUser(user))
+	return nil
+}
+
+func (s *MemoryUserStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i >= 0 {
+		s.users = append(s.users[:i], s.users[i+1:]...)
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) Update(ctx context.Context, id string, update UserUpdate) error {
+	return s.update(id, func(user *models.JSONUser) {
+		if update.NameFirst != nil {
+			user.NameFirst = *update.NameFirst
+		}
+		if update.NameLast != nil {
+			user.NameLast = *update.NameLast
+		}
+		if update.PhoneNumber != nil {
+			user.PhoneNumber = *update.PhoneNumber
+		}
+		if update.City != nil {
+			user.City = *update.City
+		}
+		if update.State != nil {
+			user.State = *update.State
+		}
+		if update.DateOfBirth != nil {
+			user.DateOfBirth = *update.DateOfBirth
+		}
+	})
+}
+
+func (s *MemoryUserStore) SetPicture(ctx context.Context, id string, picture models.JSONImageVariants) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.Picture = picture.Full
+		user.PictureVariants = picture
+	})
+}
+
+func (s *MemoryUserStore) SetEmail(ctx context.Context, id string, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.users {
+		if s.users[i].ID != id && s.users[i].Email == email {
+			return ErrDuplicateEmail
+		}
+	}
+	i := s.index(id)
+	if i >= 0 {
+		s.users[i].Email = email
+		s.users[i].EmailVerified = false
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) SetEmailVerified(ctx context.Context, id string, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || s.users[i].Email != email {
+		return false, nil
+	}
+	s.users[i].EmailVerified = true
+	return true, nil
+}
+
+func (s *MemoryUserStore) SetPassword(ctx context.Context, id string, passwordHash []byte, date time.Time) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.PasswordHash = append([]byte(nil), passwordHash...)
+		user.TokensRevokedAt = date
+	})
+}
+
+func (s *MemoryUserStore) AddFavorite(ctx context.Context, id string, foodTruckID string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.Favorites = addToSet(user.Favorites, foodTruckID)
+	})
+}
+
+func (s *MemoryUserStore) RemoveFavorite(ctx context.Context, id string, foodTruckID string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.Favorites = pull(user.Favorites, foodTruckID)
+	})
+}
+
+func (s *MemoryUserStore) AddReview(ctx context.Context, id string, reviewID string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.Reviews = append(user.Reviews, reviewID)
+	})
+}
+
+func (s *MemoryUserStore) AddOwnedFoodTruck(ctx context.Context, id string, foodTruckID string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.OwnedFoodTrucks = addToSet(user.OwnedFoodTrucks, foodTruckID)
+	})
+}
+
+func (s *MemoryUserStore) RemoveOwnedFoodTruck(ctx context.Context, id string, foodTruckID string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.OwnedFoodTrucks = pull(user.OwnedFoodTrucks, foodTruckID)
+	})
+}
+
+func (s *MemoryUserStore) AddRole(ctx context.Context, id string, role string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.Roles = addToSet(user.Roles, role)
+	})
+}
+
+func (s *MemoryUserStore) RemoveOwnerRole(ctx context.Context, id string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		if len(user.OwnedFoodTrucks) == 0 {
+			user.Roles = pull(user.Roles, models.RoleOwner)
+		}
+	})
+}
+
+func (s *MemoryUserStore) AddIdentity(ctx context.Context, id string, identity models.JSONIdentity) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.Identities = append(user.Identities, identity)
+	})
+}
+
+func (s *MemoryUserStore) SetPendingTOTPSecret(ctx context.Context, id string, secret string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.TOTPPendingSecret = secret
+	})
+}
+
+func (s *MemoryUserStore) EnableTwoFactor(ctx context.Context, id string, secret string, step int64, recoveryCodeHashes []string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.TwoFactorEnabled = true
+		user.TOTPSecret = secret
+		user.TOTPLastUsedStep = step
+		user.RecoveryCodes = copyStrings(recoveryCodeHashes)
+		user.TOTPPendingSecret = ""
+	})
+}
+
+func (s *MemoryUserStore) DisableTwoFactor(ctx context.Context, id string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.TwoFactorEnabled = false
+		user.TOTPLastUsedStep = 0
+		user.TOTPSecret = ""
+		user.TOTPPendingSecret = ""
+		user.RecoveryCodes = nil
+	})
+}
+
+func (s *MemoryUserStore) SetRecoveryCodes(ctx context.Context, id string, recoveryCodeHashes []string) error {
+	return s.update(id, func(user *models.JSONUser) {
+		user.RecoveryCodes = copyStrings(recoveryCodeHashes)
+	})
+}
+
+func (s *MemoryUserStore) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || !s.users[i].TwoFactorEnabled || s.users[i].TOTPLastUsedStep >= step {
+		return false, nil
+	}
+	s.users[i].TOTPLastUsedStep = step
+	return true, nil
+}
+
+func (s *MemoryUserStore) UseRecoveryCode(ctx context.Context, id string, recoveryCodeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || !s.users[i].TwoFactorEnabled || !containsString(s.users[i].RecoveryCodes, recoveryCodeHash) {
+		return false, nil
+	}
+	s.users[i].RecoveryCodes = pull(s.users[i].RecoveryCodes, recoveryCodeHash)
+	return true, nil
+}
+
+// Clear removes all users
+func (s *MemoryUserStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = nil
+}
+
+// find gets the first user that matches
+func (s *MemoryUserStore) find(match func(models.JSONUser) bool) (models.JSONUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if match(user) {
+			return copyUser(user), nil
+		}
+	}
+	return models.JSONUser{}, ErrNotFound
+}
+
+// index finds where the user with the id is, or -1 if there isn't one
+func (s *MemoryUserStore) index(id string) int {
+	for i, user := range s.users {
+		if user.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// update changes the user with the id, it isn't an error if there isn't one
+func (s *MemoryUserStore) update(id string, change func(*models.JSONUser)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i >= 0 {
+		change(&s.users[i])
+	}
+	return nil
+}
+
+// MemoryClaimStore keeps claims in memory, in the order they were added
+type MemoryClaimStore struct {
+	mu     sync.Mutex
+	claims []models.JSONClaim
+}
+
+// NewMemoryClaimStore creates an empty in-memory claim store
+func NewMemoryClaimStore() *MemoryClaimStore {
+	return &MemoryClaimStore{}
+}
+
+func (s *MemoryClaimStore) Get(ctx context.Context, id string) (models.JSONClaim, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.JSONClaim{}, ErrNotFound
+	}
+	return s.claims[i], nil
+}
+
+func (s *MemoryClaimStore) ListByStatus(ctx context.Context, status string) ([]models.JSONClaim, error) {
+	claims := s.filter(func(claim models.JSONClaim) bool {
+		return claim.Status == status
+	})
+	sort.SliceStable(claims, func(i, j int) bool {
+		return claims[i].Date.Before(claims[j].Date)
+	})
+	return claims, nil
+}
+
+func (s *MemoryClaimStore) ListByUser(ctx context.Context, userID string) ([]models.JSONClaim, error) {
+	return s.filter(func(claim models.JSONClaim) bool {
+		return claim.User == userID
+	}), nil
+}
+
+func (s *MemoryClaimStore) HasPending(ctx context.Context, foodTruckID string, userID string) (bool, error) {
+	claims := s.filter(func(claim models.JSONClaim) bool {
+		return claim.FoodTruck == foodTruckID && claim.User == userID && claim.Status == models.ClaimPending
+	})
+	return len(claims) > 0, nil
+}
+
+func (s *MemoryClaimStore) Add(ctx context.Context, claim models.JSONClaim) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index(claim.ID) >= 0 {
+		return ErrDuplicateID
+	}
+	s.claims = append(s.claims, claim)
+	return nil
+}
+
+func (s *MemoryClaimStore) UseAttempt(ctx context.Context, id string, userID string) (models.JSONClaim, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || s.claims[i].User != userID || s.claims[i].Status != models.ClaimPending || s.claims[i].Attempts >= models.MaxClaimAttempts {
+		return models.JSONClaim{}, ErrNotFound
+	}
+	claim := s.claims[i]
+	s.claims[i].Attempts++
+	return claim, nil
+}
+
+func (s *MemoryClaimStore) SetPhoneVerified(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i >= 0 {
+		s.claims[i].PhoneVerified = true
+	}
+	return nil
+}
+
+func (s *MemoryClaimStore) Review(ctx context.Context, id string, status string, reviewer string, reason string, date time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || s.claims[i].Status != models.ClaimPending {
+		return false, nil
+	}
+	reviewClaim(&s.claims[i], status, reviewer, reason, date)
+	return true, nil
+}
+
+func (s *MemoryClaimStore) SetPending(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i >= 0 {
+		s.claims[i].Status = models.ClaimPending
+		s.claims[i].Reviewer = ""
+		s.claims[i].Reason = ""
+	}
+	return nil
+}
+
+func (s *MemoryClaimStore) ListOtherPending(ctx context.Context, foodTruckID string, id string) ([]models.JSONClaim, error) {
+	return s.filter(func(claim models.JSONClaim) bool {
+		return claim.FoodTruck == foodTruckID && claim.ID != id && claim.Status == models.ClaimPending
+	}), nil
+}
+
+func (s *MemoryClaimStore) RejectByUser(ctx context.Context, userID string, reason string, date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.claims {
+		if s.claims[i].User == userID && s.claims[i].Status == models.ClaimPending {
+			reviewClaim(&s.claims[i], models.ClaimRejected, "", reason, date)
+		}
+	}
+	return nil
+}
+
+// Clear removes all claims
+func (s *MemoryClaimStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims = nil
+}
+
+// index finds where the claim with the id is, or -1 if there isn't one
+func (s *MemoryClaimStore) index(id string) int {
+	for i, claim := range s.claims {
+		if claim.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// filter gets the claims that match
+func (s *MemoryClaimStore) filter(match func(models.JSONClaim) bool) []models.JSONClaim {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claims := make([]models.JSONClaim, 0)
+	for _, claim := range s.claims {
+		if match(claim) {
+			claims = append(claims, claim)
+		}
+	}
+	return claims
+}
+
+// reviewClaim sets who reviewed the claim and what they decided
+func reviewClaim(claim *models.JSONClaim, status string, reviewer string, reason string, date time.Time) {
+	claim.Status = status
+	claim.Reviewer = reviewer
+	claim.Reason = reason
+	claim.ReviewedDate = date
+}
+
+// MemoryAPIKeyStore keeps api keys in memory, in the order they were added
+type MemoryAPIKeyStore struct {
+	mu      sync.Mutex
+	apiKeys []models.JSONAPIKey
+}
+
+// NewMemoryAPIKeyStore creates an empty in-memory api key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{}
+}
+
+func (s *MemoryAPIKeyStore) Get(ctx context.Context, id string) (models.JSONAPIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.JSONAPIKey{}, ErrNotFound
+	}
+	return copyAPIKey(s.apiKeys[i]), nil
+}
+
+func (s *MemoryAPIKeyStore) List(ctx context.Context) ([]models.JSONAPIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	apiKeys := make([]models.JSONAPIKey, 0, len(s.apiKeys))
+	for _, apiKey := range s.apiKeys {
+		apiKeys = append(apiKeys, copyAPIKey(apiKey))
+	}
+	sort.SliceStable(apiKeys, func(i, j int) bool {
+		return apiKeys[i].Created.After(apiKeys[j].Created)
+	})
+	return apiKeys, nil
+}
+
+func (s *MemoryAPIKeyStore) Add(ctx context.Context, apiKey models.JSONAPIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.apiKeys {
+		if existing.ID == apiKey.ID || existing.Hash == apiKey.Hash {
+			return ErrDuplicateID
+		}
+	}
+	s.apiKeys = append(s.apiKeys, copyAPIKey(apiKey))
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) Use(ctx context.Context, hash string, date time.Time) (models.JSONAPIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.apiKeys {
+		if s.apiKeys[i].Hash == hash && !s.apiKeys[i].Revoked {
+			apiKey := copyAPIKey(s.apiKeys[i])
+			s.apiKeys[i].UsageCount++
+			s.apiKeys[i].LastUsed = date
+			return apiKey, nil
+		}
+	}
+	return models.JSONAPIKey{}, ErrNotFound
+}
+
+func (s *MemoryAPIKeyStore) Revoke(ctx context.Context, id string, date time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return false, nil
+	}
+	s.apiKeys[i].Revoked = true
+	s.apiKeys[i].RevokedDate = date
+	return true, nil
+}
+
+// Clear removes all api keys
+func (s *MemoryAPIKeyStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKeys = nil
+}
+
+// index finds where the api key with the id is, or -1 if there isn't one
+func (s *MemoryAPIKeyStore) index(id string) int {
+	for i, apiKey := range s.apiKeys {
+		if apiKey.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// MemorySessionStore keeps sessions in memory, in the order they were started
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions []models.JSONSession
+}
+
+// NewMemorySessionStore creates an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{}
+}
+
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (models.JSONSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.JSONSession{}, ErrNotFound
+	}
+	return s.sessions[i], nil
+}
+
+func (s *MemorySessionStore) ListActive(ctx context.Context, userID string, now time.Time) ([]models.JSONSession, error) {
+	sessions := s.filter(func(session models.JSONSession) bool {
+		return session.User == userID && !session.Revoked && session.Expires.After(now)
+	})
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastUsed.After(sessions[j].LastUsed)
+	})
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) ListOthers(ctx context.Context, userID string, id string) ([]models.JSONSession, error) {
+	return s.filter(func(session models.JSONSession) bool {
+		return session.User == userID && session.ID != id
+	}), nil
+}
+
+func (s *MemorySessionStore) Use(ctx context.Context, id string, userID string, userAgent string, ip string, date time.Time, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		s.sessions = append(s.sessions, models.JSONSession{ID: id, User: userID, Created: date})
+		i = len(s.sessions) - 1
+	}
+	s.sessions[i].UserAgent = userAgent
+	s.sessions[i].IP = ip
+	s.sessions[i].LastUsed = date
+	s.sessions[i].Expires = expires
+	return nil
+}
+
+func (s *MemorySessionStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i >= 0 {
+		s.sessions[i].Revoked = true
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) RevokeByUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.sessions {
+		if s.sessions[i].User == userID {
+			s.sessions[i].Revoked = true
+		}
+	}
+	return nil
+}
+
+// Clear removes all sessions
+func (s *MemorySessionStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = nil
+}
+
+// index finds where the session with the id is, or -1 if there isn't one
+func (s *MemorySessionStore) index(id string) int {
+	for i, session := range s.sessions {
+		if session.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// filter gets the sessions that match
+func (s *MemorySessionStore) filter(match func(models.JSONSession) bool) []models.JSONSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]models.JSONSession, 0)
+	for _, session := range s.sessions {
+		if match(session) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// MemoryRefreshTokenStore keeps refresh tokens in memory, in the order they were added
+type MemoryRefreshTokenStore struct {
+	mu            sync.Mutex
+	refreshTokens []models.JSONRefreshToken
+}
+
+// NewMemoryRefreshTokenStore creates an empty in-memory refresh token store
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{}
+}
+
+func (s *MemoryRefreshTokenStore) Get(ctx context.Context, id string) (models.JSONRefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.JSONRefreshToken{}, ErrNotFound
+	}
+	return s.refreshTokens[i], nil
+}
+
+func (s *MemoryRefreshTokenStore) Add(ctx context.Context, refreshToken models.JSONRefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index(refreshToken.ID) >= 0 {
+		return ErrDuplicateID
+	}
+	s.refreshTokens = append(s.refreshTokens, refreshToken)
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) Use(ctx context.Context, id string, now time.Time) (models.JSONRefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 || s.refreshTokens[i].Used || s.refreshTokens[i].Revoked || !s.refreshTokens[i].Expires.After(now) {
+		return models.JSONRefreshToken{}, ErrNotFound
+	}
+	refreshToken := s.refreshTokens[i]
+	s.refreshTokens[i].Used = true
+	return refreshToken, nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, family string) error {
+	s.revoke(func(refreshToken models.JSONRefreshToken) bool {
+		return refreshToken.Family == family
+	})
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeByUser(ctx context.Context, userID string) error {
+	s.revoke(func(refreshToken models.JSONRefreshToken) bool {
+		return refreshToken.User == userID
+	})
+	return nil
+}
+
+// Clear removes all refresh tokens
+func (s *MemoryRefreshTokenStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens = nil
+}
+
+// index finds where the refresh token with the id is, or -1 if there isn't one
+func (s *MemoryRefreshTokenStore) index(id string) int {
+	for i, refreshToken := range s.refreshTokens {
+		if refreshToken.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// revoke revokes the refresh tokens that match
+func (s *MemoryRefreshTokenStore) revoke(match func(models.JSONRefreshToken) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.refreshTokens {
+		if match(s.refreshTokens[i]) {
+			s.refreshTokens[i].Revoked = true
+		}
+	}
+}
+
+// MemoryRevokedTokenStore keeps revoked access tokens in memory, they aren't removed once they expire
+type MemoryRevokedTokenStore struct {
+	mu            sync.Mutex
+	revokedTokens map[string]models.JSONRevokedToken
+}
+
+// NewMemoryRevokedTokenStore creates an empty in-memory revoked token store
+func NewMemoryRevokedTokenStore() *MemoryRevokedTokenStore {
+	return &MemoryRevokedTokenStore{revokedTokens: make(map[string]models.JSONRevokedToken)}
+}
+
+func (s *MemoryRevokedTokenStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, revoked := s.revokedTokens[id]
+	return revoked, nil
+}
+
+func (s *MemoryRevokedTokenStore) Add(ctx context.Context, revokedToken models.JSONRevokedToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.revokedTokens[revokedToken.ID]; exists {
+		return ErrDuplicateID
+	}
+	s.revokedTokens[revokedToken.ID] = revokedToken
+	return nil
+}
+
+// Clear removes all revoked tokens
+func (s *MemoryRevokedTokenStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokedTokens = make(map[string]models.JSONRevokedToken)
+}
+
+// MemoryUserTokenStore keeps emailed tokens in memory, in the order they were added
+type MemoryUserTokenStore struct {
+	mu         sync.Mutex
+	userTokens []models.JSONUserToken
+}
+
+// NewMemoryUserTokenStore creates an empty in-memory user token store
+func NewMemoryUserTokenStore() *MemoryUserTokenStore {
+	return &MemoryUserTokenStore{}
+}
+
+func (s *MemoryUserTokenStore) Get(ctx context.Context, id string) (models.JSONUserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.JSONUserToken{}, ErrNotFound
+	}
+	return s.userTokens[i], nil
+}
+
+func (s *MemoryUserTokenStore) GetUsable(ctx context.Context, id string, purpose string, now time.Time) (models.JSONUserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.usableIndex(id, purpose, now)
+	if i < 0 {
+		return models.JSONUserToken{}, ErrNotFound
+	}
+	return s.userTokens[i], nil
+}
+
+func (s *MemoryUserTokenStore) Add(ctx context.Context, userToken models.JSONUserToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index(userToken.ID) >= 0 {
+		return ErrDuplicateID
+	}
+	s.userTokens = append(s.userTokens, userToken)
+	return nil
+}
+
+func (s *MemoryUserTokenStore) Use(ctx context.Context, id string, purpose string, now time.Time) (models.JSONUserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.usableIndex(id, purpose, now)
+	if i < 0 {
+		return models.JSONUserToken{}, ErrNotFound
+	}
+	userToken := s.userTokens[i]
+	s.userTokens[i].Used = true
+	return userToken, nil
+}
+
+func (s *MemoryUserTokenStore) UseAll(ctx context.Context, userID string, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.userTokens {
+		if s.userTokens[i].User == userID && s.userTokens[i].Purpose == purpose {
+			s.userTokens[i].Used = true
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUserTokenStore) DeleteByUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userTokens := make([]models.JSONUserToken, 0, len(s.userTokens))
+	for _, userToken := range s.userTokens {
+		if userToken.User != userID {
+			userTokens = append(userTokens, userToken)
+		}
+	}
+	s.userTokens = userTokens
+	return nil
+}
+
+// Clear removes all user tokens
+func (s *MemoryUserTokenStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userTokens = nil
+}
+
+// index finds where the user token with the id is, or -1 if there isn't one
+func (s *MemoryUserTokenStore) index(id string) int {
+	for i, userToken := range s.userTokens {
+		if userToken.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// usableIndex finds where the unused and unexpired token with the id and purpose is, or -1 if there isn't one
+func (s *MemoryUserTokenStore) usableIndex(id string, purpose string, now time.Time) int {
+	i := s.index(id)
+	if i < 0 || s.userTokens[i].Purpose != purpose || s.userTokens[i].Used || !s.userTokens[i].Expires.After(now) {
+		return -1
+	}
+	return i
+}
+
+// MemoryLoginAttemptStore keeps failed login counts in memory, they aren't removed once they expire
+type MemoryLoginAttemptStore struct {
+	mu            sync.Mutex
+	loginAttempts map[string]models.JSONLoginAttempt
+}
+
+// NewMemoryLoginAttemptStore creates an empty in-memory login attempt store
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{loginAttempts: make(map[string]models.JSONLoginAttempt)}
+}
+
+func (s *MemoryLoginAttemptStore) Get(ctx context.Context, id string) (models.JSONLoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loginAttempt, exists := s.loginAttempts[id]
+	if !exists {
+		return models.JSONLoginAttempt{}, ErrNotFound
+	}
+	return loginAttempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) GetMany(ctx context.Context, ids []string) ([]models.JSONLoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loginAttempts := make([]models.JSONLoginAttempt, 0)
+	for _, id := range ids {
+		if loginAttempt, exists := s.loginAttempts[id]; exists {
+			loginAttempts = append(loginAttempts, loginAttempt)
+		}
+	}
+	return loginAttempts, nil
+}
+
+func (s *MemoryLoginAttemptStore) Add(ctx context.Context, loginAttempt models.JSONLoginAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.loginAttempts[loginAttempt.ID]; exists {
+		return ErrDuplicateID
+	}
+	s.loginAttempts[loginAttempt.ID] = loginAttempt
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(ctx context.Context, id string, date time.Time, expires time.Time) (models.JSONLoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loginAttempt := s.loginAttempts[id]
+	loginAttempt.ID = id
+	loginAttempt.Failures++
+	loginAttempt.LastFailure = date
+	loginAttempt.Expires = expires
+	s.loginAttempts[id] = loginAttempt
+	return loginAttempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) SetLockedUntil(ctx context.Context, id string, date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loginAttempt, exists := s.loginAttempts[id]; exists {
+		loginAttempt.LockedUntil = date
+		s.loginAttempts[id] = loginAttempt
+	}
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.loginAttempts, id)
+	return nil
+}
+
+// Clear removes all login attempts
+func (s *MemoryLoginAttemptStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginAttempts = make(map[string]models.JSONLoginAttempt)
+}
+
+// NewMemoryStores creates every store empty and in memory
+func NewMemoryStores() Stores {
+	return Stores{
+		FoodTrucks:    NewMemoryFoodTruckStore(),
+		Reviews:       NewMemoryReviewStore(),
+		Users:         NewMemoryUserStore(),
+		Claims:        NewMemoryClaimStore(),
+		APIKeys:       NewMemoryAPIKeyStore(),
+		Sessions:      NewMemorySessionStore(),
+		RefreshTokens: NewMemoryRefreshTokenStore(),
+		RevokedTokens: NewMemoryRevokedTokenStore(),
+		UserTokens:    NewMemoryUserTokenStore(),
+		LoginAttempts: NewMemoryLoginAttemptStore(),
+	}
+}
+
+// copyFoodTruck copies the food truck so changes to it don't change what is stored
+func copyFoodTruck(foodTruck models.JSONFoodTruck) models.JSONFoodTruck {
+	foodTruck.Reviews = copyStrings(foodTruck.Reviews)
+	foodTruck.Photos = copyPhotos(foodTruck.Photos)
+	foodTruck.Tags = copyStrings(foodTruck.Tags)
+	return foodTruck
+}
+
+// copyPhotos copies the photos along with their blob keys, keeping nil as nil
+func copyPhotos(photos []models.JSONPhoto) []models.JSONPhoto {
+	if photos == nil {
+		return nil
+	}
+	copied := make([]models.JSONPhoto, len(photos))
+	for i, photo := range photos {
+		photo.BlobKeys = copyStrings(photo.BlobKeys)
+		copied[i] = photo
+	}
+	return copied
+}
+
+// copyUser copies the user so changes to it don't change what is stored
+func copyUser(user models.JSONUser) models.JSONUser {
+	if user.PasswordHash != nil {
+		user.PasswordHash = append([]byte(nil), user.PasswordHash...)
+	}
+	user.Favorites = copyStrings(user.Favorites)
+	user.Reviews = copyStrings(user.Reviews)
+	user.OwnedFoodTrucks = copyStrings(user.OwnedFoodTrucks)
+	user.Roles = copyStrings(user.Roles)
+	user.RecoveryCodes = copyStrings(user.RecoveryCodes)
+	if user.Identities != nil {
+		user.Identities = append([]models.JSONIdentity{}, user.Identities...)
+	}
+	return user
+}
+
+// copyAPIKey copies the api key so changes to it don't change what is stored
+func copyAPIKey(apiKey models.JSONAPIKey) models.JSONAPIKey {
+	apiKey.Scopes = copyStrings(apiKey.Scopes)
+	return apiKey
+}
+
+// copyStrings copies the slice, keeping nil as nil
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(pattern *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTags reports whether values has every tag, or any of them, like mongo's $all and $in
+func hasTags(values []string, tags []string, any bool) bool {
+	for _, tag := range tags {
+		if containsString(values, tag) == any {
+			return any
+		}
+	}
+	return !any
+}
+
+// addToSet appends the value if it isn't already there, like mongo's $addToSet
+func addToSet(values []string, value string) []string {
+	if containsString(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// pull removes every copy of the value, like mongo's $pull
+func pull(values []string, value string) []string {
+	if values == nil {
+		return nil
+	}
+	pulled := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			pulled = append(pulled, v)
+		}
+	}
+	return pulled
+}
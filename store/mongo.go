@@ -0,0 +1,845 @@
+package store
+
+import (
+	"context"
+	"munchserver/dbutils"
+	"munchserver/models"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoFoodTruckStore keeps food trucks in the foodTrucks collection
+type MongoFoodTruckStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoFoodTruckStore creates a food truck store using the database
+func NewMongoFoodTruckStore(db *mongo.Database) *MongoFoodTruckStore {
+	return &MongoFoodTruckStore{collection: db.Collection("foodTrucks")}
+}
+
+func (s *MongoFoodTruckStore) Get(ctx context.Context, id string) (models.JSONFoodTruck, error) {
+	var foodTruck models.JSONFoodTruck
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&foodTruck)
+	return foodTruck, notFound(err)
+}
+
+func (s *MongoFoodTruckStore) GetMany(ctx context.Context, ids []string) ([]models.JSONFoodTruck, error) {
+	foodTrucks := make([]models.JSONFoodTruck, 0)
+	return foodTrucks, findAll(ctx, s.collection, dbutils.WithIDsQuery(ids), &foodTrucks)
+}
+
+func (s *MongoFoodTruckStore) List(ctx context.Context, query FoodTruckQuery, page Page) ([]FoodTruckWithDistance, string, error) {
+	foodTrucks := make([]FoodTruckWithDistance, 0)
+	sortBy := query.sortOrder()
+	after, err := page.after(sortBy)
+	if err != nil {
+		return foodTrucks, "", err
+	}
+
+	// $geoNear has to be the first stage, it filters food trucks as it finds their distance
+	filter := foodTruckFilter(query)
+	var pipeline mongo.Pipeline
+	if query.Near != nil {
+		geoNear := bson.M{
+			"near": bson.M{
+				"type":        "Point",
+				"coordinates": query.Near[:],
+			},
+			"distanceField": "distance",
+			"spherical":     true,
+			"query":         filter,
+		}
+		if query.MaxDistance != nil {
+			geoNear["maxDistance"] = *query.MaxDistance
+		}
+		pipeline = append(pipeline, bson.D{{"$geoNear", geoNear}})
+	} else {
+		pipeline = append(pipeline, bson.D{{"$match", filter}})
+	}
+
+	// Review counts aren't kept, so they are counted to sort by them
+	if sortBy == SortReviewCount {
+		pipeline = append(pipeline, bson.D{{"$addFields", dbutils.ReviewCountFields()}})
+	}
+
+	// Start after the last food truck of the page before, and get one more than the limit to tell if there is a next
+	// page
+	field := foodTruckSortFields[sortBy]
+	order := 1
+	if descending(sortBy) {
+		order = -1
+	}
+	if after != nil {
+		afterQuery := dbutils.AfterIDQuery(after.ID)
+		if order < 0 {
+			afterQuery = dbutils.BeforeQuery(field, after.value(), after.ID)
+		} else if field != "_id" {
+			afterQuery = dbutils.AfterQuery(field, after.value(), after.ID)
+		}
+		pipeline = append(pipeline, bson.D{{"$match", afterQuery}})
+	}
+	limit := page.limit()
+	pipeline = append(pipeline,
+		bson.D{{"$sort", dbutils.ByFieldSort(field, order)}},
+		bson.D{{"$limit", limit + 1}},
+	)
+
+	cur, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return foodTrucks, "", err
+	}
+	err = cur.All(ctx, &foodTrucks)
+	if err != nil {
+		return foodTrucks, "", err
+	}
+	foodTrucks, next := nextFoodTrucksPage(foodTrucks, limit, sortBy)
+	return foodTrucks, next, nil
+}
+
+func (s *MongoFoodTruckStore) ListByOwner(ctx context.Context, owner string) ([]models.JSONFoodTruck, error) {
+	foodTrucks := make([]models.JSONFoodTruck, 0)
+	return foodTrucks, findAll(ctx, s.collection, dbutils.WithOwnerQuery(owner), &foodTrucks)
+}
+
+func (s *MongoFoodTruckStore) Add(ctx context.Context, foodTruck models.JSONFoodTruck) error {
+	_, err := s.collection.InsertOne(ctx, foodTruck)
+	return err
+}
+
+func (s *MongoFoodTruckStore) Update(ctx context.Context, id string, update FoodTruckUpdate) error {
+	var updateData bson.D
+	if update.Name != nil {
+		updateData = append(updateData, bson.E{"name", *update.Name})
+	}
+	if update.Address != nil {
+		updateData = append(updateData, bson.E{"address", *update.Address})
+	}
+	if update.Location != nil {
+		updateData = append(updateData, bson.E{"location", *update.Location})
+	}
+	if update.Status != nil {
+		updateData = append(updateData, bson.E{"status", *update.Status})
+	}
+	if update.Hours != nil {
+		updateData = append(updateData, bson.E{"hours", *update.Hours})
+	}
+	if update.Website != nil {
+		updateData = append(updateData, bson.E{"website", *update.Website})
+	}
+	if update.PhoneNumber != nil {
+		updateData = append(updateData, bson.E{"phoneNumber", *update.PhoneNumber})
+	}
+	if update.Description != nil {
+		updateData = append(updateData, bson.E{"description", *update.Description})
+	}
+	if update.Tags != nil {
+		updateData = append(updateData, bson.E{"tags", update.Tags})
+	}
+	return setFields(ctx, s.collection, id, updateData)
+}
+
+func (s *MongoFoodTruckStore) AddReview(ctx context.Context, id string, reviewID string, avgRating float64) error {
+	return updateOne(ctx, s.collection, id, dbutils.UpdateFoodTruckWithReview(avgRating, reviewID))
+}
+
+func (s *MongoFoodTruckStore) AddPhoto(ctx context.Context, id string, photo models.JSONPhoto) error {
+	return updateOne(ctx, s.collection, id, dbutils.PushPhoto(photo))
+}
+
+func (s *MongoFoodTruckStore) ReplacePhotos(ctx context.Context, id string, oldPhotos []models.JSONPhoto, photos []models.JSONPhoto) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx, dbutils.WithIDAndPhotosQuery(id, oldPhotos), dbutils.SetPhotos(photos))
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (s *MongoFoodTruckStore) ReplaceOwner(ctx context.Context, id string, oldOwner string, newOwner string) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx, dbutils.WithIDAndOwnerQuery(id, oldOwner), dbutils.SetFoodTruckOwner(newOwner))
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (s *MongoFoodTruckStore) ClearOwner(ctx context.Context, owner string) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithOwnerQuery(owner), dbutils.SetFoodTruckOwner(""))
+	return err
+}
+
+// MigratePhotos turns photos kept as urls, from before photos had their own fields, into photos. Uploaded photos
+// keep their resized copies, and where they are in the blob store so they can still be deleted.
+func (s *MongoFoodTruckStore) MigratePhotos(ctx context.Context) error {
+	cur, err := s.collection.Find(ctx, dbutils.WithURLPhotosQuery())
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var foodTruck struct {
+			ID            string                     `bson:"_id"`
+			Photos        []string                   `bson:"photos"`
+			PhotoVariants []models.JSONImageVariants `bson:"photoVariants"`
+		}
+		err = cur.Decode(&foodTruck)
+		if err != nil {
+			return err
+		}
+
+		photos := make([]models.JSONPhoto, len(foodTruck.Photos))
+		for i, url := range foodTruck.Photos {
+			photoID, err := uuid.NewRandom()
+			if err != nil {
+				return err
+			}
+			photos[i] = models.JSONPhoto{ID: photoID.String(), URL: url, Cover: i == 0, Order: i}
+			for _, variants := range foodTruck.PhotoVariants {
+				if variants.Full == url {
+					photos[i].Variants = variants
+					photos[i].BlobKeys = []string{path.Base(variants.Thumbnail), path.Base(variants.Card), path.Base(variants.Full)}
+				}
+			}
+		}
+
+		err = updateOne(ctx, s.collection, foodTruck.ID, dbutils.SetMigratedPhotos(photos))
+		if err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// MigrateCreated dates food trucks added before they were dated with the zero time, so they are listed as the oldest
+func (s *MongoFoodTruckStore) MigrateCreated(ctx context.Context) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithoutCreatedQuery(), dbutils.SetCreated(time.Time{}))
+	return err
+}
+
+// foodTruckSortFields are the fields food trucks are sorted by in each order
+var foodTruckSortFields = map[string]string{
+	sortID:          "_id",
+	SortDistance:    "distance",
+	SortRating:      "avgRating",
+	SortReviewCount: "reviewCount",
+	SortName:        "name",
+	SortNewest:      "created",
+}
+
+// foodTruckFilter matches the food trucks the query lists, other than how far they are
+func foodTruckFilter(query FoodTruckQuery) bson.M {
+	filter := dbutils.AllQuery()
+	if query.Text != "" {
+		pattern := textPattern(query.Text)
+		filter["$or"] = []interface{}{
+			bson.M{"tags": bson.M{"$regex": pattern}},
+			bson.M{"name": bson.M{"$regex": pattern}},
+		}
+	}
+	if query.MinRating != nil {
+		filter["avgRating"] = bson.M{"$gte": *query.MinRating}
+	}
+	if len(query.Tags) > 0 && query.AnyTag {
+		filter["tags"] = bson.M{"$in": query.Tags}
+	} else if len(query.Tags) > 0 {
+		filter["tags"] = bson.M{"$all": query.Tags}
+	}
+	if query.Status != nil {
+		filter["status"] = *query.Status
+	}
+	if query.Claimed != nil && *query.Claimed {
+		filter["owner"] = bson.M{"$nin": []interface{}{"", nil}}
+	} else if query.Claimed != nil {
+		filter["owner"] = bson.M{"$in": []interface{}{"", nil}}
+	}
+	return filter
+}
+
+// MongoReviewStore keeps reviews in the reviews collection
+type MongoReviewStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoReviewStore creates a review store using the database
+func NewMongoReviewStore(db *mongo.Database) *MongoReviewStore {
+	return &MongoReviewStore{collection: db.Collection("reviews")}
+}
+
+func (s *MongoReviewStore) Get(ctx context.Context, id string) (models.JSONReview, error) {
+	var review models.JSONReview
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&review)
+	return review, notFound(err)
+}
+
+func (s *MongoReviewStore) GetMany(ctx context.Context, ids []string) ([]models.JSONReview, error) {
+	reviews := make([]models.JSONReview, 0)
+	return reviews, findAll(ctx, s.collection, dbutils.WithIDsQuery(ids), &reviews)
+}
+
+func (s *MongoReviewStore) List(ctx context.Context, page Page) ([]models.JSONReview, string, error) {
+	return s.list(ctx, dbutils.AllQuery(), page)
+}
+
+func (s *MongoReviewStore) ListByFoodTruck(ctx context.Context, foodTruckID string, page Page) ([]models.JSONReview, string, error) {
+	return s.list(ctx, dbutils.WithFoodTruckQuery(foodTruckID), page)
+}
+
+func (s *MongoReviewStore) ListByReviewer(ctx context.Context, reviewer string) ([]models.JSONReview, error) {
+	reviews := make([]models.JSONReview, 0)
+	return reviews, findAll(ctx, s.collection, dbutils.WithReviewerQuery(reviewer), &reviews)
+}
+
+func (s *MongoReviewStore) Add(ctx context.Context, review models.JSONReview) error {
+	_, err := s.collection.InsertOne(ctx, review)
+	return err
+}
+
+// list gets a page of the reviews matching the filter, newest first
+func (s *MongoReviewStore) list(ctx context.Context, filter bson.M, page Page) ([]models.JSONReview, string, error) {
+	reviews := make([]models.JSONReview, 0)
+	after, err := page.after(SortNewest)
+	if err != nil {
+		return reviews, "", err
+	}
+	if after != nil {
+		filter = dbutils.AndQuery(filter, dbutils.BeforeQuery("date", after.Time, after.ID))
+	}
+
+	// Get one more than the limit to tell if there is a next page
+	limit := page.limit()
+	cur, err := s.collection.Find(ctx, filter, dbutils.OptionsWithSortAndLimit(dbutils.NewestSort(), limit+1))
+	if err != nil {
+		return reviews, "", err
+	}
+	err = cur.All(ctx, &reviews)
+	if err != nil {
+		return reviews, "", err
+	}
+	reviews, next := nextReviewsPage(reviews, limit)
+	return reviews, next, nil
+}
+
+func (s *MongoReviewStore) SetReviewer(ctx context.Context, oldReviewer string, reviewer string, reviewerName string) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithReviewerQuery(oldReviewer), dbutils.SetReviewer(reviewer, reviewerName))
+	return err
+}
+
+// MongoUserStore keeps users in the users collection
+type MongoUserStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserStore creates a user store using the database
+func NewMongoUserStore(db *mongo.Database) *MongoUserStore {
+	return &MongoUserStore{collection: db.Collection("users")}
+}
+
+func (s *MongoUserStore) Get(ctx context.Context, id string) (models.JSONUser, error) {
+	return s.findOne(ctx, dbutils.WithIDQuery(id), nil)
+}
+
+func (s *MongoUserStore) GetProfile(ctx context.Context, id string) (models.JSONUser, error) {
+	return s.findOne(ctx, dbutils.WithIDQuery(id), dbutils.ProfileProjection())
+}
+
+func (s *MongoUserStore) GetPublic(ctx context.Context, id string) (models.JSONUser, error) {
+	return s.findOne(ctx, dbutils.WithIDQuery(id), dbutils.UserProjection())
+}
+
+func (s *MongoUserStore) GetByEmail(ctx context.Context, email string) (models.JSONUser, error) {
+	return s.findOne(ctx, dbutils.WithEmailQuery(email), nil)
+}
+
+func (s *MongoUserStore) GetByIdentity(ctx context.Context, provider string, subject string) (models.JSONUser, error) {
+	return s.findOne(ctx, dbutils.WithIdentityQuery(provider, subject), nil)
+}
+
+func (s *MongoUserStore) Add(ctx context.Context, user models.JSONUser) error {
+	_, err := s.collection.InsertOne(ctx, user)
+	return duplicateEmail(err)
+}
+
+func (s *MongoUserStore) Delete(ctx context.Context, id string) error {
+	_, err := s.collection.DeleteOne(ctx, dbutils.WithIDQuery(id))
+	return err
+}
+
+func (s *MongoUserStore) Update(ctx context.Context, id string, update UserUpdate) error {
+	var updateData bson.D
+	if update.NameFirst != nil {
+		updateData = append(updateData, bson.E{"firstName", *update.NameFirst})
+	}
+	if update.NameLast != nil {
+		updateData = append(updateData, bson.E{"lastName", *update.NameLast})
+	}
+	if update.PhoneNumber != nil {
+		updateData = append(updateData, bson.E{"phoneNumber", *update.PhoneNumber})
+	}
+	if update.City != nil {
+		updateData = append(updateData, bson.E{"city", *update.City})
+	}
+	if update.State != nil {
+		updateData = append(updateData, bson.E{"state", *update.State})
+	}
+	if update.DateOfBirth != nil {
+		updateData = append(updateData, bson.E{"dateOfBirth", *update.DateOfBirth})
+	}
+	return setFields(ctx, s.collection, id, updateData)
+}
+
+func (s *MongoUserStore) SetPicture(ctx context.Context, id string, picture models.JSONImageVariants) error {
+	return updateOne(ctx, s.collection, id, dbutils.SetProfilePicture(picture))
+}
+
+func (s *MongoUserStore) SetEmail(ctx context.Context, id string, email string) error {
+	return duplicateEmail(updateOne(ctx, s.collection, id, dbutils.SetEmail(email)))
+}
+
+func (s *MongoUserStore) SetEmailVerified(ctx context.Context, id string, email string) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx, dbutils.WithIDAndEmailQuery(id, email), dbutils.SetEmailVerified())
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (s *MongoUserStore) SetPassword(ctx context.Context, id string, passwordHash []byte, date time.Time) error {
+	return updateOne(ctx, s.collection, id, dbutils.SetPassword(passwordHash, date))
+}
+
+func (s *MongoUserStore) AddFavorite(ctx context.Context, id string, foodTruckID string) error {
+	return updateOne(ctx, s.collection, id, bson.M{"$addToSet": bson.M{"favorites": foodTruckID}})
+}
+
+func (s *MongoUserStore) RemoveFavorite(ctx context.Context, id string, foodTruckID string) error {
+	return updateOne(ctx, s.collection, id, bson.M{"$pull": bson.M{"favorites": foodTruckID}})
+}
+
+func (s *MongoUserStore) AddReview(ctx context.Context, id string, reviewID string) error {
+	return updateOne(ctx, s.collection, id, dbutils.PushReview(reviewID))
+}
+
+func (s *MongoUserStore) AddOwnedFoodTruck(ctx context.Context, id string, foodTruckID string) error {
+	return updateOne(ctx, s.collection, id, dbutils.AddOwnedFoodTruck(foodTruckID))
+}
+
+func (s *MongoUserStore) RemoveOwnedFoodTruck(ctx context.Context, id string, foodTruckID string) error {
+	return updateOne(ctx, s.collection, id, dbutils.PullOwnedFoodTruck(foodTruckID))
+}
+
+func (s *MongoUserStore) AddRole(ctx context.Context, id string, role string) error {
+	return updateOne(ctx, s.collection, id, dbutils.AddRole(role))
+}
+
+func (s *MongoUserStore) RemoveOwnerRole(ctx context.Context, id string) error {
+	_, err := s.collection.UpdateOne(ctx, dbutils.WithIDAndNoOwnedFoodTrucksQuery(id), dbutils.PullRole(models.RoleOwner))
+	return err
+}
+
+func (s *MongoUserStore) AddIdentity(ctx context.Context, id string, identity models.JSONIdentity) error {
+	return updateOne(ctx, s.collection, id, dbutils.PushIdentity(identity))
+}
+
+func (s *MongoUserStore) SetPendingTOTPSecret(ctx context.Context, id string, secret string) error {
+	return updateOne(ctx, s.collection, id, dbutils.SetPendingTOTPSecret(secret))
+}
+
+func (s *MongoUserStore) EnableTwoFactor(ctx context.Context, id string, secret string, step int64, recoveryCodeHashes []string) error {
+	return updateOne(ctx, s.collection, id, dbutils.EnableTwoFactor(secret, step, recoveryCodeHashes))
+}
+
+func (s *MongoUserStore) DisableTwoFactor(ctx context.Context, id string) error {
+	return updateOne(ctx, s.collection, id, dbutils.DisableTwoFactor())
+}
+
+func (s *MongoUserStore) SetRecoveryCodes(ctx context.Context, id string, recoveryCodeHashes []string) error {
+	return updateOne(ctx, s.collection, id, dbutils.SetRecoveryCodes(recoveryCodeHashes))
+}
+
+func (s *MongoUserStore) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx, dbutils.UnusedTOTPStepQuery(id, step), dbutils.UseTOTPStep(step))
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (s *MongoUserStore) UseRecoveryCode(ctx context.Context, id string, recoveryCodeHash string) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx, dbutils.WithIDAndRecoveryCodeQuery(id, recoveryCodeHash), dbutils.PullRecoveryCode(recoveryCodeHash))
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// MigrateEmailVerified marks users who registered before emails were verified as verified, so they can keep adding
+// reviews and claiming food trucks
+func (s *MongoUserStore) MigrateEmailVerified(ctx context.Context) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithoutEmailVerifiedQuery(), dbutils.SetEmailVerified())
+	return err
+}
+
+// findOne finds a user, leaving out fields with the projection if there is one
+func (s *MongoUserStore) findOne(ctx context.Context, filter bson.M, projection bson.M) (models.JSONUser, error) {
+	var user models.JSONUser
+	var opts []*options.FindOneOptions
+	if projection != nil {
+		opts = append(opts, dbutils.OptionsWithProjection(projection))
+	}
+	err := s.collection.FindOne(ctx, filter, opts...).Decode(&user)
+	return user, notFound(err)
+}
+
+// MongoClaimStore keeps claims in the claims collection
+type MongoClaimStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoClaimStore creates a claim store using the database
+func NewMongoClaimStore(db *mongo.Database) *MongoClaimStore {
+	return &MongoClaimStore{collection: db.Collection("claims")}
+}
+
+func (s *MongoClaimStore) Get(ctx context.Context, id string) (models.JSONClaim, error) {
+	var claim models.JSONClaim
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&claim)
+	return claim, notFound(err)
+}
+
+func (s *MongoClaimStore) ListByStatus(ctx context.Context, status string) ([]models.JSONClaim, error) {
+	claims := make([]models.JSONClaim, 0)
+	return claims, findAll(ctx, s.collection, dbutils.WithStatusQuery(status), &claims, dbutils.OptionsWithSort(dbutils.ByFieldSort("date", 1)))
+}
+
+func (s *MongoClaimStore) ListByUser(ctx context.Context, userID string) ([]models.JSONClaim, error) {
+	claims := make([]models.JSONClaim, 0)
+	return claims, findAll(ctx, s.collection, dbutils.WithUserQuery(userID), &claims)
+}
+
+func (s *MongoClaimStore) HasPending(ctx context.Context, foodTruckID string, userID string) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, dbutils.ClaimOfUserQuery(foodTruckID, userID, models.ClaimPending))
+	return count > 0, err
+}
+
+func (s *MongoClaimStore) Add(ctx context.Context, claim models.JSONClaim) error {
+	_, err := s.collection.InsertOne(ctx, claim)
+	return err
+}
+
+func (s *MongoClaimStore) UseAttempt(ctx context.Context, id string, userID string) (models.JSONClaim, error) {
+	var claim models.JSONClaim
+	err := s.collection.FindOneAndUpdate(ctx,
+		dbutils.ClaimAttemptQuery(id, userID, models.ClaimPending, models.MaxClaimAttempts),
+		dbutils.IncrementClaimAttempts()).Decode(&claim)
+	return claim, notFound(err)
+}
+
+func (s *MongoClaimStore) SetPhoneVerified(ctx context.Context, id string) error {
+	return updateOne(ctx, s.collection, id, dbutils.SetClaimPhoneVerified())
+}
+
+func (s *MongoClaimStore) Review(ctx context.Context, id string, status string, reviewer string, reason string, date time.Time) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx, dbutils.WithIDAndStatusQuery(id, models.ClaimPending), dbutils.SetClaimReviewed(status, reviewer, reason, date))
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (s *MongoClaimStore) SetPending(ctx context.Context, id string) error {
+	return updateOne(ctx, s.collection, id, dbutils.SetClaimStatus(models.ClaimPending))
+}
+
+func (s *MongoClaimStore) ListOtherPending(ctx context.Context, foodTruckID string, id string) ([]models.JSONClaim, error) {
+	claims := make([]models.JSONClaim, 0)
+	return claims, findAll(ctx, s.collection, dbutils.OtherClaimsQuery(foodTruckID, id, models.ClaimPending), &claims)
+}
+
+func (s *MongoClaimStore) RejectByUser(ctx context.Context, userID string, reason string, date time.Time) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithUserAndStatusQuery(userID, models.ClaimPending), dbutils.SetClaimReviewed(models.ClaimRejected, "", reason, date))
+	return err
+}
+
+// MongoAPIKeyStore keeps api keys in the apiKeys collection
+type MongoAPIKeyStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAPIKeyStore creates an api key store using the database
+func NewMongoAPIKeyStore(db *mongo.Database) *MongoAPIKeyStore {
+	return &MongoAPIKeyStore{collection: db.Collection("apiKeys")}
+}
+
+func (s *MongoAPIKeyStore) Get(ctx context.Context, id string) (models.JSONAPIKey, error) {
+	var apiKey models.JSONAPIKey
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&apiKey)
+	return apiKey, notFound(err)
+}
+
+func (s *MongoAPIKeyStore) List(ctx context.Context) ([]models.JSONAPIKey, error) {
+	apiKeys := make([]models.JSONAPIKey, 0)
+	return apiKeys, findAll(ctx, s.collection, dbutils.AllQuery(), &apiKeys, dbutils.OptionsWithSort(dbutils.ByFieldSort("created", -1)))
+}
+
+func (s *MongoAPIKeyStore) Add(ctx context.Context, apiKey models.JSONAPIKey) error {
+	_, err := s.collection.InsertOne(ctx, apiKey)
+	return err
+}
+
+func (s *MongoAPIKeyStore) Use(ctx context.Context, hash string, date time.Time) (models.JSONAPIKey, error) {
+	var apiKey models.JSONAPIKey
+	err := s.collection.FindOneAndUpdate(ctx, dbutils.ActiveAPIKeyQuery(hash), dbutils.UseAPIKey(date)).Decode(&apiKey)
+	return apiKey, notFound(err)
+}
+
+func (s *MongoAPIKeyStore) Revoke(ctx context.Context, id string, date time.Time) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx, dbutils.WithIDQuery(id), dbutils.RevokeAPIKey(date))
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// MongoSessionStore keeps sessions in the sessions collection
+type MongoSessionStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionStore creates a session store using the database
+func NewMongoSessionStore(db *mongo.Database) *MongoSessionStore {
+	return &MongoSessionStore{collection: db.Collection("sessions")}
+}
+
+func (s *MongoSessionStore) Get(ctx context.Context, id string) (models.JSONSession, error) {
+	var session models.JSONSession
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&session)
+	return session, notFound(err)
+}
+
+func (s *MongoSessionStore) ListActive(ctx context.Context, userID string, now time.Time) ([]models.JSONSession, error) {
+	sessions := make([]models.JSONSession, 0)
+	return sessions, findAll(ctx, s.collection, dbutils.ActiveSessionsQuery(userID, now), &sessions, dbutils.OptionsWithSort(dbutils.ByFieldSort("lastUsed", -1)))
+}
+
+func (s *MongoSessionStore) ListOthers(ctx context.Context, userID string, id string) ([]models.JSONSession, error) {
+	sessions := make([]models.JSONSession, 0)
+	return sessions, findAll(ctx, s.collection, dbutils.OtherSessionsQuery(userID, id), &sessions)
+}
+
+func (s *MongoSessionStore) Use(ctx context.Context, id string, userID string, userAgent string, ip string, date time.Time, expires time.Time) error {
+	_, err := s.collection.UpdateOne(ctx, dbutils.WithIDQuery(id), dbutils.UseSession(userID, userAgent, ip, date, expires), options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoSessionStore) Revoke(ctx context.Context, id string) error {
+	return updateOne(ctx, s.collection, id, dbutils.RevokeSession())
+}
+
+func (s *MongoSessionStore) RevokeByUser(ctx context.Context, userID string) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithUserQuery(userID), dbutils.RevokeSession())
+	return err
+}
+
+// MongoRefreshTokenStore keeps refresh tokens in the refreshTokens collection
+type MongoRefreshTokenStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRefreshTokenStore creates a refresh token store using the database
+func NewMongoRefreshTokenStore(db *mongo.Database) *MongoRefreshTokenStore {
+	return &MongoRefreshTokenStore{collection: db.Collection("refreshTokens")}
+}
+
+func (s *MongoRefreshTokenStore) Get(ctx context.Context, id string) (models.JSONRefreshToken, error) {
+	var refreshToken models.JSONRefreshToken
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&refreshToken)
+	return refreshToken, notFound(err)
+}
+
+func (s *MongoRefreshTokenStore) Add(ctx context.Context, refreshToken models.JSONRefreshToken) error {
+	_, err := s.collection.InsertOne(ctx, refreshToken)
+	return err
+}
+
+func (s *MongoRefreshTokenStore) Use(ctx context.Context, id string, now time.Time) (models.JSONRefreshToken, error) {
+	var refreshToken models.JSONRefreshToken
+	err := s.collection.FindOneAndUpdate(ctx, dbutils.UsableRefreshTokenQuery(id, now), dbutils.UseRefreshToken()).Decode(&refreshToken)
+	return refreshToken, notFound(err)
+}
+
+func (s *MongoRefreshTokenStore) RevokeFamily(ctx context.Context, family string) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithFamilyQuery(family), dbutils.RevokeRefreshToken())
+	return err
+}
+
+func (s *MongoRefreshTokenStore) RevokeByUser(ctx context.Context, userID string) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.WithUserQuery(userID), dbutils.RevokeRefreshToken())
+	return err
+}
+
+// MongoRevokedTokenStore keeps revoked access tokens in the revokedTokens collection
+type MongoRevokedTokenStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRevokedTokenStore creates a revoked token store using the database
+func NewMongoRevokedTokenStore(db *mongo.Database) *MongoRevokedTokenStore {
+	return &MongoRevokedTokenStore{collection: db.Collection("revokedTokens")}
+}
+
+func (s *MongoRevokedTokenStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, dbutils.WithIDQuery(id))
+	return count > 0, err
+}
+
+func (s *MongoRevokedTokenStore) Add(ctx context.Context, revokedToken models.JSONRevokedToken) error {
+	_, err := s.collection.InsertOne(ctx, revokedToken)
+	return err
+}
+
+// MongoUserTokenStore keeps emailed tokens in the userTokens collection
+type MongoUserTokenStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserTokenStore creates a user token store using the database
+func NewMongoUserTokenStore(db *mongo.Database) *MongoUserTokenStore {
+	return &MongoUserTokenStore{collection: db.Collection("userTokens")}
+}
+
+func (s *MongoUserTokenStore) Get(ctx context.Context, id string) (models.JSONUserToken, error) {
+	var userToken models.JSONUserToken
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&userToken)
+	return userToken, notFound(err)
+}
+
+func (s *MongoUserTokenStore) GetUsable(ctx context.Context, id string, purpose string, now time.Time) (models.JSONUserToken, error) {
+	var userToken models.JSONUserToken
+	err := s.collection.FindOne(ctx, dbutils.UsableUserTokenQuery(id, purpose, now)).Decode(&userToken)
+	return userToken, notFound(err)
+}
+
+func (s *MongoUserTokenStore) Add(ctx context.Context, userToken models.JSONUserToken) error {
+	_, err := s.collection.InsertOne(ctx, userToken)
+	return err
+}
+
+func (s *MongoUserTokenStore) Use(ctx context.Context, id string, purpose string, now time.Time) (models.JSONUserToken, error) {
+	var userToken models.JSONUserToken
+	err := s.collection.FindOneAndUpdate(ctx, dbutils.UsableUserTokenQuery(id, purpose, now), dbutils.UseUserToken()).Decode(&userToken)
+	return userToken, notFound(err)
+}
+
+func (s *MongoUserTokenStore) UseAll(ctx context.Context, userID string, purpose string) error {
+	_, err := s.collection.UpdateMany(ctx, dbutils.UnusedUserTokensQuery(userID, purpose), dbutils.UseUserToken())
+	return err
+}
+
+func (s *MongoUserTokenStore) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := s.collection.DeleteMany(ctx, dbutils.WithUserQuery(userID))
+	return err
+}
+
+// MongoLoginAttemptStore keeps failed login counts in the loginAttempts collection
+type MongoLoginAttemptStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLoginAttemptStore creates a login attempt store using the database
+func NewMongoLoginAttemptStore(db *mongo.Database) *MongoLoginAttemptStore {
+	return &MongoLoginAttemptStore{collection: db.Collection("loginAttempts")}
+}
+
+func (s *MongoLoginAttemptStore) Get(ctx context.Context, id string) (models.JSONLoginAttempt, error) {
+	var loginAttempt models.JSONLoginAttempt
+	err := s.collection.FindOne(ctx, dbutils.WithIDQuery(id)).Decode(&loginAttempt)
+	return loginAttempt, notFound(err)
+}
+
+func (s *MongoLoginAttemptStore) GetMany(ctx context.Context, ids []string) ([]models.JSONLoginAttempt, error) {
+	loginAttempts := make([]models.JSONLoginAttempt, 0)
+	return loginAttempts, findAll(ctx, s.collection, dbutils.WithIDsQuery(ids), &loginAttempts)
+}
+
+func (s *MongoLoginAttemptStore) Add(ctx context.Context, loginAttempt models.JSONLoginAttempt) error {
+	_, err := s.collection.InsertOne(ctx, loginAttempt)
+	return err
+}
+
+func (s *MongoLoginAttemptStore) RecordFailure(ctx context.Context, id string, date time.Time, expires time.Time) (models.JSONLoginAttempt, error) {
+	// The count is updated atomically so every server agrees on it
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var loginAttempt models.JSONLoginAttempt
+	err := s.collection.FindOneAndUpdate(ctx, dbutils.WithIDQuery(id), dbutils.RecordLoginFailure(date, expires), findOptions).Decode(&loginAttempt)
+	return loginAttempt, err
+}
+
+func (s *MongoLoginAttemptStore) SetLockedUntil(ctx context.Context, id string, date time.Time) error {
+	return updateOne(ctx, s.collection, id, dbutils.SetLockedUntil(date))
+}
+
+func (s *MongoLoginAttemptStore) Delete(ctx context.Context, id string) error {
+	_, err := s.collection.DeleteOne(ctx, dbutils.WithIDQuery(id))
+	return err
+}
+
+// NewMongoStores creates every store using the database
+func NewMongoStores(db *mongo.Database) Stores {
+	return Stores{
+		FoodTrucks:    NewMongoFoodTruckStore(db),
+		Reviews:       NewMongoReviewStore(db),
+		Users:         NewMongoUserStore(db),
+		Claims:        NewMongoClaimStore(db),
+		APIKeys:       NewMongoAPIKeyStore(db),
+		Sessions:      NewMongoSessionStore(db),
+		RefreshTokens: NewMongoRefreshTokenStore(db),
+		RevokedTokens: NewMongoRevokedTokenStore(db),
+		UserTokens:    NewMongoUserTokenStore(db),
+		LoginAttempts: NewMongoLoginAttemptStore(db),
+	}
+}
+
+// findAll decodes everything matching the filter into results
+func findAll(ctx context.Context, collection *mongo.Collection, filter interface{}, results interface{}, opts ...*options.FindOptions) error {
+	cur, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	return cur.All(ctx, results)
+}
+
+// updateOne updates the document with the id, it isn't an error if there isn't one
+func updateOne(ctx context.Context, collection *mongo.Collection, id string, update interface{}) error {
+	_, err := collection.UpdateOne(ctx, dbutils.WithIDQuery(id), update)
+	return err
+}
+
+// setFields sets the fields of the document with the id, mongo rejects an empty $set so nothing is done without fields
+func setFields(ctx context.Context, collection *mongo.Collection, id string, fields bson.D) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return updateOne(ctx, collection, id, bson.D{{"$set", fields}})
+}
+
+// notFound converts mongo's no documents error to ErrNotFound
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// duplicateEmail converts a unique index error to ErrDuplicateEmail, email is the only unique field of users
+func duplicateEmail(err error) error {
+	if isDuplicateKeyError(err) {
+		return ErrDuplicateEmail
+	}
+	return err
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"munchserver/models"
+	"munchserver/secrets"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newTestDatabase connects to the MongoDB at MONGODB_URI and creates a database with the indexes for one test, call the
+// returned func to drop the database. The test is skipped when MONGODB_URI isn't set.
+func newTestDatabase(t *testing.T) (*mongo.Database, func()) {
+	if _, exists := os.LookupEnv("MONGODB_URI"); !exists {
+		t.Skip("MONGODB_URI is not set")
+	}
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(secrets.GetMongoURI()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := uuid.NewRandom()
+	db := client.Database(secrets.GetTestMongoDBName() + "_" + id.String()[:8])
+	drop := func() {
+		_ = db.Drop(context.TODO())
+		_ = client.Disconnect(context.TODO())
+	}
+	err = CreateIndexes(context.TODO(), db)
+	if err != nil {
+		drop()
+		t.Fatal(err)
+	}
+	return db, drop
+}
+
+func TestMongoFoodTruckListPages(t *testing.T) {
+	db, drop := newTestDatabase(t)
+	defer drop()
+	foodTrucks := NewMongoFoodTruckStore(db)
+	ratings := []float64{3, 5, 3, 4, 3}
+	for i, rating := range ratings {
+		err := foodTrucks.Add(context.TODO(), models.JSONFoodTruck{
+			ID:        fmt.Sprintf("foodtruck%v", i),
+			AvgRating: rating,
+			Location:  [2]float64{-97.7431, 30.2672},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ties are broken by id, so pages don't skip or repeat food trucks with the same rating
+	expected := []string{"foodtruck1", "foodtruck3", "foodtruck0", "foodtruck2", "foodtruck4"}
+	var listed []string
+	page := Page{Limit: 2}
+	for {
+		items, next, err := foodTrucks.List(context.TODO(), FoodTruckQuery{Sort: SortRating}, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			listed = append(listed, item.ID)
+		}
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+	if fmt.Sprint(listed) != fmt.Sprint(expected) {
+		t.Errorf("listing food trucks by rating expected %v, but got %v", expected, listed)
+	}
+}
+
+func TestMongoFoodTruckListNear(t *testing.T) {
+	db, drop := newTestDatabase(t)
+	defer drop()
+	foodTrucks := NewMongoFoodTruckStore(db)
+	locations := map[string][2]float64{
+		"near":   {-97.7431, 30.2672},
+		"nearby": {-97.7500, 30.2700},
+		"far":    {-96.7970, 32.7767},
+	}
+	for id, location := range locations {
+		err := foodTrucks.Add(context.TODO(), models.JSONFoodTruck{ID: id, Location: location})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	near := [2]float64{-97.7431, 30.2672}
+	maxDistance := 5000.0
+	items, next, err := foodTrucks.List(context.TODO(), FoodTruckQuery{Near: &near, MaxDistance: &maxDistance}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "" {
+		t.Errorf("listing food trucks near a location expected one page, but got next cursor %v", next)
+	}
+	if len(items) != 2 || items[0].ID != "near" || items[1].ID != "nearby" {
+		t.Fatalf("listing food trucks near a location expected the two within the max distance closest first, but got %v", items)
+	}
+
+	// Mongo's distances should match the ones found for in-memory food trucks
+	expected := Distance(near, locations["nearby"])
+	if items[1].Distance < expected-1 || items[1].Distance > expected+1 {
+		t.Errorf("listing food trucks near a location expected a distance of %v, but got %v", expected, items[1].Distance)
+	}
+}
+
+func TestMongoFoodTruckReplacePhotos(t *testing.T) {
+	db, drop := newTestDatabase(t)
+	defer drop()
+	foodTrucks := NewMongoFoodTruckStore(db)
+	photos := []models.JSONPhoto{{ID: "first", URL: "first.jpg", Cover: true, Order: 0}}
+	err := foodTrucks.Add(context.TODO(), models.JSONFoodTruck{ID: "foodtruck", Photos: photos})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := []models.JSONPhoto{{ID: "first", URL: "first.jpg", Caption: "Tacos", Cover: true, Order: 0}}
+	replaced, err := foodTrucks.ReplacePhotos(context.TODO(), "foodtruck", photos, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replaced {
+		t.Error("replacing the current photos should have changed them")
+	}
+
+	// Photos that changed since they were read aren't replaced
+	replaced, err = foodTrucks.ReplacePhotos(context.TODO(), "foodtruck", photos, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced {
+		t.Error("replacing photos that already changed should not have changed them")
+	}
+	foodTruck, err := foodTrucks.Get(context.TODO(), "foodtruck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foodTruck.Photos) != 1 || foodTruck.Photos[0].Caption != "Tacos" {
+		t.Errorf("expected the photos to be the first replacement, but got %v", foodTruck.Photos)
+	}
+}
+
+func TestMongoReviewListPages(t *testing.T) {
+	db, drop := newTestDatabase(t)
+	defer drop()
+	reviews := NewMongoReviewStore(db)
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	dates := []time.Time{date, date.Add(time.Hour), date}
+	for i, reviewDate := range dates {
+		err := reviews.Add(context.TODO(), models.JSONReview{
+			ID:        fmt.Sprintf("review%v", i),
+			FoodTruck: "foodtruck",
+			Date:      reviewDate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"review1", "review0", "review2"}
+	var listed []string
+	page := Page{Limit: 1}
+	for {
+		items, next, err := reviews.ListByFoodTruck(context.TODO(), "foodtruck", page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			listed = append(listed, item.ID)
+		}
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+	if fmt.Sprint(listed) != fmt.Sprint(expected) {
+		t.Errorf("listing reviews expected %v, but got %v", expected, listed)
+	}
+}
+
+func TestMongoUserMigrateEmailVerified(t *testing.T) {
+	db, drop := newTestDatabase(t)
+	defer drop()
+	users := NewMongoUserStore(db)
+
+	// Users from before emails were verified don't have the field at all
+	_, err := db.Collection("users").InsertOne(context.TODO(), bson.M{"_id": "olduser", "email": "olduser@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.Add(context.TODO(), models.JSONUser{ID: "newuser", Email: "newuser@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = users.MigrateEmailVerified(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldUser, err := users.Get(context.TODO(), "olduser")
+	if err != nil || !oldUser.EmailVerified {
+		t.Error("migrating should have verified the email of a user from before emails were verified")
+	}
+	newUser, err := users.Get(context.TODO(), "newuser")
+	if err != nil || newUser.EmailVerified {
+		t.Error("migrating should not have verified the email of a user who hasn't verified it")
+	}
+}
+
+func TestMongoUpdateWithoutFields(t *testing.T) {
+	db, drop := newTestDatabase(t)
+	defer drop()
+	foodTrucks := NewMongoFoodTruckStore(db)
+	users := NewMongoUserStore(db)
+
+	err := foodTrucks.Update(context.TODO(), "foodtruck", FoodTruckUpdate{})
+	if err != nil {
+		t.Errorf("updating a food truck without fields expected no error, but got %v", err)
+	}
+	err = users.Update(context.TODO(), "user", UserUpdate{})
+	if err != nil {
+		t.Errorf("updating a user without fields expected no error, but got %v", err)
+	}
+}
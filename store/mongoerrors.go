@@ -0,0 +1,22 @@
+package store
+
+import (
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// duplicateKeyErrorCode is the error code mongo uses when a unique index is violated
+const duplicateKeyErrorCode = 11000
+
+// isDuplicateKeyError checks if a write failed because of a unique index
+func isDuplicateKeyError(err error) bool {
+	writeException, ok := err.(mongo.WriteException)
+	if !ok {
+		return false
+	}
+	for _, writeError := range writeException.WriteErrors {
+		if writeError.Code == duplicateKeyErrorCode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"munchserver/models"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a page's cursor wasn't made by the same kind of list
+var ErrInvalidCursor = errors.New("store: invalid cursor")
+
+const (
+	// DefaultPageLimit is how many items are listed when a page doesn't have a limit
+	DefaultPageLimit = 20
+	// MaxPageLimit is the most items listed in one page
+	MaxPageLimit = 100
+)
+
+// Page is the part of a list to get. Lists are sorted by their own order with ids breaking ties, and a cursor is the
+// last item of the page before in that order, so items added or removed between pages don't shift the pages after.
+type Page struct {
+	// Limit is how many items to list, DefaultPageLimit if it isn't set and never more than MaxPageLimit
+	Limit int
+	// Cursor is the next cursor of the page before, the first page is listed if it isn't set
+	Cursor string
+}
+
+// sortID lists by id, when nothing else is sorted by
+const sortID = "id"
+
+// cursor is the last item of a page, what it was sorted by and its id. It is sent to clients as opaque base64 JSON.
+type cursor struct {
+	Sort   string    `json:"s"`
+	Number float64   `json:"n,omitempty"`
+	Text   string    `json:"x,omitempty"`
+	Time   time.Time `json:"t"`
+	ID     string    `json:"i"`
+}
+
+// limit is how many items the page lists
+func (p Page) limit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// after decodes the cursor of a list sorted by the order, returning nil for the first page
+func (p Page) after(sort string) (*cursor, error) {
+	if p.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.Sort != sort || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// encode makes the opaque cursor sent to clients
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// value is what the cursor's item was sorted by
+func (c cursor) value() interface{} {
+	switch c.Sort {
+	case SortName:
+		return c.Text
+	case SortNewest:
+		return c.Time
+	}
+	return c.Number
+}
+
+// before reports whether the cursor's item is listed before the other's, which has to be sorted the same way
+func (c cursor) before(other cursor) bool {
+	switch {
+	case c.Number != other.Number && descending(c.Sort):
+		return c.Number > other.Number
+	case c.Number != other.Number:
+		return c.Number < other.Number
+	case c.Text != other.Text:
+		return c.Text < other.Text
+	case !c.Time.Equal(other.Time):
+		// Dates are always newest first
+		return c.Time.After(other.Time)
+	}
+	return c.ID < other.ID
+}
+
+// descending reports whether the sort lists the biggest first
+func descending(sort string) bool {
+	return sort == SortRating || sort == SortReviewCount || sort == SortNewest
+}
+
+// foodTruckCursor is where a food truck is in the sort order
+func foodTruckCursor(foodTruck FoodTruckWithDistance, sort string) cursor {
+	c := cursor{Sort: sort, ID: foodTruck.ID}
+	switch sort {
+	case SortDistance:
+		c.Number = foodTruck.Distance
+	case SortRating:
+		c.Number = foodTruck.AvgRating
+	case SortReviewCount:
+		c.Number = float64(len(foodTruck.Reviews))
+	case SortName:
+		c.Text = foodTruck.Name
+	case SortNewest:
+		c.Time = foodTruck.Created
+	}
+	return c
+}
+
+// reviewCursor is where a review is in the newest first order
+func reviewCursor(review models.JSONReview) cursor {
+	return cursor{Sort: SortNewest, Time: review.Date, ID: review.ID}
+}
+
+// nextFoodTrucksPage cuts off the food truck listed past the limit, returning the cursor of the next page if there was
+// one
+func nextFoodTrucksPage(foodTrucks []FoodTruckWithDistance, limit int, sort string) ([]FoodTruckWithDistance, string) {
+	if len(foodTrucks) <= limit {
+		return foodTrucks, ""
+	}
+	return foodTrucks[:limit], foodTruckCursor(foodTrucks[limit-1], sort).encode()
+}
+
+// nextReviewsPage cuts off the review listed past the limit, returning the cursor of the next page if there was one
+func nextReviewsPage(reviews []models.JSONReview, limit int) ([]models.JSONReview, string) {
+	if len(reviews) <= limit {
+		return reviews, ""
+	}
+	return reviews[:limit], reviewCursor(reviews[limit-1]).encode()
+}
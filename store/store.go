@@ -0,0 +1,288 @@
+// Package store keeps food trucks, reviews, users and what they log in with behind interfaces, so routes work the same
+// whether they are stored in MongoDB or in memory. Lists are empty rather than nil when nothing matches.
+package store
+
+import (
+	"context"
+	"errors"
+	"munchserver/models"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when there is nothing with the id, email or identity asked for
+	ErrNotFound = errors.New("store: not found")
+	// ErrDuplicateEmail is returned when another user already has the email
+	ErrDuplicateEmail = errors.New("store: duplicate email")
+	// ErrDuplicateID is returned when adding something with an id that is already used
+	ErrDuplicateID = errors.New("store: duplicate id")
+)
+
+// Orders food trucks can be listed in
+const (
+	// SortDistance lists the closest first, it needs a location to search near
+	SortDistance = "distance"
+	// SortRating lists the highest average rating first
+	SortRating = "rating"
+	// SortReviewCount lists the most reviewed first
+	SortReviewCount = "reviewCount"
+	// SortName lists by name from A to Z
+	SortName = "name"
+	// SortNewest lists the most recently added first
+	SortNewest = "newest"
+)
+
+// FoodTruckQuery is what food trucks are listed by, anything not set doesn't filter
+type FoodTruckQuery struct {
+	// Text matches any of its words in the name or tags, ignoring case
+	Text string
+	// Near is a longitude and latitude to find the distance of food trucks from
+	Near *[2]float64
+	// MaxDistance is the most meters from Near food trucks can be
+	MaxDistance *float64
+	// MinRating is the lowest average rating food trucks can have
+	MinRating *float64
+	// Tags are tags food trucks must have all of, or any of if AnyTag is set
+	Tags   []string
+	AnyTag bool
+	// Status is whether food trucks are serving
+	Status *bool
+	// Claimed is whether food trucks have an owner
+	Claimed *bool
+	// Sort is the order food trucks are listed in, closest first if it isn't set and there is a location to search
+	// near and by id otherwise
+	Sort string
+}
+
+// FoodTruckWithDistance is a listed food truck with its distance in meters from where it was searched near
+type FoodTruckWithDistance struct {
+	models.JSONFoodTruck `bson:",inline"`
+	Distance             float64 `json:"distance" bson:"distance"`
+}
+
+// FoodTruckUpdate has the fields to change on a food truck, nil fields are left as they are
+type FoodTruckUpdate struct {
+	Name        *string
+	Address     *string
+	Location    *[2]float64
+	Status      *bool
+	Hours       *[7][2]string
+	Website     *string
+	PhoneNumber *string
+	Description *string
+	Tags        []string
+}
+
+// UserUpdate has the profile fields to change on a user, nil fields are left as they are
+type UserUpdate struct {
+	NameFirst   *string
+	NameLast    *string
+	PhoneNumber *string
+	City        *string
+	State       *string
+	DateOfBirth *time.Time
+}
+
+// FoodTruckStore keeps food trucks
+type FoodTruckStore interface {
+	Get(ctx context.Context, id string) (models.JSONFoodTruck, error)
+	GetMany(ctx context.Context, ids []string) ([]models.JSONFoodTruck, error)
+	// List gets a page of the food trucks matching the query in its sort order, along with the cursor of the next page,
+	// which is empty on the last page
+	List(ctx context.Context, query FoodTruckQuery, page Page) ([]FoodTruckWithDistance, string, error)
+	ListByOwner(ctx context.Context, owner string) ([]models.JSONFoodTruck, error)
+	Add(ctx context.Context, foodTruck models.JSONFoodTruck) error
+	Update(ctx context.Context, id string, update FoodTruckUpdate) error
+	// AddReview attaches a review and sets the new average rating
+	AddReview(ctx context.Context, id string, reviewID string, avgRating float64) error
+	// AddPhoto adds a photo after the food truck's other photos
+	AddPhoto(ctx context.Context, id string, photo models.JSONPhoto) error
+	// ReplacePhotos changes the photos only if they are still the old photos, returning whether they changed
+	ReplacePhotos(ctx context.Context, id string, oldPhotos []models.JSONPhoto, photos []models.JSONPhoto) (bool, error)
+	// ReplaceOwner changes the owner only if it is still the old owner, returning whether it changed
+	ReplaceOwner(ctx context.Context, id string, oldOwner string, newOwner string) (bool, error)
+	// ClearOwner removes the owner from all of their food trucks
+	ClearOwner(ctx context.Context, owner string) error
+}
+
+// ReviewStore keeps reviews
+type ReviewStore interface {
+	Get(ctx context.Context, id string) (models.JSONReview, error)
+	GetMany(ctx context.Context, ids []string) ([]models.JSONReview, error)
+	// List gets a page of reviews, newest first, along with the cursor of the next page, which is empty on the last page
+	List(ctx context.Context, page Page) ([]models.JSONReview, string, error)
+	// ListByFoodTruck gets a page of a food truck's reviews like List
+	ListByFoodTruck(ctx context.Context, foodTruckID string, page Page) ([]models.JSONReview, string, error)
+	ListByReviewer(ctx context.Context, reviewer string) ([]models.JSONReview, error)
+	Add(ctx context.Context, review models.JSONReview) error
+	// SetReviewer changes who all of a reviewer's reviews are from
+	SetReviewer(ctx context.Context, oldReviewer string, reviewer string, reviewerName string) error
+}
+
+// UserStore keeps users
+type UserStore interface {
+	Get(ctx context.Context, id string) (models.JSONUser, error)
+	// GetProfile gets a user without their password hash
+	GetProfile(ctx context.Context, id string) (models.JSONUser, error)
+	// GetPublic gets only what anyone can see about a user
+	GetPublic(ctx context.Context, id string) (models.JSONUser, error)
+	GetByEmail(ctx context.Context, email string) (models.JSONUser, error)
+	GetByIdentity(ctx context.Context, provider string, subject string) (models.JSONUser, error)
+	Add(ctx context.Context, user models.JSONUser) error
+	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, id string, update UserUpdate) error
+	// SetPicture sets the picture to the full size of an uploaded picture along with its resized copies
+	SetPicture(ctx context.Context, id string, picture models.JSONImageVariants) error
+	// SetEmail changes the email, which will need to be verified again
+	SetEmail(ctx context.Context, id string, email string) error
+	// SetEmailVerified verifies the email only if the user still has it, returning whether it was verified
+	SetEmailVerified(ctx context.Context, id string, email string) (bool, error)
+	// SetPassword changes the password hash, access tokens issued before the date are rejected
+	SetPassword(ctx context.Context, id string, passwordHash []byte, date time.Time) error
+	AddFavorite(ctx context.Context, id string, foodTruckID string) error
+	RemoveFavorite(ctx context.Context, id string, foodTruckID string) error
+	AddReview(ctx context.Context, id string, reviewID string) error
+	AddOwnedFoodTruck(ctx context.Context, id string, foodTruckID string) error
+	RemoveOwnedFoodTruck(ctx context.Context, id string, foodTruckID string) error
+	AddRole(ctx context.Context, id string, role string) error
+	// RemoveOwnerRole takes the owner role away once the user doesn't own any food trucks
+	RemoveOwnerRole(ctx context.Context, id string) error
+	AddIdentity(ctx context.Context, id string, identity models.JSONIdentity) error
+	SetPendingTOTPSecret(ctx context.Context, id string, secret string) error
+	EnableTwoFactor(ctx context.Context, id string, secret string, step int64, recoveryCodeHashes []string) error
+	DisableTwoFactor(ctx context.Context, id string) error
+	SetRecoveryCodes(ctx context.Context, id string, recoveryCodeHashes []string) error
+	// UseTOTPStep records the step as used only if it is after the last used step, returning whether it was recorded
+	UseTOTPStep(ctx context.Context, id string, step int64) (bool, error)
+	// UseRecoveryCode removes the recovery code, returning whether the user had it
+	UseRecoveryCode(ctx context.Context, id string, recoveryCodeHash string) (bool, error)
+}
+
+// ClaimStore keeps requests from users to become the owners of food trucks
+type ClaimStore interface {
+	Get(ctx context.Context, id string) (models.JSONClaim, error)
+	// ListByStatus gets the claims with the status, oldest first
+	ListByStatus(ctx context.Context, status string) ([]models.JSONClaim, error)
+	ListByUser(ctx context.Context, userID string) ([]models.JSONClaim, error)
+	// HasPending reports whether the user has a pending claim for the food truck
+	HasPending(ctx context.Context, foodTruckID string, userID string) (bool, error)
+	Add(ctx context.Context, claim models.JSONClaim) error
+	// UseAttempt counts an attempt at the callback code of the user's pending claim, returning the claim from before
+	// it was counted, or ErrNotFound if there isn't one with attempts left
+	UseAttempt(ctx context.Context, id string, userID string) (models.JSONClaim, error)
+	SetPhoneVerified(ctx context.Context, id string) error
+	// Review approves or rejects a claim only if it is still pending, returning whether it was reviewed
+	Review(ctx context.Context, id string, status string, reviewer string, reason string, date time.Time) (bool, error)
+	// SetPending puts a reviewed claim back so it can be reviewed again
+	SetPending(ctx context.Context, id string) error
+	// ListOtherPending gets the food truck's pending claims other than the claim with the id
+	ListOtherPending(ctx context.Context, foodTruckID string, id string) ([]models.JSONClaim, error)
+	// RejectByUser rejects all of the user's pending claims
+	RejectByUser(ctx context.Context, userID string, reason string, date time.Time) error
+}
+
+// APIKeyStore keeps the api keys services call the api with
+type APIKeyStore interface {
+	Get(ctx context.Context, id string) (models.JSONAPIKey, error)
+	// List gets every api key, newest first
+	List(ctx context.Context) ([]models.JSONAPIKey, error)
+	Add(ctx context.Context, apiKey models.JSONAPIKey) error
+	// Use records a use of the unrevoked api key with the hash, returning ErrNotFound if there isn't one
+	Use(ctx context.Context, hash string, date time.Time) (models.JSONAPIKey, error)
+	// Revoke revokes the api key, returning whether there was one
+	Revoke(ctx context.Context, id string, date time.Time) (bool, error)
+}
+
+// SessionStore keeps the devices users are logged in on
+type SessionStore interface {
+	Get(ctx context.Context, id string) (models.JSONSession, error)
+	// ListActive gets the user's sessions that aren't revoked or expired, most recently used first
+	ListActive(ctx context.Context, userID string, now time.Time) ([]models.JSONSession, error)
+	// ListOthers gets the user's sessions other than the session with the id
+	ListOthers(ctx context.Context, userID string, id string) ([]models.JSONSession, error)
+	// Use starts the session, or updates where it was last used if it was already started
+	Use(ctx context.Context, id string, userID string, userAgent string, ip string, date time.Time, expires time.Time) error
+	Revoke(ctx context.Context, id string) error
+	RevokeByUser(ctx context.Context, userID string) error
+}
+
+// RefreshTokenStore keeps hashes of refresh tokens
+type RefreshTokenStore interface {
+	Get(ctx context.Context, id string) (models.JSONRefreshToken, error)
+	Add(ctx context.Context, refreshToken models.JSONRefreshToken) error
+	// Use marks an unused, unrevoked and unexpired refresh token as used, returning the token from before it was used,
+	// or ErrNotFound if there isn't one
+	Use(ctx context.Context, id string, now time.Time) (models.JSONRefreshToken, error)
+	RevokeFamily(ctx context.Context, family string) error
+	RevokeByUser(ctx context.Context, userID string) error
+}
+
+// RevokedTokenStore keeps the ids of access tokens that can no longer be used
+type RevokedTokenStore interface {
+	IsRevoked(ctx context.Context, id string) (bool, error)
+	Add(ctx context.Context, revokedToken models.JSONRevokedToken) error
+}
+
+// UserTokenStore keeps hashes of the tokens emailed to users
+type UserTokenStore interface {
+	Get(ctx context.Context, id string) (models.JSONUserToken, error)
+	// GetUsable gets an unused and unexpired token with the purpose
+	GetUsable(ctx context.Context, id string, purpose string, now time.Time) (models.JSONUserToken, error)
+	Add(ctx context.Context, userToken models.JSONUserToken) error
+	// Use marks an unused and unexpired token with the purpose as used, returning the token from before it was used,
+	// or ErrNotFound if there isn't one
+	Use(ctx context.Context, id string, purpose string, now time.Time) (models.JSONUserToken, error)
+	// UseAll marks all of the user's unused tokens with the purpose as used
+	UseAll(ctx context.Context, userID string, purpose string) error
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// LoginAttemptStore keeps counts of failed logins
+type LoginAttemptStore interface {
+	Get(ctx context.Context, id string) (models.JSONLoginAttempt, error)
+	GetMany(ctx context.Context, ids []string) ([]models.JSONLoginAttempt, error)
+	Add(ctx context.Context, loginAttempt models.JSONLoginAttempt) error
+	// RecordFailure counts a failed login, starting the count if there isn't one, and returns the count after it
+	RecordFailure(ctx context.Context, id string, date time.Time, expires time.Time) (models.JSONLoginAttempt, error)
+	SetLockedUntil(ctx context.Context, id string, date time.Time) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Stores has a store for everything the routes keep
+type Stores struct {
+	FoodTrucks    FoodTruckStore
+	Reviews       ReviewStore
+	Users         UserStore
+	Claims        ClaimStore
+	APIKeys       APIKeyStore
+	Sessions      SessionStore
+	RefreshTokens RefreshTokenStore
+	RevokedTokens RevokedTokenStore
+	UserTokens    UserTokenStore
+	LoginAttempts LoginAttemptStore
+}
+
+// sortOrder is the order the query lists food trucks in
+func (q FoodTruckQuery) sortOrder() string {
+	if q.Sort != "" {
+		return q.Sort
+	}
+	if q.Near != nil {
+		return SortDistance
+	}
+	return sortID
+}
+
+// textPattern matches any of the words in text, ignoring case
+func textPattern(text string) string {
+	words := strings.Split(text, " ")
+	pattern := "(?i)"
+	for i, word := range words {
+		pattern += "(" + word + ")"
+		if i < len(words)-1 {
+			pattern += "|"
+		}
+	}
+	return pattern
+}
@@ -2,35 +2,87 @@ package tests
 
 import (
 	"context"
-	"munchserver/dbutils"
 	"munchserver/models"
+	"munchserver/store"
+)
 
-	"go.mongodb.org/mongo-driver/mongo"
+// Everything is kept in memory, so tests don't need a database
+var (
+	FoodTrucks    = store.NewMemoryFoodTruckStore()
+	Reviews       = store.NewMemoryReviewStore()
+	Users         = store.NewMemoryUserStore()
+	Claims        = store.NewMemoryClaimStore()
+	APIKeys       = store.NewMemoryAPIKeyStore()
+	Sessions      = store.NewMemorySessionStore()
+	RefreshTokens = store.NewMemoryRefreshTokenStore()
+	RevokedTokens = store.NewMemoryRevokedTokenStore()
+	UserTokens    = store.NewMemoryUserTokenStore()
+	LoginAttempts = store.NewMemoryLoginAttemptStore()
 )
 
-var Db *mongo.Database
+// Stores gets the stores tests share
+func Stores() store.Stores {
+	return store.Stores{
+		FoodTrucks:    FoodTrucks,
+		Reviews:       Reviews,
+		Users:         Users,
+		Claims:        Claims,
+		APIKeys:       APIKeys,
+		Sessions:      Sessions,
+		RefreshTokens: RefreshTokens,
+		RevokedTokens: RevokedTokens,
+		UserTokens:    UserTokens,
+		LoginAttempts: LoginAttempts,
+	}
+}
 
 func ClearDB() {
-	_, _ = Db.Collection("users").DeleteMany(context.TODO(), dbutils.AllQuery())
-	_, _ = Db.Collection("foodTrucks").DeleteMany(context.TODO(), dbutils.AllQuery())
-	_, _ = Db.Collection("reviews").DeleteMany(context.TODO(), dbutils.AllQuery())
+	FoodTrucks.Clear()
+	Reviews.Clear()
+	Users.Clear()
+	Claims.Clear()
+	APIKeys.Clear()
+	Sessions.Clear()
+	RefreshTokens.Clear()
+	RevokedTokens.Clear()
+	UserTokens.Clear()
+	LoginAttempts.Clear()
 }
 
 func AddFoodTruck(foodTruck models.JSONFoodTruck) {
-	_, _ = Db.Collection("foodTrucks").InsertOne(context.TODO(), foodTruck)
+	_ = FoodTrucks.Add(context.TODO(), foodTruck)
 }
 
 func AddReview(review models.JSONReview) {
-	_, _ = Db.Collection("reviews").InsertOne(context.TODO(), review)
+	_ = Reviews.Add(context.TODO(), review)
+}
+
+func AddClaim(claim models.JSONClaim) {
+	_ = Claims.Add(context.TODO(), claim)
+}
+
+func AddAPIKey(apiKey models.JSONAPIKey) {
+	_ = APIKeys.Add(context.TODO(), apiKey)
+}
+
+func AddRefreshToken(refreshToken models.JSONRefreshToken) {
+	_ = RefreshTokens.Add(context.TODO(), refreshToken)
+}
+
+func AddUserToken(userToken models.JSONUserToken) {
+	_ = UserTokens.Add(context.TODO(), userToken)
+}
+
+func AddLoginAttempt(loginAttempt models.JSONLoginAttempt) {
+	_ = LoginAttempts.Add(context.TODO(), loginAttempt)
 }
 
 func AddUser(user models.JSONUser) {
-	_, _ = Db.Collection("users").InsertOne(context.TODO(), user)
+	_ = Users.Add(context.TODO(), user)
 }
 
 func GetUser(id string) *models.JSONUser {
-	var user models.JSONUser
-	err := Db.Collection("users").FindOne(context.TODO(), dbutils.WithIDQuery(id)).Decode(&user)
+	user, err := Users.Get(context.TODO(), id)
 	if err != nil {
 		return nil
 	}
@@ -38,8 +90,7 @@ func GetUser(id string) *models.JSONUser {
 }
 
 func GetFoodTruck(id string) *models.JSONFoodTruck {
-	var foodTruck models.JSONFoodTruck
-	err := Db.Collection("foodTrucks").FindOne(context.TODO(), dbutils.WithIDQuery(id)).Decode(&foodTruck)
+	foodTruck, err := FoodTrucks.Get(context.TODO(), id)
 	if err != nil {
 		return nil
 	}
@@ -47,10 +98,57 @@ func GetFoodTruck(id string) *models.JSONFoodTruck {
 }
 
 func GetReview(id string) *models.JSONReview {
-	var review models.JSONReview
-	err := Db.Collection("reviews").FindOne(context.TODO(), dbutils.WithIDQuery(id)).Decode(&review)
+	review, err := Reviews.Get(context.TODO(), id)
 	if err != nil {
 		return nil
 	}
 	return &review
 }
+
+func GetClaim(id string) *models.JSONClaim {
+	claim, err := Claims.Get(context.TODO(), id)
+	if err != nil {
+		return nil
+	}
+	return &claim
+}
+
+func GetAPIKey(id string) *models.JSONAPIKey {
+	apiKey, err := APIKeys.Get(context.TODO(), id)
+	if err != nil {
+		return nil
+	}
+	return &apiKey
+}
+
+func GetRefreshToken(id string) *models.JSONRefreshToken {
+	refreshToken, err := RefreshTokens.Get(context.TODO(), id)
+	if err != nil {
+		return nil
+	}
+	return &refreshToken
+}
+
+func GetUserToken(id string) *models.JSONUserToken {
+	userToken, err := UserTokens.Get(context.TODO(), id)
+	if err != nil {
+		return nil
+	}
+	return &userToken
+}
+
+func GetLoginAttempt(id string) *models.JSONLoginAttempt {
+	loginAttempt, err := LoginAttempts.Get(context.TODO(), id)
+	if err != nil {
+		return nil
+	}
+	return &loginAttempt
+}
+
+func GetSession(id string) *models.JSONSession {
+	session, err := Sessions.Get(context.TODO(), id)
+	if err != nil {
+		return nil
+	}
+	return &session
+}
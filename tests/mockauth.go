@@ -4,14 +4,58 @@ import (
 	"context"
 	"munchserver/middleware"
 	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
 // AuthenticateMockUser is a middleware which adds a mock user's uuid to the context of the request
 func AuthenticateMockUser(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), middleware.UserKey, "testuser")
+	return AuthenticateMockUserWithRoles()(next)
+}
+
+// AuthenticateMockUserWithRoles creates a middleware which adds a mock user's uuid and the roles to the context of the request
+func AuthenticateMockUserWithRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middleware.UserKey, "testuser")
+			ctx = context.WithValue(ctx, middleware.RolesKey, roles)
+
+			// Go to next handler with new context
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AuthenticateMockUserAuthTime creates a middleware which adds a mock user's uuid and the claims of an access token
+// from a login at the time to the context of the request
+func AuthenticateMockUserAuthTime(authTime time.Time) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middleware.UserKey, "testuser")
+			ctx = context.WithValue(ctx, middleware.ClaimsKey, middleware.Claims{
+				StandardClaims: jwt.StandardClaims{
+					IssuedAt: time.Now().Unix(),
+					Subject:  "testuser",
+				},
+				AuthTime: authTime.Unix(),
+			})
+
+			// Go to next handler with new context
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AuthenticateMockAPIKey creates a middleware which adds a mock api key's id and the scopes to the context of the request
+func AuthenticateMockAPIKey(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middleware.APIKeyKey, "testapikey")
+			ctx = context.WithValue(ctx, middleware.ScopesKey, scopes)
 
-		// Go to next handler with new context
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			// Go to next handler with new context
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// MockOIDCClientID is the client id the mock OpenID Connect provider issues tokens for
+const MockOIDCClientID = "munchtest"
+
+// MockOIDCProvider is a local stand-in for an OpenID Connect provider like Google
+type MockOIDCProvider struct {
+	Server *httptest.Server
+
+	key   *rsa.PrivateKey
+	lock  sync.Mutex
+	codes map[string]jwt.MapClaims
+}
+
+// NewMockOIDCProvider starts a provider with discovery, jwks and token endpoints, it should be closed after the test
+func NewMockOIDCProvider() *MockOIDCProvider {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	provider := &MockOIDCProvider{
+		key:   key,
+		codes: make(map[string]jwt.MapClaims),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.Issuer(),
+			"authorization_endpoint": provider.Issuer() + "/authorize",
+			"token_endpoint":         provider.Issuer() + "/token",
+			"jwks_uri":               provider.Issuer() + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "mockkey",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		provider.lock.Lock()
+		claims, exists := provider.codes[r.PostForm.Get("code")]
+		delete(provider.codes, r.PostForm.Get("code"))
+		provider.lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !exists || r.PostForm.Get("client_id") != MockOIDCClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "mockaccesstoken",
+			"token_type":   "Bearer",
+			"id_token":     provider.IDToken(claims),
+		})
+	})
+	provider.Server = httptest.NewServer(mux)
+	return provider
+}
+
+// Issuer is the url of the provider
+func (p *MockOIDCProvider) Issuer() string {
+	return p.Server.URL
+}
+
+// IDToken signs an ID token for the client with the claims added to the defaults
+func (p *MockOIDCProvider) IDToken(claims jwt.MapClaims) string {
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss": p.Issuer(),
+		"aud": MockOIDCClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for claim, value := range claims {
+		idClaims[claim] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	token.Header["kid"] = "mockkey"
+	idToken, _ := token.SignedString(p.key)
+	return idToken
+}
+
+// AuthorizationCode creates a code that can be exchanged once for an ID token with the claims
+func (p *MockOIDCProvider) AuthorizationCode(code string, claims jwt.MapClaims) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.codes[code] = claims
+	return code
+}
+
+// Close stops the provider
+func (p *MockOIDCProvider) Close() {
+	p.Server.Close()
+}
@@ -0,0 +1,165 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// check checks a value that was given against a rule with its parameter
+type check func(name string, value reflect.Value, param string) []FieldError
+
+var checks map[string]check
+
+func init() {
+	checks = map[string]check{
+		"required": checkRequired,
+		"min":      checkMin,
+		"max":      checkMax,
+		"lonlat":   checkLonLat,
+		"hours":    checkHours,
+		"url":      checkURL,
+		"phone":    checkPhone,
+		"email":    checkEmail,
+	}
+}
+
+var (
+	// timeRegexp matches a 24 hour time like 09:30
+	timeRegexp = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+	// phoneRegexp matches digits with an optional country code and common separators
+	phoneRegexp = regexp.MustCompile(`^\+?[\d\s().-]+$`)
+)
+
+func checkRequired(name string, value reflect.Value, param string) []FieldError {
+	// Empty slices and maps count as given, only nil ones are missing
+	if (value.Kind() == reflect.Slice || value.Kind() == reflect.Map) && value.IsNil() {
+		return []FieldError{Missing(name)}
+	}
+	return nil
+}
+
+func checkMin(name string, value reflect.Value, param string) []FieldError {
+	min := parseParam("min", param)
+	switch value.Kind() {
+	case reflect.String:
+		if float64(utf8.RuneCountInString(value.String())) < min {
+			return []FieldError{{name, CodeTooShort, fmt.Sprintf("Must be at least %v characters", min)}}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if float64(value.Len()) < min {
+			return []FieldError{{name, CodeTooShort, fmt.Sprintf("Must have at least %v items", min)}}
+		}
+	default:
+		if number, ok := numberOf(value); ok && number < min {
+			return []FieldError{{name, CodeOutOfRange, fmt.Sprintf("Must be at least %v", min)}}
+		}
+	}
+	return nil
+}
+
+func checkMax(name string, value reflect.Value, param string) []FieldError {
+	max := parseParam("max", param)
+	switch value.Kind() {
+	case reflect.String:
+		if float64(utf8.RuneCountInString(value.String())) > max {
+			return []FieldError{{name, CodeTooLong, fmt.Sprintf("Must be at most %v characters", max)}}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if float64(value.Len()) > max {
+			return []FieldError{{name, CodeTooLong, fmt.Sprintf("Must have at most %v items", max)}}
+		}
+	default:
+		if number, ok := numberOf(value); ok && number > max {
+			return []FieldError{{name, CodeOutOfRange, fmt.Sprintf("Must be at most %v", max)}}
+		}
+	}
+	return nil
+}
+
+func checkLonLat(name string, value reflect.Value, param string) []FieldError {
+	location, ok := value.Interface().([2]float64)
+	if !ok {
+		panic("validation: lonlat used on " + value.Type().String())
+	}
+	var errs []FieldError
+	if location[0] < -180 || location[0] > 180 {
+		errs = append(errs, FieldError{name + "[0]", CodeOutOfRange, "Longitude must be between -180 and 180"})
+	}
+	if location[1] < -90 || location[1] > 90 {
+		errs = append(errs, FieldError{name + "[1]", CodeOutOfRange, "Latitude must be between -90 and 90"})
+	}
+	return errs
+}
+
+// checkHours checks the opening and closing time of each day, the same time for both means the food truck is closed
+func checkHours(name string, value reflect.Value, param string) []FieldError {
+	hours, ok := value.Interface().([7][2]string)
+	if !ok {
+		panic("validation: hours used on " + value.Type().String())
+	}
+	var errs []FieldError
+	for day, times := range hours {
+		dayName := fmt.Sprintf("%v[%v]", name, day)
+		if !timeRegexp.MatchString(times[0]) || !timeRegexp.MatchString(times[1]) {
+			errs = append(errs, FieldError{dayName, CodeInvalid, "Expected an opening and closing time like 09:30"})
+			continue
+		}
+		// Times with leading zeros sort the same as strings
+		if times[1] < times[0] {
+			errs = append(errs, FieldError{dayName, CodeInvalid, "Closing time must be after opening time"})
+		}
+	}
+	return errs
+}
+
+func checkURL(name string, value reflect.Value, param string) []FieldError {
+	address := value.String()
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	parsed, err := url.Parse(address)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || !strings.Contains(parsed.Hostname(), ".") {
+		return []FieldError{{name, CodeInvalid, "Expected a web address like https://example.com"}}
+	}
+	return nil
+}
+
+func checkPhone(name string, value reflect.Value, param string) []FieldError {
+	phone := value.String()
+	digits := 0
+	for _, c := range phone {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	if !phoneRegexp.MatchString(phone) || digits < 7 || digits > 15 {
+		return []FieldError{{name, CodeInvalid, "Expected a phone number"}}
+	}
+	return nil
+}
+
+func checkEmail(name string, value reflect.Value, param string) []FieldError {
+	address, err := mail.ParseAddress(value.String())
+	if err != nil || address.Address != value.String() {
+		return []FieldError{{name, CodeInvalid, "Expected an email address like name@example.com"}}
+	}
+	return nil
+}
+
+// numberOf gets the value of a number field
+func numberOf(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,171 @@
+// Package validation checks request structs against rules in their validate struct tags.
+//
+// Rules are separated by commas, like `validate:"required,max=100"`:
+//
+//	required  the field must be given, so a pointer can't be nil and a string can't be empty
+//	min=N     strings and slices need at least N characters or elements, numbers must be at least N
+//	max=N     strings and slices can have at most N characters or elements, numbers can be at most N
+//	lonlat    a [2]float64 of longitude then latitude
+//	hours     a [7][2]string of opening and closing times like 09:30 for each day
+//	url       a web address, the scheme can be left out
+//	phone     a phone number of 7 to 15 digits
+//	email     an email address
+//	dive      checks every element of a slice against the rules after it
+//
+// Only required checks fields that weren't given, the other rules skip nil pointers and empty strings.
+// Structs that implement Validator can add checks that need more than one field.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Error codes for each kind of failed rule
+const (
+	CodeRequired   = "missing_field"
+	CodeInvalid    = "invalid_field"
+	CodeOutOfRange = "out_of_range"
+	CodeTooShort   = "too_short"
+	CodeTooLong    = "too_long"
+)
+
+// FieldError is a rule a field of a request failed
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Validator is implemented by requests with checks that can't be written as tags
+type Validator interface {
+	Validate() []FieldError
+}
+
+// Missing creates the error for a required field that wasn't given
+func Missing(field string) FieldError {
+	return FieldError{
+		Field:   field,
+		Code:    CodeRequired,
+		Message: "Field is required",
+	}
+}
+
+// Struct checks every field of the struct, or pointer to a struct, and returns all of the errors
+func Struct(v interface{}) []FieldError {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %v is not a struct", value.Type()))
+	}
+
+	var errs []FieldError
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, hasTag := field.Tag.Lookup("validate")
+		if !hasTag || field.PkgPath != "" {
+			continue
+		}
+		errs = append(errs, checkField(fieldName(field), value.Field(i), strings.Split(tag, ","))...)
+	}
+
+	if validator, ok := v.(Validator); ok {
+		errs = append(errs, validator.Validate()...)
+	}
+	return errs
+}
+
+// fieldName gets the name clients know a field by, from its json tag
+func fieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// checkField checks a value against the rules, stopping at the first rule it fails
+func checkField(name string, value reflect.Value, rules []string) []FieldError {
+	// Fields that weren't given only fail the required rule
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if hasRule(rules, "required") {
+				return []FieldError{Missing(name)}
+			}
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.String && value.Len() == 0 {
+		if hasRule(rules, "required") {
+			return []FieldError{Missing(name)}
+		}
+		return nil
+	}
+
+	for i, rule := range rules {
+		ruleName, param := splitRule(rule)
+		if ruleName == "dive" {
+			return diveField(name, value, rules[i+1:])
+		}
+		check, exists := checks[ruleName]
+		if !exists {
+			panic("validation: unknown rule " + ruleName)
+		}
+		errs := check(name, value, param)
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+	return nil
+}
+
+// diveField checks each element of a slice or array
+func diveField(name string, value reflect.Value, rules []string) []FieldError {
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		panic("validation: dive used on " + value.Type().String())
+	}
+	var errs []FieldError
+	for i := 0; i < value.Len(); i++ {
+		errs = append(errs, checkField(fmt.Sprintf("%v[%v]", name, i), value.Index(i), rules)...)
+	}
+	return errs
+}
+
+func hasRule(rules []string, ruleName string) bool {
+	for _, rule := range rules {
+		name, _ := splitRule(rule)
+		if name == "dive" {
+			return false
+		}
+		if name == ruleName {
+			return true
+		}
+	}
+	return false
+}
+
+func splitRule(rule string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(rule), "=", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// parseParam parses the number in a rule like max=100
+func parseParam(ruleName string, param string) float64 {
+	number, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: %v needs a number but got %q", ruleName, param))
+	}
+	return number
+}